@@ -0,0 +1,535 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"sort"
+	"strings"
+)
+
+// The kind of an operation in a change set
+type OperationKind int
+
+const (
+	AddRR       OperationKind = iota // add a record
+	DeleteRR                         // delete a record
+	DeleteRRset                      // delete all records of a type
+	DeleteName                       // delete all records of an owner
+)
+
+func (k OperationKind) String() string {
+	switch k {
+	case AddRR:
+		return "add"
+	case DeleteRR:
+		return "delete"
+	case DeleteRRset:
+		return "delete-rrset"
+	case DeleteName:
+		return "delete-name"
+	}
+	return fmt.Sprintf("OperationKind(%d)", int(k))
+}
+
+// An operation in a change set for Apply
+type Operation struct {
+	Kind OperationKind
+
+	// The owner, which is absolute or relative to the origin of the zone
+	Name string
+
+	// The TTL of a record to add.  If nil, the record gets the TTL of its
+	// RRset, if there is one, or otherwise the default TTL.
+	TTL *int
+
+	Class string // "IN" if empty
+	Type  string // not used for DeleteName
+
+	// The values of a record to add or delete, as in a zonefile.  Domain
+	// names are relative to the origin of the zone.
+	Values []string
+
+	// A comment to put after a record to add, without the semicolon
+	Comment string
+}
+
+func (op Operation) String() string {
+	s := op.Kind.String() + " " + op.Name
+	if op.TTL != nil {
+		s += fmt.Sprintf(" %d", *op.TTL)
+	}
+	if op.Class != "" {
+		s += " " + op.Class
+	}
+	if op.Kind != DeleteName {
+		s += " " + op.Type
+	}
+	if len(op.Values) > 0 {
+		s += " " + strings.Join(op.Values, " ")
+	}
+	return s
+}
+
+// Options for Apply
+type ApplyOptions struct {
+	// The origin of the zone.  If empty, the first $ORIGIN of the
+	// zonefile is used.
+	Origin string
+
+	// If set, the serial is bumped with this strategy when any of the
+	// operations was applied.
+	BumpSerial SerialStrategy
+}
+
+// An operation that could not be applied
+type Conflict struct {
+	Operation Operation
+	Reason    string
+}
+
+func (c Conflict) Error() string {
+	return c.Operation.String() + ": " + c.Reason
+}
+
+// Applies the operations one after the other.  Entries are edited in
+// place: records are added after the other records of their RRset or
+// owner, and removed together with their own comment, but the comments
+// above them are kept.  Entries after a removed or added entry keep their
+// owner and TTL, also if they inherited them.
+//
+// An operation that can't be applied, such as adding a record that's
+// already there, deleting a record that isn't or deleting a record from
+// an $INCLUDEd file, is skipped and returned as a Conflict.  If an error
+// is returned, the operations before the failing one have been applied.
+func (z *Zonefile) Apply(ops []Operation, opts ApplyOptions) (
+	[]Conflict, error) {
+	conflicts, err := newApplier(z, opts.Origin).applyAll(ops)
+	if err != nil {
+		return conflicts, err
+	}
+	if len(conflicts) < len(ops) && opts.BumpSerial != nil {
+		if _, _, err := z.BumpSerial(opts.BumpSerial); err != nil {
+			return conflicts, err
+		}
+	}
+	return conflicts, nil
+}
+
+// Returns the absolute value of the first $ORIGIN, if any
+func (z *Zonefile) firstOrigin() string {
+	i := z.findDirective("$ORIGIN", 0, len(z.entries))
+	if i < 0 {
+		return ""
+	}
+	vs := z.entries[i].rawValues()
+	if len(vs) == 0 || !isAbsolute(string(vs[0].val)) {
+		return ""
+	}
+	return string(vs[0].val)
+}
+
+// Keeps track of the state while applying operations
+type applier struct {
+	z          *Zonefile
+	origin     string // passed to Records
+	zoneOrigin string // to which the names in operations are relative
+
+	// The records are resolved once, and then kept up to date as entries
+	// are added and removed, as are the states of the resolver before
+	// each entry and after the last one.
+	records []appliedRecord
+	states  []resolverState
+}
+
+// A record as the applier keeps track of it
+type appliedRecord struct {
+	Record
+	key   recordKey
+	entry int // index of its entry, or of the $INCLUDE of its file
+}
+
+func newApplier(z *Zonefile, origin string) *applier {
+	a := &applier{z: z, origin: origin, zoneOrigin: origin}
+	if a.zoneOrigin == "" {
+		a.zoneOrigin = z.firstOrigin()
+	}
+	return a
+}
+
+// Applies the operations one after the other and returns the ones that
+// can't be applied
+func (a *applier) applyAll(ops []Operation) ([]Conflict, error) {
+	var conflicts []Conflict
+	for _, op := range ops {
+		reason, err := a.apply(op)
+		if err != nil {
+			return conflicts, fmt.Errorf("%v: %v", op, err)
+		}
+		if reason != "" {
+			conflicts = append(conflicts, Conflict{op, reason})
+		}
+	}
+	return conflicts, nil
+}
+
+// Applies the operation and returns why it can't be, if it can't be
+func (a *applier) apply(op Operation) (string, error) {
+	key, err := a.key(op)
+	if err != nil {
+		return "", err
+	}
+	if err := a.resolve(); err != nil {
+		return "", err
+	}
+	matches := a.find(op.Kind, key)
+
+	if op.Kind == AddRR {
+		if len(matches) > 0 {
+			return "record already exists", nil
+		}
+		return "", a.add(op, key)
+	}
+
+	if len(matches) == 0 {
+		switch op.Kind {
+		case DeleteRR:
+			return "no such record", nil
+		case DeleteRRset:
+			return "no such RRset", nil
+		}
+		return "no such name", nil
+	}
+	for _, j := range matches {
+		if r := a.records[j]; r.Zonefile != a.z {
+			return "record is in included file " + r.Zonefile.Path(), nil
+		}
+	}
+
+	// Delete the records one by one.  Each removal takes a record out, so
+	// the later matches move up by one.
+	for n, j := range matches {
+		if err := a.remove(j - n); err != nil {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// Returns the key of the record, RRset or name of the operation
+func (a *applier) key(op Operation) (k recordKey, err error) {
+	name := absoluteName(op.Name, a.zoneOrigin)
+	if !isAbsolute(name) {
+		return k, errors.New("relative domain name without origin")
+	}
+	if k.name, err = wire.CanonicalName(name); err != nil {
+		return k, err
+	}
+	k.class = strings.ToUpper(op.Class)
+	if k.class == "" {
+		k.class = "IN"
+	}
+	if op.Kind == DeleteName {
+		return k, nil
+	}
+	k.typ = strings.ToUpper(op.Type)
+	if _, ok := typeCode(k.typ); !ok && !strings.HasPrefix(k.typ, "TYPE") {
+		return k, fmt.Errorf("unknown type %s", op.Type)
+	}
+	if op.Kind == DeleteRRset {
+		return k, nil
+	}
+	var raw [][]byte
+	for _, v := range op.Values {
+		raw = append(raw, []byte(v))
+	}
+	rdata, _, err := canonicalRdata(k.typ, raw, a.zoneOrigin)
+	if err != nil {
+		return k, err
+	}
+	k.rdata = strings.Join(rdata, " ")
+	return k, nil
+}
+
+// Resolves the records of the zonefile, unless they are already
+func (a *applier) resolve() error {
+	if a.states != nil {
+		return nil
+	}
+	r, err := a.z.resolve(a.origin, true)
+	if err != nil {
+		return err
+	}
+	a.records = make([]appliedRecord, len(r.records))
+	for j := range r.records {
+		rec := &r.records[j]
+		a.records[j] = appliedRecord{*rec, recordKeyOf(rec), r.entries[j]}
+	}
+	a.states = r.states
+	return nil
+}
+
+// Returns the indices of the records that the operation is about
+func (a *applier) find(kind OperationKind, key recordKey) (r []int) {
+	for j := range a.records {
+		k := a.records[j].key
+		var match bool
+		switch kind {
+		case AddRR, DeleteRR:
+			match = k == key
+		case DeleteRRset:
+			match = k.rrsetKey == key.rrsetKey
+		case DeleteName:
+			match = k.name == key.name && k.class == key.class
+		}
+		if match {
+			r = append(r, j)
+		}
+	}
+	return
+}
+
+// Returns the index of the first record of the zonefile itself in an
+// entry at or after the ith, or -1
+func (a *applier) recordFrom(i int) int {
+	j := sort.Search(len(a.records), func(j int) bool {
+		return a.records[j].entry >= i
+	})
+	for ; j < len(a.records); j++ {
+		if a.records[j].Zonefile == a.z {
+			return j
+		}
+	}
+	return -1
+}
+
+// Resolves the entries from the ith up to the first record of the
+// zonefile itself again, starting from the state before the ith, and
+// updates that record and the states of the resolver up to after it.
+// Returns the index of the record, or -1 if there is none.
+func (a *applier) resolveFrom(i int) (int, error) {
+	r := &resolver{resolverState: a.states[i]}
+	for ; i < len(a.z.entries); i++ {
+		a.states[i] = r.resolverState
+		e := &a.z.entries[i]
+		if err := r.entry(a.z, e); err != nil {
+			return -1, err
+		}
+		if e.isControl {
+			continue
+		}
+		a.states[i+1] = r.resolverState
+		j := a.recordFrom(i)
+		rec := &r.records[len(r.records)-1]
+		a.records[j] = appliedRecord{*rec, recordKeyOf(rec), i}
+		return j, nil
+	}
+	a.states[i] = r.resolverState
+	return -1, nil
+}
+
+// Points the records of the zonefile itself to their entries again, as
+// entries move when one is added or removed
+func (a *applier) moved() {
+	for j := range a.records {
+		if r := &a.records[j]; r.Zonefile == a.z {
+			r.Entry = &a.z.entries[r.entry]
+		}
+	}
+}
+
+// Removes the entry of the jth record
+func (a *applier) remove(j int) error {
+	r := a.records[j]
+	i := r.entry
+
+	// The next record might inherit the owner or TTL of the record we
+	// remove, so we write them out.
+	if k := a.recordFrom(i + 1); k >= 0 {
+		next := &a.records[k]
+		if r.Entry.Domain() != nil && next.Entry.Domain() == nil {
+			owner := relativeName(next.Name, next.origin)
+			if err := next.Entry.SetDomain([]byte(owner)); err != nil {
+				return err
+			}
+		}
+		if r.Entry.TTL() != nil && next.ttlFromPrevious {
+			if err := next.Entry.SetTTL(next.TTL); err != nil {
+				return err
+			}
+		}
+	}
+
+	a.z.removeEntry(i)
+	a.records = append(a.records[:j], a.records[j+1:]...)
+	for k := j; k < len(a.records); k++ {
+		a.records[k].entry--
+	}
+	a.states = append(a.states[:i+1], a.states[i+2:]...)
+	a.moved()
+	_, err := a.resolveFrom(i)
+	return err
+}
+
+// Removes the ith entry.  The comments and empty lines above it are
+// kept.
+func (z *Zonefile) removeEntry(i int) {
+	e := z.entries[i]
+	z.count(&e, -1)
+	lead := e.tokens[:e.startOfLine()]
+	if i+1 < len(z.entries) {
+		next := &z.entries[i+1]
+		next.tokens = append(append([]taggedToken{}, lead...),
+			next.tokens...)
+	} else {
+		var suffix []token
+		for _, tt := range lead {
+			suffix = append(suffix, tt.t)
+		}
+		z.suffix = append(suffix, z.suffix...)
+	}
+	z.entries = append(z.entries[:i], z.entries[i+1:]...)
+}
+
+// Adds the record of the operation
+func (a *applier) add(op Operation, key recordKey) error {
+	// Find where to add the record: after its RRset or otherwise after
+	// the other records of its owner, if they are in the zonefile itself.
+	lastOfRRset, lastOfName := -1, -1
+	ttl := op.TTL
+	for j := range a.records {
+		rec := &a.records[j]
+		if rec.key.rrsetKey == key.rrsetKey && ttl == nil {
+			rrsetTTL := rec.TTL
+			ttl = &rrsetTTL
+		}
+		if rec.Zonefile != a.z {
+			continue
+		}
+		if rec.key.rrsetKey == key.rrsetKey {
+			lastOfRRset = j
+		}
+		if rec.key.name == key.name {
+			lastOfName = j
+		}
+	}
+	after := lastOfRRset
+	if after < 0 {
+		after = lastOfName
+	}
+	i := len(a.z.entries)
+	origin := a.states[i].origin
+	if after >= 0 {
+		origin = a.records[after].origin
+		i = a.records[after].entry + 1
+	}
+
+	e, err := a.newEntry(op, key, origin)
+	if err != nil {
+		return err
+	}
+	dflt := func() *int {
+		if ttl != nil {
+			return ttl
+		}
+		return a.z.defaultTTL()
+	}
+	var next *Record
+	if k := a.recordFrom(i); k >= 0 {
+		rec := a.records[k].Record
+		next = &rec
+	}
+	if i == len(a.z.entries) {
+		if a.z.endsOnNewline() {
+			e.tokens = append(e.tokens, tttNewline)
+		}
+		a.z.addEntry(e, dflt)
+	} else {
+		if s := a.z.inferStyle(); s.inferred {
+			e.layout(s, dflt)
+		}
+		a.z.insertEntry(i, e)
+	}
+
+	// Make room for the record, which resolveFrom fills in
+	j := a.recordFrom(i)
+	if j < 0 {
+		j = len(a.records)
+	}
+	for k := j; k < len(a.records); k++ {
+		a.records[k].entry++
+	}
+	a.records = append(a.records, appliedRecord{})
+	copy(a.records[j+1:], a.records[j:])
+	a.records[j] = appliedRecord{Record: Record{Zonefile: a.z}, entry: i}
+	a.states = append(a.states, resolverState{})
+	copy(a.states[i+2:], a.states[i+1:])
+	a.moved()
+	if _, err := a.resolveFrom(i); err != nil {
+		return err
+	}
+
+	// Give the record its TTL, if it doesn't get it already
+	if ttl != nil && a.records[j].TTL != *ttl {
+		if err := a.z.entries[i].SetTTL(*ttl); err != nil {
+			return err
+		}
+		if _, err := a.resolveFrom(i); err != nil {
+			return err
+		}
+	}
+	return a.keep(next, i+1)
+}
+
+// Creates the entry for a record to add, where the given origin is in
+// effect.
+func (a *applier) newEntry(op Operation, key recordKey, origin string) (
+	e Entry, err error) {
+	name := absoluteName(op.Name, a.zoneOrigin)
+	parts := []string{relativeName(name, origin)}
+	if op.Class != "" && key.class != "IN" {
+		parts = append(parts, key.class)
+	}
+	parts = append(parts, key.typ)
+	kinds := rdataFields[key.typ]
+	for j, v := range op.Values {
+		if j < len(kinds) && kinds[j] == fieldName && origin != a.zoneOrigin {
+			v = absoluteName(v, a.zoneOrigin)
+		}
+		parts = append(parts, v)
+	}
+	if op.Comment != "" {
+		parts = append(parts, "; "+strings.Replace(op.Comment, "\n", " ", -1))
+	}
+	e, perr := ParseEntry([]byte(strings.Join(parts, " ")))
+	if perr != nil {
+		return e, perr
+	}
+	return e, nil
+}
+
+// Makes sure the record, which was in the zonefile before an entry was
+// added, keeps its owner and TTL; it's now in the ith entry or after.
+func (a *applier) keep(r *Record, i int) error {
+	if r == nil {
+		return nil
+	}
+	j, err := a.resolveFrom(i)
+	if err != nil || j < 0 {
+		return err
+	}
+	now := a.records[j]
+	if !equalNames(now.Name, r.Name) {
+		owner := relativeName(r.Name, r.origin)
+		if err := now.Entry.SetDomain([]byte(owner)); err != nil {
+			return err
+		}
+	}
+	if now.TTL != r.TTL {
+		if err := now.Entry.SetTTL(r.TTL); err != nil {
+			return err
+		}
+	}
+	_, err = a.resolveFrom(i)
+	return err
+}
@@ -0,0 +1,166 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func ExampleZonefile_Apply() {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+; web servers
+www  IN A   1.2.3.4 ; old
+     IN A   1.2.3.5
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	conflicts, err2 := zf.Apply([]zonefile.Operation{
+		{Kind: zonefile.DeleteRR, Name: "www", Type: "A",
+			Values: []string{"1.2.3.4"}},
+		{Kind: zonefile.AddRR, Name: "www", Type: "A",
+			Values: []string{"1.2.3.6"}},
+		{Kind: zonefile.DeleteRR, Name: "ftp", Type: "A",
+			Values: []string{"1.2.3.4"}},
+	}, zonefile.ApplyOptions{BumpSerial: zonefile.IncrementSerial})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	for _, c := range conflicts {
+		fmt.Println(c)
+	}
+	fmt.Print(string(zf.Save()))
+	// Output:
+	// delete ftp A 1.2.3.4: no such record
+	// $ORIGIN example.com.
+	// $TTL 3600
+	// @    IN SOA ns1 hostmaster 2 3600 600 604800 60
+	//      IN NS  ns1
+	// ns1  IN A   1.2.3.4
+	// ; web servers
+	// www  IN A   1.2.3.5
+	// www  IN A   1.2.3.6
+}
+
+func TestApply(t *testing.T) {
+	ttl := 300
+	for _, test := range []struct {
+		zone      string
+		ops       []zonefile.Operation
+		expected  string
+		conflicts int
+	}{
+		// TTLs inherited from a removed record are kept
+		{"@ 60 A 1.2.3.4\nwww 120 A 1.2.3.4\n A 1.2.3.5\n",
+			[]zonefile.Operation{{Kind: zonefile.DeleteRR, Name: "www",
+				Type: "A", Values: []string{"1.2.3.4"}}},
+			"@ 60 A 1.2.3.4\nwww 120 A 1.2.3.5\n", 0},
+
+		// Records that inherit their owner keep it when we add a record
+		// in between
+		{"a 60 A 1.2.3.4\n TXT hi\nb 60 A 1.2.3.4\n",
+			[]zonefile.Operation{{Kind: zonefile.AddRR, Name: "b",
+				Type: "A", TTL: &ttl, Values: []string{"1.2.3.5"}},
+				{Kind: zonefile.AddRR, Name: "a.example.com.",
+					Type: "A", Values: []string{"1.2.3.5"}}},
+			"a 60 A 1.2.3.4\na 60 A 1.2.3.5\n TXT hi\n" +
+				"b 60 A 1.2.3.4\nb 300 A 1.2.3.5\n", 0},
+
+		// Deleting RRsets and names
+		{"a 60 A 1.2.3.4\n A 1.2.3.5\n TXT hi\nb 60 A 1.2.3.4\n",
+			[]zonefile.Operation{
+				{Kind: zonefile.DeleteRRset, Name: "a", Type: "A"},
+				{Kind: zonefile.DeleteName, Name: "b"},
+				{Kind: zonefile.DeleteName, Name: "c"},
+				{Kind: zonefile.DeleteRRset, Name: "a", Type: "MX"}},
+			"a 60 TXT hi\n", 2},
+
+		// Adding a record that exists is a conflict
+		{"a 60 MX 10 mail\n",
+			[]zonefile.Operation{{Kind: zonefile.AddRR,
+				Name: "a.example.com.", Type: "MX",
+				Values: []string{"10", "MAIL.example.com."}}},
+			"a 60 MX 10 mail\n", 1},
+	} {
+		zf, err := zonefile.Load([]byte(test.zone))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conflicts, err2 := zf.Apply(test.ops,
+			zonefile.ApplyOptions{Origin: "example.com."})
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		if len(conflicts) != test.conflicts {
+			t.Fatalf("Unexpected conflicts for %q: %v", test.zone, conflicts)
+		}
+		if string(zf.Save()) != test.expected {
+			t.Fatalf("Unexpected result for %q: %q", test.zone, zf.Save())
+		}
+	}
+}
+
+// Apply keeps track of the records as it goes, so applying the operations
+// at once must give what applying them one by one gives.
+func TestApplyAtOnce(t *testing.T) {
+	zone := `$ORIGIN example.com.
+@    60 IN SOA ns1 hostmaster 1 3600 600 604800 60
+        IN NS  ns1
+ns1     IN A   192.0.2.1
+www 300 IN A   192.0.2.80
+        IN A   192.0.2.81
+        IN TXT "web"
+$ORIGIN sub.example.com.
+a       IN A   192.0.2.5
+$TTL 120
+b       IN A   192.0.2.6
+`
+	ttl := 30
+	var ops []zonefile.Operation
+	for _, name := range []string{"www", "ns1", "a.sub", "b.sub", "c.sub",
+		"new"} {
+		ops = append(ops,
+			zonefile.Operation{Kind: zonefile.AddRR, Name: name,
+				Type: "A", Values: []string{"192.0.2.99"}},
+			zonefile.Operation{Kind: zonefile.AddRR, Name: name,
+				Type: "TXT", TTL: &ttl, Values: []string{"added"}},
+			zonefile.Operation{Kind: zonefile.DeleteRR, Name: "www",
+				Type: "A", Values: []string{"192.0.2.80"}},
+			zonefile.Operation{Kind: zonefile.DeleteRRset, Name: name,
+				Type: "A"})
+	}
+	ops = append(ops, zonefile.Operation{Kind: zonefile.DeleteName,
+		Name: "www"})
+
+	atOnce, err := zonefile.Load([]byte(zone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err2 := atOnce.Apply(ops, zonefile.ApplyOptions{})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	oneByOne, _ := zonefile.Load([]byte(zone))
+	n := 0
+	for _, op := range ops {
+		c, err2 := oneByOne.Apply([]zonefile.Operation{op},
+			zonefile.ApplyOptions{})
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		n += len(c)
+	}
+	if len(conflicts) != n {
+		t.Fatalf("%d conflicts instead of %d: %v", len(conflicts), n,
+			conflicts)
+	}
+	if string(atOnce.Save()) != string(oneByOne.Save()) {
+		t.Fatalf("got\n%s\ninstead of\n%s", atOnce.Save(), oneByOne.Save())
+	}
+}
@@ -0,0 +1,323 @@
+package zonefile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The columns of the CSV files of ExportCSV and ImportCSV
+var csvColumns = []string{"owner", "ttl", "class", "type", "rdata", "comment"}
+
+// Options for ExportCSV and ImportCSV
+type CSVOptions struct {
+	// The origin of the zone, as for Records and Apply.  When importing,
+	// owners and domain names in the rdata may be relative to it.
+	Origin string
+
+	// Whether the CSV has all records of the zone, so that records which
+	// aren't in it are deleted when importing.  Otherwise only the RRsets
+	// that are in the CSV are changed.
+	Complete bool
+
+	// If set, the serial is bumped with this strategy when importing
+	// changed the zonefile.
+	BumpSerial SerialStrategy
+}
+
+// A row of a CSV file to import
+type csvRow struct {
+	key     recordKey
+	op      Operation
+	deletes bool // whether the row only names an RRset to delete
+}
+
+// Returns the records in the zonefile and the files it includes as CSV,
+// with a header and a row for each record with its owner, TTL, class,
+// type, rdata and comment.  Owners are absolute, and the rdata is as in a
+// zonefile, with absolute domain names.  If the records can't be
+// resolved, the error of Records is returned.
+func ExportCSV(z *Zonefile, opts CSVOptions) ([]byte, error) {
+	records, err := z.Records(opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(csvColumns)
+	for _, r := range records {
+		w.Write([]string{r.Name, strconv.Itoa(r.TTL), r.Class, r.Type,
+			strings.Join(r.Values, " "), r.Entry.comment()})
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// Applies a CSV file as written by ExportCSV to the zonefile as a change
+// set.  The first row names the columns, which may be in any order; the
+// owner, type and rdata columns are needed.  Rows turn the RRsets they
+// are about into the records in the rows: records that aren't in the
+// rows are deleted, records that are in the rows are added, and records
+// whose TTL differs get the new one.  Rows without TTL get the TTL of the
+// record they match or of their RRset, and rows without class are of
+// class IN.  A row with empty rdata deletes its RRset.  With Complete
+// set, RRsets that have no rows are deleted as well.
+//
+// The changes are made as by Apply, so that entries which didn't change
+// keep their comments and formatting, and the comments in the rows are
+// put after the records that are added.  Changes that can't be applied,
+// such as deleting a record in an included file, are skipped and
+// returned as Conflict.
+//
+// Errors in rows are returned with the number of the row, counting from
+// 1 for the header, and the name of the column.  Rows are counted as CSV
+// has them, so a quoted field with a line break doesn't start a new one.
+// If an error is returned, the zonefile is left alone.
+func (z *Zonefile) ImportCSV(data []byte, opts CSVOptions) ([]Conflict,
+	error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("row 1: missing header")
+	} else if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok || !csvColumn(name) {
+			return nil, fmt.Errorf("row 1: column %d: unknown or repeated "+
+				"column %q", i+1, header[i])
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"owner", "type", "rdata"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("row 1: missing column %s", name)
+		}
+	}
+
+	zoneOrigin := opts.Origin
+	if zoneOrigin == "" {
+		zoneOrigin = z.firstOrigin()
+	}
+	var rows []csvRow
+	for rowNo := 2; ; rowNo++ {
+		fields, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if j, ok := columns[name]; ok && j < len(fields) {
+				return strings.TrimSpace(fields[j])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(fields, "")) == "" {
+			continue // an empty row, as spreadsheets write them
+		}
+		row, err := csvRowFrom(field, zoneOrigin)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", rowNo, err)
+		}
+		rows = append(rows, row)
+	}
+
+	c, err := z.Copy()
+	if err != nil {
+		return nil, err
+	}
+	records, err := c.Records(opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+	ops, retimed := csvOperations(uniqueRecords(records), rows,
+		opts.Complete)
+	a := newApplier(c, opts.Origin)
+	var conflicts []Conflict
+	changed := false
+	for _, row := range retimed {
+		reason, err := a.setTTL(row.key, *row.op.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", row.op, err)
+		}
+		if reason != "" {
+			conflicts = append(conflicts, Conflict{row.op, reason})
+		} else {
+			changed = true
+		}
+	}
+	failed, err := a.applyAll(ops)
+	if err != nil {
+		return nil, err
+	}
+	conflicts = append(conflicts, failed...)
+	if opts.BumpSerial != nil && (changed || len(failed) < len(ops)) {
+		if _, _, err := c.BumpSerial(opts.BumpSerial); err != nil {
+			return nil, err
+		}
+	}
+	z.replaceWith(c)
+	return conflicts, nil
+}
+
+// Checks whether the name is that of a column of the CSV files
+func csvColumn(name string) bool {
+	for _, column := range csvColumns {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the fields of a row and returns the record it's about.  Errors
+// start with the name of the column.
+func csvRowFrom(field func(string) string, origin string) (row csvRow,
+	err error) {
+	owner := field("owner")
+	if owner == "" {
+		return row, errors.New("owner: missing owner")
+	}
+	name := absoluteName(owner, origin)
+	if !isAbsolute(name) {
+		return row, errors.New("owner: relative domain name without origin")
+	}
+	if row.key.name, err = wire.CanonicalName(name); err != nil {
+		return row, fmt.Errorf("owner: %v", err)
+	}
+
+	var ttl *int
+	if s := field("ttl"); s != "" {
+		v, err := parseTTL(s)
+		if err != nil || v > maxTTL {
+			return row, fmt.Errorf("ttl: invalid TTL %q", s)
+		}
+		ttl = &v
+	}
+	row.key.class = strings.ToUpper(field("class"))
+	if row.key.class == "" {
+		row.key.class = "IN"
+	}
+	if _, ok := classCode(row.key.class); !ok {
+		return row, fmt.Errorf("class: unknown class %q", field("class"))
+	}
+	typ := strings.ToUpper(field("type"))
+	if typ == "" {
+		return row, errors.New("type: missing type")
+	}
+	code, ok := typeCode(typ)
+	if !ok {
+		return row, fmt.Errorf("type: unknown type %q", field("type"))
+	}
+	row.key.typ = typeName(code)
+
+	row.op = Operation{Kind: AddRR, Name: name, TTL: ttl,
+		Class: row.key.class, Type: row.key.typ,
+		Comment: field("comment")}
+	rdata := field("rdata")
+	if rdata == "" {
+		row.deletes = true
+		return row, nil
+	}
+	e, perr := ParseEntry([]byte("@ " + row.key.typ + " " + rdata))
+	if perr != nil {
+		return row, fmt.Errorf("rdata: %v", perr)
+	}
+	// The values as written, so that quoted strings stay quoted
+	var values [][]byte
+	for _, t := range e.rawValues() {
+		values = append(values, t.val)
+		row.op.Values = append(row.op.Values, string(t.val))
+	}
+	canonical, _, err := canonicalRdata(row.key.typ, values, origin)
+	if err != nil {
+		return row, fmt.Errorf("rdata: %v", err)
+	}
+	row.key.rdata = strings.Join(canonical, " ")
+	return row, nil
+}
+
+// Returns the operations that turn the RRsets of the rows, or with
+// complete set all RRsets, into the records of the rows, and the rows of
+// records whose TTL changes.  New records are added first, so that they
+// take the place and TTL of their RRset.
+func csvOperations(records []*Record, rows []csvRow, complete bool) (
+	ops []Operation, retimed []*csvRow) {
+	inCSV := make(map[rrsetKey]bool)
+	wanted := make(map[recordKey]*csvRow)
+	for i, row := range rows {
+		inCSV[row.key.rrsetKey] = true
+		if _, ok := wanted[row.key]; !ok && !row.deletes {
+			wanted[row.key] = &rows[i]
+		}
+	}
+	existing := make(map[recordKey]bool)
+	for _, r := range records {
+		existing[recordKeyOf(r)] = true
+	}
+	for i := range rows {
+		if row := &rows[i]; wanted[row.key] == row && !existing[row.key] {
+			ops = append(ops, row.op)
+		}
+	}
+
+	for _, r := range records {
+		k := recordKeyOf(r)
+		if !complete && !inCSV[k.rrsetKey] {
+			continue
+		}
+		row, ok := wanted[k]
+		switch {
+		case !ok:
+			ops = append(ops, Operation{Kind: DeleteRR, Name: r.Name,
+				Class: r.Class, Type: r.Type, Values: r.Values})
+		case row.op.TTL != nil && *row.op.TTL != r.TTL:
+			retimed = append(retimed, row)
+		}
+	}
+	return ops, retimed
+}
+
+// Sets the TTL of the record with the key in place, so that it keeps its
+// place and comments.  Returns why it can't be, if it can't be.
+func (a *applier) setTTL(key recordKey, ttl int) (string, error) {
+	if err := a.resolve(); err != nil {
+		return "", err
+	}
+	for j := range a.records {
+		r := &a.records[j]
+		if r.key != key {
+			continue
+		}
+		if r.Zonefile != a.z {
+			return "record is in included file " + r.Zonefile.Path(), nil
+		}
+
+		// The next record might get its TTL from this one
+		if k := a.recordFrom(r.entry + 1); k >= 0 &&
+			a.records[k].ttlFromPrevious {
+			next := &a.records[k]
+			if err := next.Entry.SetTTL(next.TTL); err != nil {
+				return "", err
+			}
+			if _, err := a.resolveFrom(next.entry); err != nil {
+				return "", err
+			}
+		}
+		if err := r.Entry.SetTTL(ttl); err != nil {
+			return "", err
+		}
+		_, err := a.resolveFrom(r.entry)
+		return "", err
+	}
+	return "no such record", nil
+}
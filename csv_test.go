@@ -0,0 +1,193 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"strings"
+	"testing"
+)
+
+const csvZone = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+; hosts
+ns1  IN A   192.0.2.1 ; in the basement
+www  300 IN A 192.0.2.80
+     300 IN A 192.0.2.81
+ftp  IN CNAME www
+`
+
+func ExampleExportCSV() {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+www 300 IN A   192.0.2.1 ; web server
+@   300 IN TXT "v=spf1 -all"
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	data, err2 := zonefile.ExportCSV(zf, zonefile.CSVOptions{})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	fmt.Print(string(data))
+	// Output:
+	// owner,ttl,class,type,rdata,comment
+	// www.example.com.,300,IN,A,192.0.2.1,web server
+	// example.com.,300,IN,TXT,"""v=spf1 -all""",
+}
+
+func ExampleZonefile_ImportCSV() {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  IN A   192.0.2.80
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	conflicts, err2 := zf.ImportCSV([]byte(`owner,type,rdata,comment
+www,A,192.0.2.81,
+mail,A,192.0.2.25,new mail server
+`), zonefile.CSVOptions{BumpSerial: zonefile.IncrementSerial})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	for _, c := range conflicts {
+		fmt.Println(c)
+	}
+	fmt.Print(string(zf.Save()))
+	// Output:
+	// $ORIGIN example.com.
+	// $TTL 3600
+	// @    IN SOA ns1 hostmaster 2 3600 600 604800 60
+	//      IN NS  ns1
+	// ns1  IN A   192.0.2.1 ; in the basement
+	// www  IN A   192.0.2.81
+	// mail IN A   192.0.2.25 ; new mail server
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	zf, err := zonefile.Load([]byte(csvZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err2 := zonefile.ExportCSV(zf, zonefile.CSVOptions{})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if !strings.Contains(string(data),
+		"\nns1.example.com.,3600,IN,A,192.0.2.1,in the basement\n") {
+		t.Fatalf("got\n%s", data)
+	}
+
+	// Importing what we exported changes nothing
+	conflicts, err2 := zf.ImportCSV(data, zonefile.CSVOptions{
+		Complete: true, BumpSerial: zonefile.IncrementSerial})
+	if err2 != nil || len(conflicts) != 0 {
+		t.Fatal(err2, conflicts)
+	}
+	if got := string(zf.Save()); got != csvZone {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, csvZone)
+	}
+
+	// Edit the rows: drop ftp, change the TTL of ns1 and a www address
+	var edited []string
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case strings.HasPrefix(line, "ftp."):
+			continue
+		case strings.HasPrefix(line, "ns1."):
+			line = strings.Replace(line, "3600", "60", 1)
+		case strings.HasPrefix(line, "www.") && strings.Contains(line, ".81"):
+			line = strings.Replace(line, ".81", ".82", 1)
+		}
+		edited = append(edited, line)
+	}
+	conflicts, err2 = zf.ImportCSV([]byte(strings.Join(edited, "\n")),
+		zonefile.CSVOptions{Complete: true})
+	if err2 != nil || len(conflicts) != 0 {
+		t.Fatal(err2, conflicts)
+	}
+	expected := `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+; hosts
+ns1  60  IN A   192.0.2.1 ; in the basement
+www  300 IN A 192.0.2.80
+www 300 IN A 192.0.2.82
+`
+	if got := string(zf.Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
+
+func TestImportCSVErrors(t *testing.T) {
+	for _, test := range []struct {
+		data, err string
+	}{
+		{"owner,type\n", "row 1: missing column rdata"},
+		{"owner,type,rdata,weight\n", `row 1: column 4: unknown or ` +
+			`repeated column "weight"`},
+		{"owner,type,rdata\nwww,A,192.0.2.1\nwww,A,192.0.2\n",
+			"row 3: rdata: invalid IPv4 address"},
+		{"owner,ttl,type,rdata\nwww,1x,A,192.0.2.1\n",
+			`row 2: ttl: invalid TTL "1x"`},
+		{"owner,type,rdata\n\nwww,AA,192.0.2.1\n",
+			`row 2: type: unknown type "AA"`},
+		{"owner,type,rdata,comment\nwww,A,192.0.2.1,\"two\nlines\"\n" +
+			"www,AA,192.0.2.1,\n", `row 3: type: unknown type "AA"`},
+		{"owner,type,rdata\n,A,192.0.2.1\n", "row 2: owner: missing owner"},
+		{"owner,type,rdata\nwww,MX,10 \"mail\n", "parse error on line 2"},
+	} {
+		zf, err := zonefile.Load([]byte(csvZone))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err2 := zf.ImportCSV([]byte(test.data), zonefile.CSVOptions{})
+		if err2 == nil || !strings.HasPrefix(err2.Error(), test.err) {
+			t.Fatalf("expected error %q, not %v", test.err, err2)
+		}
+		if got := string(zf.Save()); got != csvZone {
+			t.Fatalf("zonefile changed to\n%s", got)
+		}
+	}
+}
+
+func TestImportCSVFields(t *testing.T) {
+	zf, err := zonefile.Load([]byte(csvZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conflicts, err2 := zf.ImportCSV([]byte(`Type, RDATA ,Owner,Comment
+TXT,"""hello, world"" ""say \""hi\""""",www,"spans
+two lines"
+,,,
+CNAME,,ftp.example.com.,
+MX,10 mail,@,"a ""quoted"" comment; with a semicolon"
+`), zonefile.CSVOptions{})
+	if err2 != nil || len(conflicts) != 0 {
+		t.Fatal(err2, conflicts)
+	}
+	expected := `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+@    IN MX  10 mail ; a "quoted" comment; with a semicolon
+; hosts
+ns1  IN A   192.0.2.1 ; in the basement
+www  300 IN A 192.0.2.80
+     300 IN A 192.0.2.81
+www  IN TXT "hello, world" "say \"hi\"" ; spans two lines
+`
+	if got := string(zf.Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
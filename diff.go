@@ -0,0 +1,196 @@
+package zonefile
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"sort"
+	"strings"
+)
+
+// What happened to a record between two versions of a zone
+type ChangeKind int
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed // its TTL or its values changed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// A difference between two versions of a zone, as found by Diff
+type Change struct {
+	Kind ChangeKind
+	Old  *Record // the record in the old zone, nil if it was added
+	New  *Record // the record in the new zone, nil if it was removed
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return "+ " + c.New.String()
+	case Removed:
+		return "- " + c.Old.String()
+	}
+	return "~ " + c.Old.String() + " => " + c.New.String()
+}
+
+// Returns the records that differ between two versions of a zone.  Both
+// zonefiles are resolved as by Records, so that $ORIGIN, $TTL and
+// inherited owners are taken into account and differences in formatting,
+// comments, case of names and relative or absolute names are not.
+//
+// A record whose TTL changed is reported as Changed.  So is a record
+// whose values changed, if it's the only one that changed in its RRset;
+// otherwise its old and new version are reported as Removed and Added.
+// The records of the changes point to the entries in the zonefiles.  The
+// changes are ordered by owner, in the canonical order of RFC 4034, and
+// then by type.
+//
+// The zonefiles must start with $ORIGIN; use DiffOrigin otherwise.
+func Diff(a, b *Zonefile) ([]Change, error) {
+	return DiffOrigin(a, b, "")
+}
+
+// Like Diff, but resolves the zonefiles with the given origin, as Records.
+func DiffOrigin(a, b *Zonefile, origin string) ([]Change, error) {
+	oldRecords, err := a.Records(origin)
+	if err != nil {
+		return nil, err
+	}
+	newRecords, err := b.Records(origin)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	oldIndex := indexRecords(oldRecords)
+	newIndex := indexRecords(newRecords)
+	removed := make(map[rrsetKey][]*Record)
+	added := make(map[rrsetKey][]*Record)
+	var rrsets []rrsetKey // in the order in which we came across them
+
+	for _, r := range uniqueRecords(oldRecords) {
+		k := recordKeyOf(r)
+		if n, ok := newIndex[k]; ok {
+			if n.TTL != r.TTL {
+				changes = append(changes, Change{Changed, r, n})
+			}
+			continue
+		}
+		if removed[k.rrsetKey] == nil && added[k.rrsetKey] == nil {
+			rrsets = append(rrsets, k.rrsetKey)
+		}
+		removed[k.rrsetKey] = append(removed[k.rrsetKey], r)
+	}
+	for _, r := range uniqueRecords(newRecords) {
+		k := recordKeyOf(r)
+		if _, ok := oldIndex[k]; ok {
+			continue
+		}
+		if removed[k.rrsetKey] == nil && added[k.rrsetKey] == nil {
+			rrsets = append(rrsets, k.rrsetKey)
+		}
+		added[k.rrsetKey] = append(added[k.rrsetKey], r)
+	}
+
+	for _, k := range rrsets {
+		rs, as := removed[k], added[k]
+		if len(rs) == 1 && len(as) == 1 {
+			changes = append(changes, Change{Changed, rs[0], as[0]})
+			continue
+		}
+		for _, r := range rs {
+			changes = append(changes, Change{Kind: Removed, Old: r})
+		}
+		for _, r := range as {
+			changes = append(changes, Change{Kind: Added, New: r})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].less(changes[j])
+	})
+	return changes, nil
+}
+
+// The record a change is about: the new one, unless it was removed
+func (c Change) record() *Record {
+	if c.New != nil {
+		return c.New
+	}
+	return c.Old
+}
+
+// Orders changes by owner, type and kind: removals before additions
+func (c Change) less(d Change) bool {
+	a, b := c.record(), d.record()
+	if cmp := compareNames(a.Name, b.Name); cmp != 0 {
+		return cmp < 0
+	}
+	if a.Type != b.Type {
+		return typeOrder(a.Type) < typeOrder(b.Type)
+	}
+	return c.Kind > d.Kind
+}
+
+// Orders types by their code; unknown types come last
+func typeOrder(typ string) int {
+	if code, ok := typeCode(typ); ok {
+		return int(code)
+	}
+	return 1 << 16
+}
+
+// Identifies a record by its owner, class, type and values
+type recordKey struct {
+	rrsetKey
+	rdata string
+}
+
+func recordKeyOf(r *Record) recordKey {
+	name, err := wire.CanonicalName(r.Name)
+	if err != nil {
+		name = r.Name
+	}
+	return recordKey{
+		rrsetKey{name, strings.ToUpper(r.Class), r.Type},
+		strings.Join(r.rdata, " "),
+	}
+}
+
+// Returns the records by their key.  Of duplicate records, the first
+// is kept.
+func indexRecords(records []Record) map[recordKey]*Record {
+	index := make(map[recordKey]*Record)
+	for i := range records {
+		k := recordKeyOf(&records[i])
+		if _, ok := index[k]; !ok {
+			index[k] = &records[i]
+		}
+	}
+	return index
+}
+
+// Returns pointers to the records, leaving out duplicates
+func uniqueRecords(records []Record) (r []*Record) {
+	seen := make(map[recordKey]bool)
+	for i := range records {
+		k := recordKeyOf(&records[i])
+		if !seen[k] {
+			seen[k] = true
+			r = append(r, &records[i])
+		}
+	}
+	return
+}
@@ -0,0 +1,121 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func ExampleDiff() {
+	a, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1     A   1.2.3.4
+www     A   1.2.3.4
+        A   1.2.3.5`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	b, err := zonefile.Load([]byte(`$ORIGIN example.com.
+example.com. 1h IN SOA ns1 hostmaster 2 3600 600 604800 60
+example.com. 1h IN NS  ns1.example.com.
+NS1.example.com. 1h A 1.2.3.4 ; the same
+www.example.com. 1h A 1.2.3.4
+mail.example.com. 1h A 1.2.3.6`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	changes, err2 := zonefile.Diff(a, b)
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	// Output:
+	// ~ example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 604800 60 => example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2 3600 600 604800 60
+	// + mail.example.com. 3600 IN A 1.2.3.6
+	// - www.example.com. 3600 IN A 1.2.3.5
+}
+
+func TestDiff(t *testing.T) {
+	a, err := zonefile.Load([]byte(
+		"$ORIGIN example.com.\n" +
+			"$TTL 60\n" +
+			"a A 1.2.3.4\n" +
+			"b A 1.2.3.4\n" +
+			"  A 1.2.3.5\n" +
+			"c TXT \"hello\"\n" +
+			"d MX 10 mail\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := zonefile.Load([]byte(
+		"$ORIGIN example.com.\n" +
+			"a 120 A 1.2.3.4\n" +
+			"b 60 A 1.2.3.6\n" +
+			"b 60 A 1.2.3.7\n" +
+			"c 60 TXT hello\n" +
+			"$ORIGIN com.\n" +
+			"d.example 60 MX 10 mail.example.com.\n" +
+			"d.example 60 MX 10 mail.example.com.\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err2 := zonefile.Diff(a, b)
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	expected := []struct {
+		kind         zonefile.ChangeKind
+		name         string
+		oldLn, newLn int
+	}{
+		{zonefile.Changed, "a.example.com.", 2, 1},
+		{zonefile.Removed, "b.example.com.", 3, -1},
+		{zonefile.Removed, "b.example.com.", 4, -1},
+		{zonefile.Added, "b.example.com.", -1, 2},
+		{zonefile.Added, "b.example.com.", -1, 3},
+	}
+	if len(changes) != len(expected) {
+		t.Fatal("Unexpected changes:", changes)
+	}
+	for i, c := range changes {
+		e := expected[i]
+		oldLn, newLn := -1, -1
+		if c.Old != nil {
+			oldLn = c.Old.Entry.LineNo()
+		}
+		if c.New != nil {
+			newLn = c.New.Entry.LineNo()
+		}
+		if c.Kind != e.kind || oldLn != e.oldLn || newLn != e.newLn {
+			t.Fatalf("Unexpected change %d: %v (%d, %d)", i, c, oldLn, newLn)
+		}
+	}
+}
+
+func TestDiffOrigin(t *testing.T) {
+	a, err := zonefile.Load([]byte("www 60 A 1.2.3.4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := zonefile.Load([]byte("www.example.com. 60 A 1.2.3.4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zonefile.Diff(a, b); err == nil {
+		t.Fatal("Expected an error for a relative name without origin")
+	}
+	changes, err2 := zonefile.DiffOrigin(a, b, "example.com.")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if len(changes) != 0 {
+		t.Fatal("Unexpected changes:", changes)
+	}
+}
@@ -0,0 +1,136 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// List the control entries ($ORIGIN, $TTL and $INCLUDE) in the zonefile
+func (z *Zonefile) Directives() (r []Entry) {
+	for _, e := range z.entries {
+		if e.isControl {
+			r = append(r, e)
+		}
+	}
+	return
+}
+
+// Sets the default TTL of the zonefile.  If there is a $TTL entry before
+// the first record, its value is changed.  Otherwise a new $TTL entry is
+// inserted just before the first record.
+func (z *Zonefile) SetDefaultTTL(ttl int) (*Entry, error) {
+	if ttl < 0 || ttl > maxTTL {
+		return nil, errors.New("TTL out of range")
+	}
+	v := []byte(strconv.Itoa(ttl))
+	iRecord := z.firstRecord()
+	if i := z.findDirective("$TTL", 0, iRecord); i != -1 {
+		z.entries[i].SetValue(0, v)
+		return &z.entries[i], nil
+	}
+	return z.insertEntry(iRecord, newControlEntry("$TTL", v)), nil
+}
+
+// Sets the origin of the zonefile.  If there is an $ORIGIN entry before
+// the first record, its value is changed.  Otherwise a new $ORIGIN entry
+// is inserted at the top of the zonefile.
+func (z *Zonefile) SetOrigin(origin string) (*Entry, error) {
+	if len(origin) == 0 {
+		return nil, errors.New("origin must be non-empty")
+	}
+	if i := z.findDirective("$ORIGIN", 0, z.firstRecord()); i != -1 {
+		z.entries[i].SetValue(0, []byte(origin))
+		return &z.entries[i], nil
+	}
+	return z.insertEntry(0, newControlEntry("$ORIGIN", []byte(origin))), nil
+}
+
+// Adds an $INCLUDE entry for the given path.  The origin is optional.
+//
+// The entry is added at the end of the zonefile.  If no origin is given
+// and the origin is changed somewhere after the first record, the entry
+// is inserted before that change, so that the included file is read
+// with the origin of the zone.
+func (z *Zonefile) AddInclude(path, origin string) (*Entry, error) {
+	if len(path) == 0 {
+		return nil, errors.New("path must be non-empty")
+	}
+	values := [][]byte{[]byte(path)}
+	if len(origin) != 0 {
+		values = append(values, []byte(origin))
+	}
+	e := newControlEntry("$INCLUDE", values...)
+	if len(origin) == 0 {
+		i := z.findDirective("$ORIGIN", z.firstRecord(), len(z.entries))
+		if i != -1 {
+			return z.insertEntry(i, e), nil
+		}
+	}
+	return z.AddEntry(e), nil
+}
+
+// The largest TTL allowed by RFC 2181
+const maxTTL = 1<<31 - 1
+
+// Returns the index of the first entry that is not a control entry,
+// or the number of entries if there is none.
+func (z *Zonefile) firstRecord() int {
+	for i, e := range z.entries {
+		if !e.isControl {
+			return i
+		}
+	}
+	return len(z.entries)
+}
+
+// Returns the index of the first control entry with the given command
+// among the entries in [start, end), or -1 if there is none.
+func (z *Zonefile) findDirective(cmd string, start, end int) int {
+	for i := start; i < end && i < len(z.entries); i++ {
+		if bytes.Equal(z.entries[i].Command(), []byte(cmd)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Creates a new control entry, which ends on a newline
+func newControlEntry(cmd string, values ...[]byte) (e Entry) {
+	tCmd := tttControl
+	tCmd.t.val = []byte(cmd)
+	e.isControl = true
+	e.tokens = []taggedToken{tCmd}
+	for _, v := range values {
+		tValue := tttValue
+		tValue.t.SetValue(v)
+		e.tokens = append(e.tokens, tttSpace, tValue)
+	}
+	e.tokens = append(e.tokens, tttNewline)
+	return
+}
+
+// Inserts the entry before the ith entry.  Comments and empty lines
+// directly above the ith entry stay with it, except for those above the
+// first entry: these are the header of the zonefile and stay on top.
+func (z *Zonefile) insertEntry(i int, e Entry) *Entry {
+	if i >= len(z.entries) {
+		return z.AddEntry(e)
+	}
+	if !e.endsOnNewline() {
+		e.tokens = append(e.tokens, tttNewline)
+	}
+	if i == 0 {
+		first := &z.entries[0]
+		iStart := first.startOfLine()
+		e.tokens = append(append([]taggedToken{}, first.tokens[:iStart]...),
+			e.tokens...)
+		first.tokens = first.tokens[iStart:]
+	}
+	e.zf = z
+	z.entries = append(z.entries, Entry{})
+	copy(z.entries[i+1:], z.entries[i:])
+	z.entries[i] = e
+	z.count(&z.entries[i], 1)
+	return &z.entries[i]
+}
@@ -0,0 +1,88 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func TestSetDefaultTTL(t *testing.T) {
+	zf, err := zonefile.Load([]byte("; header\n\n$ORIGIN example.com.\n" +
+		"; the apex\n@ IN A 1.2.3.4\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	if _, err := zf.SetDefaultTTL(3600); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; header\n\n$ORIGIN example.com.\n$TTL 3600\n" +
+		"; the apex\n@ IN A 1.2.3.4\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Adding $TTL failed: %q", zf.Save())
+	}
+	zf.SetDefaultTTL(60)
+	expected = "; header\n\n$ORIGIN example.com.\n$TTL 60\n" +
+		"; the apex\n@ IN A 1.2.3.4\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Changing $TTL failed: %q", zf.Save())
+	}
+	if _, err := zf.SetDefaultTTL(-1); err == nil {
+		t.Fatal("Negative TTL should not be allowed")
+	}
+}
+
+func TestSetOrigin(t *testing.T) {
+	zf, err := zonefile.Load([]byte("; header\n$TTL 60\n@ IN A 1.2.3.4\n" +
+		"$ORIGIN sub.example.com.\nwww IN A 1.2.3.4"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	zf.SetOrigin("example.com.")
+	expected := "; header\n$ORIGIN example.com.\n$TTL 60\n@ IN A 1.2.3.4\n" +
+		"$ORIGIN sub.example.com.\nwww IN A 1.2.3.4"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Adding $ORIGIN failed: %q", zf.Save())
+	}
+	zf.SetOrigin("example.org.")
+	expected = "; header\n$ORIGIN example.org.\n$TTL 60\n@ IN A 1.2.3.4\n" +
+		"$ORIGIN sub.example.com.\nwww IN A 1.2.3.4"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Changing $ORIGIN failed: %q", zf.Save())
+	}
+}
+
+func TestAddInclude(t *testing.T) {
+	zf, err := zonefile.Load([]byte("@ IN A 1.2.3.4\n" +
+		"$ORIGIN sub.example.com.\nwww IN A 1.2.3.4"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	zf.AddInclude("keys.zone", "")
+	zf.AddInclude("sub.zone", "sub2.example.com.")
+	expected := "@ IN A 1.2.3.4\n$INCLUDE keys.zone\n" +
+		"$ORIGIN sub.example.com.\nwww IN A 1.2.3.4\n" +
+		"$INCLUDE sub.zone sub2.example.com.\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Adding $INCLUDE failed: %q", zf.Save())
+	}
+}
+
+func ExampleZonefile_Directives() {
+	zf, _ := zonefile.Load([]byte("$ORIGIN example.com.\n$TTL 3600\n" +
+		"@ IN A 1.2.3.4\n$INCLUDE keys.zone\n"))
+	for _, e := range zf.Directives() {
+		fmt.Println(e)
+	}
+	// Output: <Entry cmd="$ORIGIN" ["example.com."]>
+	// <Entry cmd="$TTL" ["3600"]>
+	// <Entry cmd="$INCLUDE" ["keys.zone"]>
+}
+
+func ExampleZonefile_SetDefaultTTL() {
+	zf, _ := zonefile.Load([]byte("$ORIGIN example.com.\n@ IN A 1.2.3.4\n"))
+	zf.SetDefaultTTL(3600)
+	fmt.Print(string(zf.Save()))
+	// Output: $ORIGIN example.com.
+	// $TTL 3600
+	// @ IN A 1.2.3.4
+}
@@ -0,0 +1,363 @@
+package zonefile
+
+import (
+	"bytes"
+	"strings"
+)
+
+// How Format writes the owner names of entries
+type OwnerStyle int
+
+const (
+	// Leave owner names as they are
+	OwnerKeep OwnerStyle = iota
+
+	// Write owner names relative to the origin, where possible
+	OwnerRelative
+
+	// Write owner names as absolute names
+	OwnerAbsolute
+)
+
+// Options for Format
+type FormatOptions struct {
+	// How to write owner names.  Owner names can only be rewritten
+	// when the origin is known.
+	Owners OwnerStyle
+
+	// Write the origin itself as "@" instead of as its absolute name.
+	// Ignored when Owners is OwnerKeep.
+	UseAt bool
+
+	// Write out owner names inherited from the previous entry, instead
+	// of leaving them blank.
+	RepeatOwners bool
+
+	// Align columns using tabs instead of spaces
+	UseTabs bool
+
+	// The origin to assume before the first $ORIGIN entry
+	Origin string
+}
+
+// Formats the zonefile: the owner, TTL, class, type and values of records
+// are aligned in columns; owner names are written consistently; and
+// whitespace and parentheses are normalised.  All comments are kept
+// with the entry they belong to.
+//
+// Parentheses are only kept around values that are commented on
+// separate lines, as in the usual layout of an SOA record.
+func Format(z *Zonefile, opts FormatOptions) []byte {
+	f := formatter{opts: opts, origin: opts.Origin}
+	var entries []fmtEntry
+	for _, e := range z.entries {
+		entries = append(entries, f.analyze(e))
+	}
+	f.computeWidths(entries)
+
+	for _, fe := range entries {
+		f.render(fe)
+	}
+	f.addPrefix(z.suffix)
+	return f.output()
+}
+
+// A line of output, which consists of code and a comment after it
+type fmtLine struct {
+	code    string
+	comment string
+}
+
+// The parts of an entry that are relevant for formatting
+type fmtEntry struct {
+	prefix  []fmtLine // comments and empty lines above the entry
+	control bool
+
+	// owner, TTL, class and type of a record; or command of a control entry
+	fields [4]string
+
+	// values and comments of each line of the entry (after the type)
+	values   [][]string
+	comments []string
+}
+
+const (
+	colOwner = iota
+	colTTL
+	colClass
+	colType
+)
+
+type formatter struct {
+	opts       FormatOptions
+	origin     string // current origin, or "" if unknown
+	lastOwner  string // owner of the last record ...
+	lastOrigin string // ... relative to this origin
+	widths     [4]int
+	lines      []fmtLine
+}
+
+// Splits the entry into its fields, values and comments and rewrites the
+// owner name as requested.
+func (f *formatter) analyze(e Entry) (fe fmtEntry) {
+	iStart := e.startOfLine()
+	fe.prefix = prefixLines(e.tokens[:iStart])
+	fe.control = e.isControl
+	fe.values = [][]string{nil}
+	fe.comments = []string{""}
+	line := 0
+	for _, tt := range e.tokens[iStart:] {
+		switch {
+		case tt.u == useControl:
+			fe.fields[0] = string(tt.t.val)
+		case tt.u == useDomain:
+			fe.fields[colOwner] = string(tt.t.val)
+		case tt.u == useTTL:
+			fe.fields[colTTL] = string(tt.t.val)
+		case tt.u == useClass:
+			fe.fields[colClass] = string(tt.t.val)
+		case tt.u == useType:
+			fe.fields[colType] = string(tt.t.val)
+		case tt.u == useValue:
+			fe.values[line] = append(fe.values[line], string(tt.t.val))
+		case tt.t.typ == tokenComment:
+			fe.comments[line] = strings.TrimRight(string(tt.t.val), " \t")
+		case tt.t.typ == tokenWhiteSpace &&
+			bytes.IndexAny(tt.t.val, "\r\n") != -1:
+			fe.values = append(fe.values, nil)
+			fe.comments = append(fe.comments, "")
+			line++
+		}
+	}
+
+	if fe.control {
+		if fe.fields[0] == "$ORIGIN" && len(fe.values[0]) > 0 {
+			f.origin = absoluteName(fe.values[0][0], f.origin)
+		}
+		return
+	}
+
+	owner := fe.fields[colOwner]
+	if owner == "" {
+		if !f.opts.RepeatOwners || f.lastOwner == "" {
+			return
+		}
+		owner = f.lastOwner
+		if f.origin != f.lastOrigin {
+			owner = absoluteName(owner, f.lastOrigin)
+		}
+	}
+	f.lastOwner, f.lastOrigin = owner, f.origin
+	fe.fields[colOwner] = f.ownerName(owner)
+	return
+}
+
+// Writes the owner name in the requested style
+func (f *formatter) ownerName(name string) string {
+	if f.origin == "" || f.opts.Owners == OwnerKeep {
+		return name
+	}
+	name = absoluteName(name, f.origin)
+	if f.opts.Owners == OwnerRelative {
+		name = relativeName(name, f.origin)
+	}
+	if name == "@" || equalNames(name, f.origin) {
+		if f.opts.UseAt {
+			return "@"
+		}
+		return f.origin
+	}
+	return name
+}
+
+// Converts the comments and empty lines above an entry into lines
+func prefixLines(tokens []taggedToken) (r []fmtLine) {
+	var cur fmtLine
+	for _, tt := range tokens {
+		switch tt.t.typ {
+		case tokenComment:
+			cur.comment = strings.TrimRight(string(tt.t.val), " \t")
+		case tokenNewline:
+			r = append(r, cur)
+			cur = fmtLine{}
+		}
+	}
+	if cur.comment != "" {
+		r = append(r, cur)
+	}
+	return
+}
+
+// Computes the width of the owner, TTL, class and type columns
+func (f *formatter) computeWidths(entries []fmtEntry) {
+	for _, fe := range entries {
+		if fe.control {
+			continue
+		}
+		for i, field := range fe.fields {
+			if len(field) > f.widths[i] {
+				f.widths[i] = len(field)
+			}
+		}
+	}
+	for i := range f.widths {
+		// Empty columns are left out, except for the owner column: we
+		// need whitespace at the start of the line for a blank owner.
+		if f.widths[i] == 0 && i != colOwner {
+			continue
+		}
+		f.widths[i] = f.columnWidth(f.widths[i])
+	}
+}
+
+// Returns the width of a column that holds fields of at most n characters
+func (f *formatter) columnWidth(n int) int {
+	if f.opts.UseTabs {
+		return (n/tabWidth + 1) * tabWidth
+	}
+	return n + 1
+}
+
+// Pads s with spaces or tabs until it is width characters wide.
+func (f *formatter) pad(s string, width int) string {
+	return s + padding(displayWidth(s), width, f.opts.UseTabs)
+}
+
+// Adds the lines of a formatted entry to the output
+func (f *formatter) render(fe fmtEntry) {
+	f.lines = append(f.lines, fe.prefix...)
+
+	if fe.control {
+		code := fe.fields[0]
+		var comments []string
+		for i, vs := range fe.values {
+			if len(vs) > 0 {
+				code += " " + strings.Join(vs, " ")
+			}
+			if fe.comments[i] != "" {
+				comments = append(comments, fe.comments[i])
+			}
+		}
+		f.lines = append(f.lines, fmtLine{code, strings.Join(comments, " ")})
+		return
+	}
+
+	var code string
+	for i, field := range fe.fields {
+		code += f.pad(field, f.widths[i])
+	}
+	indent := f.pad("", displayWidth(code))
+
+	// Only keep values on separate lines if there are comments in between
+	multiline := false
+	for i := 0; i < len(fe.comments)-1; i++ {
+		if fe.comments[i] != "" {
+			multiline = true
+		}
+	}
+
+	if !multiline {
+		var values []string
+		var comments []string
+		for i, vs := range fe.values {
+			values = append(values, vs...)
+			if fe.comments[i] != "" {
+				comments = append(comments, fe.comments[i])
+			}
+		}
+		f.lines = append(f.lines, fmtLine{
+			code + strings.Join(values, " "),
+			strings.Join(comments, " ")})
+		return
+	}
+
+	iLast := 0
+	for i, vs := range fe.values {
+		if len(vs) > 0 {
+			iLast = i
+		}
+	}
+	for i, vs := range fe.values {
+		if len(vs) == 0 && fe.comments[i] == "" && i != 0 {
+			continue
+		}
+		line := append([]string{}, vs...)
+		if i == 0 {
+			line = append(line, "(")
+		}
+		if i == iLast {
+			line = append(line, ")")
+		}
+		if i == 0 {
+			f.lines = append(f.lines, fmtLine{
+				code + strings.Join(line, " "), fe.comments[i]})
+			continue
+		}
+		f.lines = append(f.lines, fmtLine{
+			indent + strings.Join(line, " "), fe.comments[i]})
+	}
+}
+
+// Adds comments and empty lines that are not part of an entry
+func (f *formatter) addPrefix(tokens []token) {
+	var tagged []taggedToken
+	for _, t := range tokens {
+		tagged = append(tagged, taggedToken{t, useOther})
+	}
+	f.lines = append(f.lines, prefixLines(tagged)...)
+}
+
+// Aligns trailing comments, squashes runs of empty lines and writes out
+// the result.
+func (f *formatter) output() []byte {
+	// Align comments on consecutive lines that have both code and a comment
+	for i := 0; i < len(f.lines); {
+		if f.lines[i].code == "" || f.lines[i].comment == "" {
+			i++
+			continue
+		}
+		j := i
+		width := 0
+		for ; j < len(f.lines) &&
+			f.lines[j].code != "" && f.lines[j].comment != ""; j++ {
+			if w := displayWidth(f.lines[j].code); w > width {
+				width = w
+			}
+		}
+		width = f.columnWidth(width)
+		for ; i < j; i++ {
+			f.lines[i].code = f.pad(f.lines[i].code, width)
+		}
+	}
+
+	var buf bytes.Buffer
+	empty := true // whether the last line was empty
+	for i, line := range f.lines {
+		if line.code == "" && line.comment == "" {
+			if empty {
+				continue
+			}
+			empty = true
+			// Drop empty lines at the end of the file
+			trailing := true
+			for _, l := range f.lines[i+1:] {
+				if l.code != "" || l.comment != "" {
+					trailing = false
+					break
+				}
+			}
+			if !trailing {
+				buf.WriteByte('\n')
+			}
+			continue
+		}
+		empty = false
+		if line.comment == "" {
+			buf.WriteString(strings.TrimRight(line.code, " \t"))
+		} else {
+			buf.WriteString(line.code + line.comment)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
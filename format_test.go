@@ -0,0 +1,89 @@
+package zonefile_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+// Formatting a formatted zonefile shouldn't do anything
+func TestFormatIdempotent(t *testing.T) {
+	for _, opts := range []zonefile.FormatOptions{
+		{},
+		{Owners: zonefile.OwnerRelative, UseAt: true},
+		{Owners: zonefile.OwnerAbsolute, RepeatOwners: true, UseTabs: true},
+	} {
+		for i, test := range tests {
+			z, e := zonefile.Load([]byte(test))
+			if e != nil {
+				t.Fatal(i, "error loading:", e.LineNo(), e)
+			}
+			formatted := zonefile.Format(z, opts)
+			z2, e := zonefile.Load(formatted)
+			if e != nil {
+				t.Fatal(i, "error loading formatted zonefile:", e.LineNo(), e)
+			}
+			if !bytes.Equal(zonefile.Format(z2, opts), formatted) {
+				t.Fatalf("%d: Format o Format != Format:\n%s", i, formatted)
+			}
+			if len(z2.Entries()) != len(z.Entries()) {
+				t.Fatal(i, "Format changed the number of entries")
+			}
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	z, err := zonefile.Load([]byte(`; header
+$ORIGIN example.com.
+example.com.  IN  SOA   ns  hostmaster (
+   1 ; serial
+   2 3 4 5 )
+
+
+; nameservers
+@ IN  NS ns.example.com.
+ NS ns.example.org.
+www.example.com. 300 A 1.2.3.4 ; www
+mail 3600 IN MX ( 10
+  mx )   ; mail
+`))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	expected := `; header
+$ORIGIN example.com.
+@         IN SOA ns hostmaster (
+                 1 ; serial
+                 2 3 4 5 )
+
+; nameservers
+@         IN NS  ns.example.com.
+             NS  ns.example.org.
+www  300     A   1.2.3.4 ; www
+mail 3600 IN MX  10 mx   ; mail
+`
+	formatted := zonefile.Format(z, zonefile.FormatOptions{
+		Owners: zonefile.OwnerRelative,
+		UseAt:  true,
+	})
+	if string(formatted) != expected {
+		t.Fatalf("Unexpected formatting:\n%s", formatted)
+	}
+}
+
+func ExampleFormat() {
+	z, _ := zonefile.Load([]byte(`$ORIGIN example.com.
+example.com. IN SOA ns hostmaster 1 2 3 4 5
+  IN NS ns ; our only nameserver
+www.example.com. 300 IN A 1.2.3.4`))
+	fmt.Print(string(zonefile.Format(z, zonefile.FormatOptions{
+		Owners: zonefile.OwnerRelative,
+		UseAt:  true,
+	})))
+	// Output: $ORIGIN example.com.
+	// @       IN SOA ns hostmaster 1 2 3 4 5
+	//         IN NS  ns ; our only nameserver
+	// www 300 IN A   1.2.3.4
+}
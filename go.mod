@@ -1 +1,3 @@
 module github.com/bwesterb/go-zonefile
+
+go 1.21
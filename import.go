@@ -0,0 +1,87 @@
+package zonefile
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Returns a record as a line of a zonefile with the given origin, with
+// names relative to it where possible.  The TTL may be nil.
+func recordLine(origin, name string, ttl *int, class, typ string,
+	values []string) string {
+	values = append([]string{}, values...)
+	kinds := rdataFields[typ]
+	for i, v := range values {
+		if i < len(kinds) && kinds[i] == fieldName {
+			values[i] = relativeName(v, origin)
+		}
+	}
+	fields := []string{relativeName(name, origin)}
+	if ttl != nil {
+		fields = append(fields, strconv.Itoa(*ttl))
+	}
+	fields = append(fields, class, typ)
+	return strings.Join(append(fields, values...), " ")
+}
+
+// Creates a zonefile that starts with $ORIGIN, unless the origin is
+// empty, followed by the lines, formatted as by Format.  The line numbers
+// of parsing errors are those of the lines, counting from 0.
+func formattedZonefile(origin string, lines []string) (*Zonefile,
+	ParsingError) {
+	var b bytes.Buffer
+	if origin != "" {
+		fmt.Fprintf(&b, "$ORIGIN %s\n", origin)
+	}
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	z, perr := Load(b.Bytes())
+	if perr != nil {
+		lineno := perr.LineNo()
+		if origin != "" {
+			lineno--
+		}
+		return nil, parsingError{perr.Error(), lineno, perr.ColNo(), ""}
+	}
+	return Load(Format(z, FormatOptions{Owners: OwnerRelative,
+		UseAt: true}))
+}
+
+// Returns the number of items of a value, or of several values separated
+// by spaces, as it would be written in a zonefile.  Returns an error if
+// the value would end the entry or carry it onto the next lines, as a
+// line break, parenthesis or comment would.
+func valueItems(v string) (n int, err error) {
+	for t := range lex([]byte(v)).tokens {
+		switch t.typ {
+		case tokenItem, tokenQuotedItem:
+			n++
+		case tokenWhiteSpace, tokenEOF:
+		default:
+			if err == nil {
+				err = fmt.Errorf("invalid value %q", v)
+			}
+		}
+	}
+	return n, err
+}
+
+// Checks that the name is a single item in a zonefile
+func checkName(name string) error {
+	if n, err := valueItems(name); err != nil || n != 1 {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
+
+// Checks that the value of a field is a single item in a zonefile
+func checkItem(v string) error {
+	if n, err := valueItems(v); err != nil || n != 1 {
+		return fmt.Errorf("invalid value %q", v)
+	}
+	return nil
+}
@@ -1,68 +1,279 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"flag"
 	"fmt"
 	"github.com/bwesterb/go-zonefile"
-	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+const usage = `Usage: %s [flags] <path to zonefile> ...
+
+Changes the serial in the SOA record of each zonefile.  If a zonefile has no
+SOA record, the files it includes with $INCLUDE are searched for it.
+
+Flags:
+`
+
+const exitCodes = `
+Exit status:
+  0  all serials were changed, or were left alone because of --if-changed
+  1  wrong usage
+  2  could not read or parse a zonefile
+  3  could not change a serial: there is no SOA record, the serial is
+     invalid or the new serial would not be greater than the old one
+  4  could not write a zonefile
+  5  a secondary didn't acknowledge the NOTIFY message
+
+Every zonefile is done, even if an earlier one fails.  Each failure is
+reported, and the exit status is the highest of those of the failures.
+`
+
+const (
+	exitUsage  = 1
+	exitRead   = 2
+	exitBump   = 3
+	exitWrite  = 4
+	exitNotify = 5
+)
+
+// What to do with each zonefile, as set by the flags
+type options struct {
+	strategy  zonefile.SerialStrategy
+	dryRun    bool
+	ifChanged string
+	origin    string
+	notify    bool
+	servers   []string
+}
+
 // Increments the serial of a zonefile
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage:", os.Args[0], "<path to zonefile>")
-		os.Exit(1)
+	strategyFlag := flag.String("strategy", "increment",
+		"how to change the serial: increment, date (YYYYMMDDnn), "+
+			"unixtime or set:N")
+	dryRun := flag.Bool("dry-run", false,
+		"only print the old and new serials; don't change any file")
+	ifChanged := flag.String("if-changed", "",
+		"only change the serial if the records differ from those in this "+
+			"old version of the zonefile, or, if it is a directory, in the "+
+			"file with the same name in it")
+	origin := flag.String("origin", "",
+		"origin of the zone, used to compare records with --if-changed "+
+			"and to find the secondaries with --notify")
+	notify := flag.Bool("notify", false,
+		"send a NOTIFY message to the secondaries after changing a serial: "+
+			"the nameservers in the NS records other than the primary")
+	notifyServers := flag.String("notify-servers", "",
+		"comma-separated list of servers to send a NOTIFY message to "+
+			"instead; implies --notify")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, exitCodes)
 	}
+	flag.Parse()
 
-	// Load zonefile
-	data, ioerr := ioutil.ReadFile(os.Args[1])
-	if ioerr != nil {
-		fmt.Println(os.Args[1], ioerr)
-		os.Exit(2)
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	strategy, err := parseStrategy(*strategyFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
 	}
 
-	zf, perr := zonefile.Load(data)
-	if perr != nil {
-		fmt.Println(os.Args[1], perr.LineNo(), perr)
-		os.Exit(3)
+	var servers []string
+	if *notifyServers != "" {
+		*notify = true
+		servers = strings.Split(*notifyServers, ",")
 	}
 
-	// Find SOA entry
-	ok := false
-	for _, e := range zf.Entries() {
-		if !bytes.Equal(e.Type(), []byte("SOA")) {
-			continue
+	opts := options{strategy: strategy, dryRun: *dryRun,
+		ifChanged: *ifChanged, origin: *origin, notify: *notify,
+		servers: servers}
+	status := 0
+	for _, path := range flag.Args() {
+		if s := bump(path, opts); s > status {
+			status = s
 		}
-		vs := e.Values()
-		if len(vs) != 7 {
-			fmt.Println("Wrong number of parameters to SOA line")
-			os.Exit(4)
+	}
+	os.Exit(status)
+}
+
+// Changes the serial of the zonefile at the path and reports what went
+// wrong, if anything.  Returns the exit status for it: 0 if it went well.
+func bump(path string, opts options) int {
+	zf, err := zonefile.LoadFile(path)
+	if err != nil {
+		printError(path, err)
+		return exitRead
+	}
+
+	if opts.ifChanged != "" {
+		oldPath := opts.ifChanged
+		if info, err := os.Stat(oldPath); err == nil && info.IsDir() {
+			oldPath = filepath.Join(oldPath, filepath.Base(path))
+		}
+		changed, err := recordsChanged(oldPath, zf, opts.origin)
+		if err != nil {
+			printError(oldPath, err)
+			return exitRead
 		}
-		serial, err := strconv.Atoi(string(vs[2]))
+		if !changed {
+			if opts.dryRun {
+				fmt.Println(path + ": unchanged")
+			}
+			return 0
+		}
+	}
+
+	// Find the zonefile with the SOA entry
+	soaFile, err := findSOA(zf, 0)
+	if err != nil {
+		printError(path, err)
+		return exitRead
+	}
+	if soaFile == nil {
+		fmt.Fprintln(os.Stderr, path+": could not find SOA entry")
+		return exitBump
+	}
+
+	old, new, err := soaFile.BumpSerial(opts.strategy)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v (%v -> %v)\n",
+			soaFile.Path(), err, old, new)
+		return exitBump
+	}
+	if opts.dryRun {
+		fmt.Printf("%s: %v -> %v\n", soaFile.Path(), old, new)
+		return 0
+	}
+
+	if err := soaFile.SaveFile(soaFile.Path()); err != nil {
+		printError(soaFile.Path(), err)
+		return exitWrite
+	}
+
+	if opts.notify {
+		err := zonefile.SendNotify(context.Background(), zf,
+			zonefile.NotifyOptions{Origin: opts.origin, Servers: opts.servers})
 		if err != nil {
-			fmt.Println("Could not parse serial:", err)
-			os.Exit(5)
+			printError(path, err)
+			return exitNotify
 		}
-		e.SetValue(2, []byte(strconv.Itoa(serial+1)))
-		ok = true
-		break
 	}
-	if !ok {
-		fmt.Println("Could not find SOA entry")
-		os.Exit(6)
+	return 0
+}
+
+// Parses the value of the --strategy flag
+func parseStrategy(s string) (zonefile.SerialStrategy, error) {
+	switch {
+	case s == "increment":
+		return zonefile.IncrementSerial, nil
+	case s == "date":
+		return zonefile.DateSerial(time.Now().UTC()), nil
+	case s == "unixtime":
+		return zonefile.UnixTimeSerial(time.Now()), nil
+	case strings.HasPrefix(s, "set:"):
+		serial, err := zonefile.ParseSerial([]byte(s[4:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid serial %q", s[4:])
+		}
+		return zonefile.SetSerial(serial), nil
 	}
+	return nil, fmt.Errorf("unknown strategy %q", s)
+}
 
-	fh, err := os.OpenFile(os.Args[1], os.O_WRONLY, 0)
+// Returns the zonefile that contains the SOA entry, which is either zf
+// or one of the files it includes.
+func findSOA(zf *zonefile.Zonefile, depth int) (*zonefile.Zonefile, error) {
+	if zf.SOA() != nil {
+		return zf, nil
+	}
+	if depth > 16 {
+		return nil, fmt.Errorf("too many nested $INCLUDEs")
+	}
+	incs, err := zf.Includes()
 	if err != nil {
-		fmt.Println(os.Args[1], err)
-		os.Exit(7)
+		return nil, err
+	}
+	for _, inc := range incs {
+		soaFile, err := findSOA(inc, depth+1)
+		if soaFile != nil || err != nil {
+			return soaFile, err
+		}
 	}
+	return nil, nil
+}
 
-	_, err = fh.Write(zf.Save())
+// Checks whether the records in the zonefile differ from those in the
+// zonefile at oldPath.  The serial is not taken into account.
+func recordsChanged(oldPath string, zf *zonefile.Zonefile,
+	origin string) (bool, error) {
+	old, err := zonefile.LoadFile(oldPath)
 	if err != nil {
-		fmt.Println(os.Args[1], err)
-		os.Exit(8)
+		return false, err
+	}
+	if origin == "" {
+		// Any origin will do, as long as we use the same for both
+		origin = "."
+	}
+	oldRecords, err := old.Records(origin)
+	if err != nil {
+		return false, err
+	}
+	newRecords, err := zf.Records(origin)
+	if err != nil {
+		return false, err
+	}
+	a, b := canonicalRecords(oldRecords), canonicalRecords(newRecords)
+	if len(a) != len(b) {
+		return true, nil
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns the sorted canonical forms of the records, where the serial of
+// SOA records is left out.
+func canonicalRecords(records []zonefile.Record) (r []string) {
+	for _, rec := range records {
+		s := rec.Canonical()
+		if rec.Type == "SOA" {
+			// name ttl class SOA mname rname serial ...
+			fields := strings.Split(s, " ")
+			if len(fields) > 6 {
+				fields[6] = "-"
+			}
+			s = strings.Join(fields, " ")
+		}
+		r = append(r, s)
+	}
+	sort.Strings(r)
+	return
+}
+
+// Prints an error, with the line number for parsing errors
+func printError(path string, err error) {
+	if perr, ok := err.(zonefile.ParsingError); ok {
+		if ferr, ok := err.(zonefile.FileError); ok && ferr.File() != "" {
+			path = ferr.File()
+		}
+		fmt.Fprintln(os.Stderr, path+":"+strconv.Itoa(perr.LineNo()+1)+":",
+			perr)
+		return
 	}
+	fmt.Fprintln(os.Stderr, path+":", err)
 }
@@ -0,0 +1,248 @@
+package wire
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// The largest message that is sent over UDP without EDNS
+const MaxUDPSize = 512
+
+// Returns a random message ID
+func NewID() uint16 {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// Adds the default port, 53, to the address if it has none
+func WithPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, "53")
+}
+
+// Reads a message from a TCP connection, where it is preceded by its
+// length.
+func ReadTCP(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Writes a message to a TCP connection, preceded by its length
+func WriteTCP(w io.Writer, msg []byte) error {
+	if len(msg) > 0xffff {
+		return errors.New("message is too long")
+	}
+	_, err := w.Write(append([]byte{byte(len(msg) >> 8), byte(len(msg))},
+		msg...))
+	return err
+}
+
+// Sends the message to the server and returns the response.  The message
+// is sent over UDP if it fits, and over TCP if it doesn't or if the
+// response is truncated.  The server is an address with an optional port.
+func Exchange(ctx context.Context, server string, msg []byte) (
+	*Message, error) {
+	if len(msg) < 12 {
+		return nil, errTruncated
+	}
+	if len(msg) <= MaxUDPSize {
+		resp, err := exchange(ctx, "udp", server, msg)
+		if err != nil || !resp.Truncated {
+			return resp, err
+		}
+	}
+	return exchange(ctx, "tcp", server, msg)
+}
+
+func exchange(ctx context.Context, network, server string, msg []byte) (
+	*Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, WithPort(server))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	id := binary.BigEndian.Uint16(msg)
+	if network == "tcp" {
+		if err := WriteTCP(conn, msg); err != nil {
+			return nil, contextError(ctx, err)
+		}
+	} else if _, err := conn.Write(msg); err != nil {
+		return nil, contextError(ctx, err)
+	}
+	for {
+		var resp []byte
+		if network == "tcp" {
+			if resp, err = ReadTCP(conn); err != nil {
+				return nil, contextError(ctx, err)
+			}
+		} else {
+			buf := make([]byte, 0xffff)
+			n, err := conn.Read(buf)
+			if err != nil {
+				return nil, contextError(ctx, err)
+			}
+			resp = buf[:n]
+		}
+		m, err := Unpack(resp)
+		if err != nil && network == "tcp" {
+			return nil, err
+		}
+		// Ignore stray datagrams
+		if err == nil && m.ID == id && m.Response {
+			return m, nil
+		}
+		if network == "tcp" {
+			return nil, errors.New("response doesn't match the query")
+		}
+	}
+}
+
+// Closes the connection once the context is done, so that reads and
+// writes on it stop then and not only at the deadline of the context.
+// The returned function stops this.
+func closeOnDone(ctx context.Context, conn net.Conn) func() bool {
+	return context.AfterFunc(ctx, func() { conn.Close() })
+}
+
+// Returns the error of the context if it's done, which is what made the
+// connection fail with err
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// The response code of a response that isn't successful
+type RcodeError int
+
+func (e RcodeError) Error() string {
+	return fmt.Sprintf("server responded with rcode %d", int(e))
+}
+
+// Returns the serial of an SOA record
+func SOASerial(soa RR) uint32 {
+	if len(soa.Data) < 20 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(soa.Data[len(soa.Data)-20:])
+}
+
+// Sends an AXFR or IXFR query over TCP and returns the records of the
+// response, which may span several messages.  The response ends with the
+// SOA record it starts with: the second time it's seen for a full zone
+// and the third time for the changes of an IXFR response.  An IXFR
+// response with only an SOA record that isn't newer than the one in the
+// query means the zone is up to date.  Servers may send a record per
+// message, so which kind of response it is only shows from the second
+// record on.
+func Transfer(ctx context.Context, server string, msg []byte) ([]RR, error) {
+	q, err := Unpack(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.Question) != 1 {
+		return nil, errors.New("transfer query must have one question")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", WithPort(server))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := WriteTCP(conn, msg); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	var records []RR
+	seen := 0 // the number of times we saw the first SOA record
+	for {
+		if _, ok := ctx.Deadline(); !ok {
+			conn.SetDeadline(time.Now().Add(30 * time.Second))
+		}
+		b, err := ReadTCP(conn)
+		if err != nil {
+			return nil, contextError(ctx, err)
+		}
+		resp, err := Unpack(b)
+		if err != nil {
+			return nil, err
+		}
+		if resp.ID != q.ID || !resp.Response {
+			return nil, errors.New("response doesn't match the query")
+		}
+		if resp.Rcode != RcodeSuccess {
+			return nil, RcodeError(resp.Rcode)
+		}
+		for _, rr := range resp.Answer {
+			if len(records) == 0 && rr.Type != TypeSOA {
+				return nil, errors.New("transfer doesn't start with SOA record")
+			}
+			records = append(records, rr)
+			if rr.Type == TypeSOA && SOASerial(rr) == SOASerial(records[0]) {
+				seen++
+			}
+		}
+		if len(records) == 0 {
+			return nil, errors.New("empty transfer")
+		}
+		ixfr := q.Question[0].Type == TypeIXFR
+		if len(records) == 1 {
+			if ixfr && len(q.Authority) == 1 && !serialGreater(
+				SOASerial(records[0]), SOASerial(q.Authority[0])) {
+				return records, nil
+			}
+			continue
+		}
+		if ixfr && Incremental(records) {
+			if seen >= 3 {
+				return records, nil
+			}
+		} else if seen >= 2 {
+			return records, nil
+		}
+	}
+}
+
+// Checks whether the records of an IXFR response are changes rather than
+// the whole zone: then the SOA record of the new version is followed by
+// the SOA record of an older one.
+func Incremental(records []RR) bool {
+	return len(records) > 1 && records[1].Type == TypeSOA &&
+		SOASerial(records[1]) != SOASerial(records[0])
+}
+
+// Checks whether serial a is greater than b, as in RFC 1982
+func serialGreater(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
@@ -0,0 +1,193 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Splits an absolute domain name in presentation format into its labels,
+// which are unescaped.
+func SplitName(name string) (labels [][]byte, err error) {
+	if len(name) == 0 || name[len(name)-1] != '.' {
+		return nil, errors.New("domain name is not absolute")
+	}
+	if name == "." {
+		return nil, nil
+	}
+	var label []byte
+	length := 1
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '.':
+			if len(label) == 0 {
+				return nil, errors.New("empty label in domain name")
+			}
+			if len(label) > 63 {
+				return nil, errors.New("label in domain name is too long")
+			}
+			labels = append(labels, label)
+			length += len(label) + 1
+			label = nil
+			continue
+		case c == '\\' && i+3 < len(name) && isDigit(name[i+1]) &&
+			isDigit(name[i+2]) && isDigit(name[i+3]):
+			v := int(name[i+1]-'0')*100 + int(name[i+2]-'0')*10 +
+				int(name[i+3]-'0')
+			if v > 255 {
+				return nil, errors.New("invalid escape in domain name")
+			}
+			c = byte(v)
+			i += 3
+		case c == '\\':
+			i++
+			if i == len(name) {
+				return nil, errors.New("invalid escape in domain name")
+			}
+			c = name[i]
+		}
+		label = append(label, c)
+	}
+	if len(label) != 0 {
+		return nil, errors.New("domain name is not absolute")
+	}
+	if length > 255 {
+		return nil, errors.New("domain name is too long")
+	}
+	return
+}
+
+// Writes the labels of a domain name in presentation format
+func JoinName(labels [][]byte) string {
+	if len(labels) == 0 {
+		return "."
+	}
+	var buf bytes.Buffer
+	for _, label := range labels {
+		for _, c := range label {
+			switch {
+			case c == '.' || c == '\\' || c == '"' || c == '(' ||
+				c == ')' || c == ';' || c == '@' || c == '$':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c <= ' ' || c >= 0x7f:
+				fmt.Fprintf(&buf, "\\%03d", c)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteByte('.')
+	}
+	return buf.String()
+}
+
+// Returns the absolute domain name in canonical form: in lower case and
+// with escapes normalised, so that equal names are equal strings.
+func CanonicalName(name string) (string, error) {
+	labels, err := SplitName(name)
+	if err != nil {
+		return "", err
+	}
+	for _, label := range labels {
+		for i, c := range label {
+			if 'A' <= c && c <= 'Z' {
+				label[i] = c + 'a' - 'A'
+			}
+		}
+	}
+	return JoinName(labels), nil
+}
+
+// Checks whether the absolute domain name is equal to or below the zone.
+// Both names must be canonical.
+func IsSubdomain(name, zone string) bool {
+	if zone == "." || name == zone {
+		return true
+	}
+	return strings.HasSuffix(name, "."+zone) &&
+		!isEscaped(name, len(name)-len(zone)-1)
+}
+
+// Returns the parent of the absolute domain name, which must be canonical.
+// The parent of the root is the root.
+func ParentName(name string) string {
+	for i := 0; i < len(name)-1; i++ {
+		if name[i] == '.' && !isEscaped(name, i) {
+			return name[i+1:]
+		}
+	}
+	return "."
+}
+
+// Checks whether the character at index i of s is escaped by a backslash
+func isEscaped(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// Appends the absolute domain name in wire format, without compression
+func AppendName(b []byte, name string) ([]byte, error) {
+	labels, err := SplitName(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0), nil
+}
+
+// Reads a domain name at the given offset in the message, following
+// compression pointers.  Returns the name and the offset after it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels [][]byte
+	next := -1
+	length := 1
+	for hops := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errTruncated
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				return JoinName(labels), next, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, errTruncated
+			}
+			length += c + 1
+			if length > 255 {
+				return "", 0, errors.New("domain name is too long")
+			}
+			labels = append(labels, msg[off+1:off+1+c])
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errTruncated
+			}
+			if hops++; hops > 127 {
+				return "", 0, errors.New("too many compression pointers")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = (c&0x3f)<<8 | int(msg[off+1])
+		default:
+			return "", 0, errors.New("invalid label type")
+		}
+	}
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
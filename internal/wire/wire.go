@@ -0,0 +1,281 @@
+// Package wire encodes and decodes DNS messages as described in RFC 1035.
+//
+// Domain names are in presentation format, as in zonefiles, and always
+// absolute.  The data of records is kept in wire format; domain names in
+// it are never compressed when packing a message.
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Opcodes
+const (
+	OpcodeQuery  = 0
+	OpcodeNotify = 4
+	OpcodeUpdate = 5
+)
+
+// Response codes, including those of RFC 2136
+const (
+	RcodeSuccess  = 0
+	RcodeFormErr  = 1
+	RcodeServFail = 2
+	RcodeNXDomain = 3
+	RcodeNotImp   = 4
+	RcodeRefused  = 5
+	RcodeYXDomain = 6
+	RcodeYXRRSet  = 7
+	RcodeNXRRSet  = 8
+	RcodeNotAuth  = 9
+	RcodeNotZone  = 10
+)
+
+// Classes
+const (
+	ClassINET = 1
+	ClassNONE = 254
+	ClassANY  = 255
+)
+
+// Types that need special treatment
+const (
+	TypeNS    = 2
+	TypeCNAME = 5
+	TypeSOA   = 6
+	TypeOPT   = 41
+	TypeIXFR  = 251
+	TypeAXFR  = 252
+	TypeMAILB = 253
+	TypeMAILA = 254
+	TypeANY   = 255
+)
+
+var errTruncated = errors.New("message is truncated")
+
+// A question, or for UPDATE messages, the zone
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// A resource record
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte // in wire format
+
+	// The message the record was read from and the offset of Data in it,
+	// to resolve compressed names in Data.
+	msg []byte
+	off int
+}
+
+// Reads a domain name at the given offset in the data of the record.
+// Returns the name and the offset after it.
+func (rr RR) ReadName(off int) (string, int, error) {
+	if rr.msg == nil {
+		return readName(rr.Data, off)
+	}
+	name, next, err := readName(rr.msg, rr.off+off)
+	if err != nil {
+		return "", 0, err
+	}
+	if next > rr.off+len(rr.Data) {
+		return "", 0, errors.New("domain name runs past the record")
+	}
+	return name, next - rr.off, nil
+}
+
+// A DNS message.  For UPDATE messages (RFC 2136) the sections are the
+// zone, prerequisite, update and additional sections.
+type Message struct {
+	ID                 uint16
+	Response           bool
+	Opcode             int
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	Rcode              int
+
+	Question   []Question
+	Answer     []RR
+	Authority  []RR
+	Additional []RR
+}
+
+// Decodes a message
+func Unpack(msg []byte) (*Message, error) {
+	if len(msg) < 12 {
+		return nil, errTruncated
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	m := &Message{
+		ID:                 binary.BigEndian.Uint16(msg),
+		Response:           flags&0x8000 != 0,
+		Opcode:             int(flags>>11) & 0xf,
+		Authoritative:      flags&0x0400 != 0,
+		Truncated:          flags&0x0200 != 0,
+		RecursionDesired:   flags&0x0100 != 0,
+		RecursionAvailable: flags&0x0080 != 0,
+		Rcode:              int(flags & 0xf),
+	}
+	var counts [4]int
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+
+	off := 12
+	for i := 0; i < counts[0]; i++ {
+		var q Question
+		var err error
+		if q.Name, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+4 > len(msg) {
+			return nil, errTruncated
+		}
+		q.Type = binary.BigEndian.Uint16(msg[off:])
+		q.Class = binary.BigEndian.Uint16(msg[off+2:])
+		off += 4
+		m.Question = append(m.Question, q)
+	}
+	for s, section := range []*[]RR{&m.Answer, &m.Authority, &m.Additional} {
+		for i := 0; i < counts[s+1]; i++ {
+			var rr RR
+			var err error
+			if rr, off, err = readRR(msg, off); err != nil {
+				return nil, err
+			}
+			*section = append(*section, rr)
+		}
+	}
+	if off != len(msg) {
+		return nil, errors.New("trailing data after message")
+	}
+	return m, nil
+}
+
+// Reads a resource record at the given offset
+func readRR(msg []byte, off int) (rr RR, next int, err error) {
+	if rr.Name, off, err = readName(msg, off); err != nil {
+		return
+	}
+	if off+10 > len(msg) {
+		return rr, 0, errTruncated
+	}
+	rr.Type = binary.BigEndian.Uint16(msg[off:])
+	rr.Class = binary.BigEndian.Uint16(msg[off+2:])
+	rr.TTL = binary.BigEndian.Uint32(msg[off+4:])
+	length := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	if off+length > len(msg) {
+		return rr, 0, errTruncated
+	}
+	rr.Data = msg[off : off+length]
+	rr.msg = msg
+	rr.off = off
+	return rr, off + length, nil
+}
+
+// Encodes the message.  Owner names are compressed.
+func (m *Message) Pack() ([]byte, error) {
+	p := packer{names: make(map[string]int)}
+	p.b = make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(p.b, m.ID)
+	flags := uint16(m.Opcode&0xf)<<11 | uint16(m.Rcode&0xf)
+	for _, f := range []struct {
+		set bool
+		bit uint16
+	}{
+		{m.Response, 0x8000},
+		{m.Authoritative, 0x0400},
+		{m.Truncated, 0x0200},
+		{m.RecursionDesired, 0x0100},
+		{m.RecursionAvailable, 0x0080},
+	} {
+		if f.set {
+			flags |= f.bit
+		}
+	}
+	binary.BigEndian.PutUint16(p.b[2:], flags)
+	for i, n := range []int{len(m.Question), len(m.Answer),
+		len(m.Authority), len(m.Additional)} {
+		if n > 0xffff {
+			return nil, errors.New("too many records")
+		}
+		binary.BigEndian.PutUint16(p.b[4+2*i:], uint16(n))
+	}
+
+	for _, q := range m.Question {
+		if err := p.name(q.Name); err != nil {
+			return nil, err
+		}
+		p.b = appendUint16(p.b, q.Type)
+		p.b = appendUint16(p.b, q.Class)
+	}
+	for _, section := range [][]RR{m.Answer, m.Authority, m.Additional} {
+		for _, rr := range section {
+			if err := p.rr(rr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p.b, nil
+}
+
+// Packs a message and remembers where names are for compression
+type packer struct {
+	b     []byte
+	names map[string]int // offsets of names, in lower case
+}
+
+func (p *packer) name(name string) error {
+	labels, err := SplitName(name)
+	if err != nil {
+		return err
+	}
+	for i := range labels {
+		suffix := strings.ToLower(JoinName(labels[i:]))
+		if off, ok := p.names[suffix]; ok {
+			p.b = appendUint16(p.b, uint16(0xc000|off))
+			return nil
+		}
+		if len(p.b) < 0x4000 {
+			p.names[suffix] = len(p.b)
+		}
+		p.b = append(p.b, byte(len(labels[i])))
+		p.b = append(p.b, labels[i]...)
+	}
+	p.b = append(p.b, 0)
+	return nil
+}
+
+func (p *packer) rr(rr RR) error {
+	if err := p.name(rr.Name); err != nil {
+		return err
+	}
+	if len(rr.Data) > 0xffff {
+		return errors.New("record data is too long")
+	}
+	p.b = appendUint16(p.b, rr.Type)
+	p.b = appendUint16(p.b, rr.Class)
+	p.b = appendUint32(p.b, rr.TTL)
+	p.b = appendUint16(p.b, uint16(len(rr.Data)))
+	p.b = append(p.b, rr.Data...)
+	return nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
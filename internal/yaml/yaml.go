@@ -0,0 +1,489 @@
+// Package yaml reads and writes the subset of YAML that is used in zone
+// configurations such as those of OctoDNS: block mappings and sequences,
+// flow sequences, and plain and quoted scalars on a single line.
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The kinds of nodes
+type Kind int
+
+const (
+	Scalar Kind = iota
+	Mapping
+	Sequence
+)
+
+// A node of a YAML document
+type Node struct {
+	Kind Kind
+
+	// The value of a scalar.  Quoted scalars are strings; plain scalars
+	// may be numbers, booleans or null as well.
+	Value  string
+	Quoted bool
+
+	// The keys and values of a mapping, in order
+	Keys   []string
+	Values []*Node
+
+	// The items of a sequence
+	Items []*Node
+
+	Line int // where the node starts, counting from 1; 0 if unknown
+}
+
+// Returns a scalar node for the string, which is quoted when written if
+// it would otherwise not be read as a string.
+func String(s string) *Node {
+	return &Node{Kind: Scalar, Value: s, Quoted: true}
+}
+
+// Returns a scalar node for the number
+func Int(i int) *Node {
+	return &Node{Kind: Scalar, Value: strconv.Itoa(i)}
+}
+
+// Returns the value of the mapping for the key, or nil if there is none
+func (n *Node) Get(key string) *Node {
+	for i, k := range n.Keys {
+		if k == key {
+			return n.Values[i]
+		}
+	}
+	return nil
+}
+
+// Adds the key and value to the mapping
+func (n *Node) Set(key string, value *Node) {
+	n.Keys = append(n.Keys, key)
+	n.Values = append(n.Values, value)
+}
+
+// Sorts the keys of the mapping, as they're usually written
+func (n *Node) SortKeys() {
+	sort.Sort(byKey{n})
+}
+
+type byKey struct{ n *Node }
+
+func (b byKey) Len() int           { return len(b.n.Keys) }
+func (b byKey) Less(i, j int) bool { return b.n.Keys[i] < b.n.Keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.n.Keys[i], b.n.Keys[j] = b.n.Keys[j], b.n.Keys[i]
+	b.n.Values[i], b.n.Values[j] = b.n.Values[j], b.n.Values[i]
+}
+
+// Whether the node is a null scalar, such as ~
+func (n *Node) IsNull() bool {
+	if n.Kind != Scalar || n.Quoted {
+		return false
+	}
+	switch n.Value {
+	case "", "~", "null", "Null", "NULL":
+		return true
+	}
+	return false
+}
+
+// A line of the document without its indentation and comment
+type line struct {
+	indent int
+	text   string
+	no     int
+}
+
+type parser struct {
+	lines []line
+	pos   int
+}
+
+// Parses a YAML document.  The result is a null scalar if the document is
+// empty.
+func Parse(data []byte) (*Node, error) {
+	var p parser
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || text == "---" || text == "..." ||
+			strings.HasPrefix(text, "%") {
+			continue
+		}
+		if strings.HasPrefix(text, "--- ") {
+			trimmed = strings.TrimLeft(text[4:], " ")
+		} else if trimmed[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tab in indentation", i+1)
+		}
+		p.lines = append(p.lines, line{len(text) - len(trimmed), trimmed, i + 1})
+	}
+	if len(p.lines) == 0 {
+		return &Node{Kind: Scalar}, nil
+	}
+	n, err := p.node(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation",
+			p.lines[p.pos].no)
+	}
+	return n, nil
+}
+
+// Removes a comment from the line
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			// Only at the start of a scalar
+			if i == 0 || strings.IndexByte(" [,:-", text[i-1]) != -1 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// Parses the node that starts at the current line, which has the indent
+func (p *parser) node(indent int) (*Node, error) {
+	l := p.lines[p.pos]
+	if isItem(l.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok, err := splitKey(l.text); err != nil {
+		return nil, fmt.Errorf("line %d: %v", l.no, err)
+	} else if ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	n, err := inline(l.text)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", l.no, err)
+	}
+	n.Line = l.no
+	return n, nil
+}
+
+func (p *parser) sequence(indent int) (*Node, error) {
+	n := &Node{Kind: Sequence, Line: p.lines[p.pos].no}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent &&
+		isItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var item *Node
+		var err error
+		switch {
+		case rest != "":
+			// Parse the rest as if it were on a line of its own
+			col := indent + len(l.text) - len(rest)
+			p.lines[p.pos] = line{col, rest, l.no}
+			item, err = p.node(col)
+		case p.pos+1 < len(p.lines) && p.lines[p.pos+1].indent > indent:
+			p.pos++
+			item, err = p.node(p.lines[p.pos].indent)
+		default:
+			p.pos++
+			item = &Node{Kind: Scalar, Line: l.no}
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.Items = append(n.Items, item)
+	}
+	return n, p.checkEnd(indent)
+}
+
+func (p *parser) mapping(indent int) (*Node, error) {
+	n := &Node{Kind: Mapping, Line: p.lines[p.pos].no}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent &&
+		!isItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		key, rest, ok, err := splitKey(l.text)
+		if err == nil && !ok {
+			err = fmt.Errorf("expected a key")
+		}
+		if err == nil && n.Get(key) != nil {
+			err = fmt.Errorf("duplicate key %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", l.no, err)
+		}
+		p.pos++
+
+		var value *Node
+		if rest != "" {
+			value, err = inline(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", l.no, err)
+			}
+			value.Line = l.no
+		} else if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent ||
+			p.lines[p.pos].indent == indent && isItem(p.lines[p.pos].text)) {
+			if value, err = p.node(p.lines[p.pos].indent); err != nil {
+				return nil, err
+			}
+		} else {
+			value = &Node{Kind: Scalar, Line: l.no}
+		}
+		n.Set(key, value)
+	}
+	return n, p.checkEnd(indent)
+}
+
+// Checks that the node that ended isn't followed by a more indented line
+func (p *parser) checkEnd(indent int) error {
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		return fmt.Errorf("line %d: unexpected indentation",
+			p.lines[p.pos].no)
+	}
+	return nil
+}
+
+// Splits "key: value" into the key and the value.  Returns false if the
+// text isn't a key with a value.
+func splitKey(text string) (key, rest string, ok bool, err error) {
+	i := 0
+	if text[0] == '\'' || text[0] == '"' {
+		end := quoteEnd(text)
+		if end < 0 {
+			return "", "", false, fmt.Errorf("unterminated quoted string")
+		}
+		i = end
+	}
+	for ; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			break
+		}
+	}
+	if i == len(text) || text[0] == '[' || text[0] == '{' {
+		return "", "", false, nil
+	}
+	k, err := scalar(strings.TrimRight(text[:i], " "))
+	if err != nil {
+		return "", "", false, err
+	}
+	return k.Value, strings.TrimLeft(text[i+1:], " "), true, nil
+}
+
+// Returns the index after the quoted string at the start of the text, or
+// -1 if it's not terminated.
+func quoteEnd(text string) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// Parses a value on the same line as its key or item
+func inline(text string) (*Node, error) {
+	switch text[0] {
+	case '[':
+		if text[len(text)-1] != ']' {
+			return nil, fmt.Errorf("flow sequence doesn't end on its line")
+		}
+		n := &Node{Kind: Sequence}
+		for _, item := range splitFlow(text[1 : len(text)-1]) {
+			v, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			n.Items = append(n.Items, v)
+		}
+		return n, nil
+	case '{':
+		if strings.TrimSpace(text[1:len(text)-1]) == "" &&
+			text[len(text)-1] == '}' {
+			return &Node{Kind: Mapping}, nil
+		}
+		return nil, fmt.Errorf("flow mappings are not supported")
+	case '|', '>':
+		return nil, fmt.Errorf("block scalars are not supported")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported")
+	}
+	return scalar(text)
+}
+
+// Splits the items of a flow sequence
+func splitFlow(text string) (items []string) {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\'', '"':
+			if end := quoteEnd(text[i:]); end > 0 {
+				i += end - 1
+			}
+		case ',':
+			items = append(items, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(text[start:]))
+}
+
+// Parses a scalar
+func scalar(text string) (*Node, error) {
+	if text == "" || (text[0] != '\'' && text[0] != '"') {
+		return &Node{Kind: Scalar, Value: text}, nil
+	}
+	if quoteEnd(text) != len(text) {
+		return nil, fmt.Errorf("unexpected text after quoted string")
+	}
+	if text[0] == '\'' {
+		return String(strings.Replace(text[1:len(text)-1], "''", "'", -1)),
+			nil
+	}
+	s, err := strconv.Unquote(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quoted string %s", text)
+	}
+	return String(s), nil
+}
+
+// Writes the node as a YAML document
+func Marshal(n *Node) []byte {
+	var b bytes.Buffer
+	b.WriteString("---")
+	switch {
+	case n.Kind == Mapping && len(n.Keys) > 0:
+		b.WriteByte('\n')
+		writeMapping(&b, n, 0, false)
+	case n.Kind == Sequence && len(n.Items) > 0:
+		b.WriteByte('\n')
+		writeSequence(&b, n, 0)
+	default:
+		b.WriteByte(' ')
+		writeValue(&b, n, 0)
+	}
+	return b.Bytes()
+}
+
+// Writes the mapping, where the first key may already be indented
+func writeMapping(b *bytes.Buffer, n *Node, indent int, indented bool) {
+	for i, key := range n.Keys {
+		if i > 0 || !indented {
+			b.WriteString(strings.Repeat(" ", indent))
+		}
+		b.WriteString(quote(key))
+		b.WriteByte(':')
+		v := n.Values[i]
+		switch {
+		case v.Kind == Mapping && len(v.Keys) > 0:
+			b.WriteByte('\n')
+			writeMapping(b, v, indent+2, false)
+		case v.Kind == Sequence && len(v.Items) > 0:
+			b.WriteByte('\n')
+			writeSequence(b, v, indent)
+		default:
+			b.WriteByte(' ')
+			writeValue(b, v, indent)
+		}
+	}
+}
+
+func writeSequence(b *bytes.Buffer, n *Node, indent int) {
+	for _, item := range n.Items {
+		b.WriteString(strings.Repeat(" ", indent))
+		b.WriteString("- ")
+		switch {
+		case item.Kind == Mapping && len(item.Keys) > 0:
+			writeMapping(b, item, indent+2, true)
+		case item.Kind == Sequence && len(item.Items) > 0:
+			b.WriteByte('\n')
+			writeSequence(b, item, indent+2)
+		default:
+			writeValue(b, item, indent)
+		}
+	}
+}
+
+// Writes a scalar or an empty collection, and the end of the line
+func writeValue(b *bytes.Buffer, n *Node, indent int) {
+	switch {
+	case n.Kind == Mapping:
+		b.WriteString("{}")
+	case n.Kind == Sequence:
+		b.WriteString("[]")
+	case n.Quoted:
+		b.WriteString(quote(n.Value))
+	case n.Value == "":
+		b.WriteString("null")
+	default:
+		b.WriteString(n.Value)
+	}
+	b.WriteByte('\n')
+}
+
+// Returns the string as a scalar, quoted if it has to be
+func quote(s string) string {
+	if !needsQuotes(s) {
+		return s
+	}
+	for _, c := range s {
+		if c < ' ' || c == 0x7f {
+			return strconv.Quote(s)
+		}
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Whether the string would not be read as that string if it's written as
+// a plain scalar.
+func needsQuotes(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) ||
+		strings.IndexByte("-?:,[]{}#&*!|>'\"%@`", s[0]) != -1 ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.HasSuffix(s, ":") {
+		return true
+	}
+	for _, c := range s {
+		if c < ' ' || c == 0x7f {
+			return true
+		}
+	}
+	switch strings.ToLower(s) {
+	case "~", "null", "true", "false", "yes", "no", "on", "off", "y", "n",
+		".inf", ".nan":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 0,
+		64); err == nil {
+		return true
+	}
+	// Sexagesimal numbers, as in YAML 1.1
+	return strings.Trim(s, "0123456789:") == "" && strings.Contains(s, ":")
+}
@@ -0,0 +1,312 @@
+package zonefile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"strings"
+)
+
+// The TTL ImportJSON gives the first record if it has none
+const jsonDefaultTTL = 3600
+
+// Options for ExportJSON and ImportJSON
+type JSONOptions struct {
+	// The origin of the zone, as for Records.  When exporting, it's
+	// written as the origin of the zone, or if it's empty, the owner of
+	// the SOA record is.  When importing, it's used if the JSON has no
+	// origin.
+	Origin string
+
+	// Export the records in the style of RFC 8427 instead
+	RFC8427 bool
+}
+
+// A zone as exported by ExportJSON:
+//
+//	{
+//	  "origin": "example.com.",
+//	  "records": [
+//	    {
+//	      "owner": "www.example.com.",
+//	      "ttl": 3600,
+//	      "class": "IN",
+//	      "type": "A",
+//	      "rdata": ["192.0.2.1"],
+//	      "comment": "web server",
+//	      "file": "example.com.zone",
+//	      "line": 12
+//	    }
+//	  ]
+//	}
+type JSONZone struct {
+	Origin  string       `json:"origin,omitempty"`
+	Records []JSONRecord `json:"records"`
+}
+
+// A record of a JSONZone.  Names are absolute, and the values in Rdata
+// are as in a zonefile, so that character-strings are quoted.  When
+// importing, names may be relative to the origin, the file and line are
+// ignored, and the class may be left out, as may the TTL: a record
+// without one gets the TTL of the record before it, as in a zonefile, or
+// an hour if it's the first.
+type JSONRecord struct {
+	Owner   string   `json:"owner"`
+	TTL     *int     `json:"ttl,omitempty"`
+	Class   string   `json:"class,omitempty"`
+	Type    string   `json:"type"`
+	Rdata   []string `json:"rdata"`
+	Comment string   `json:"comment,omitempty"` // without the semicolon
+	File    string   `json:"file,omitempty"`    // the path of the zonefile
+	Line    int      `json:"line,omitempty"`    // starts at 1
+}
+
+// Returns the records in the zonefile and the files it includes as JSON,
+// in the form of a JSONZone, or with RFC8427 set, as an array of resource
+// records in the style of RFC 8427, section 2.2:
+//
+//	[
+//	  {
+//	    "NAME": "www.example.com.",
+//	    "TYPE": 1,
+//	    "TYPEname": "A",
+//	    "CLASS": 1,
+//	    "CLASSname": "IN",
+//	    "TTL": 3600,
+//	    "rdataA": "192.0.2.1",
+//	    "RDLENGTH": 4,
+//	    "RDATAHEX": "C0000201"
+//	  }
+//	]
+//
+// There is an rdata member for records of all types.  If the zonefile
+// can't be resolved into records, the error of Records is returned.
+func ExportJSON(z *Zonefile, opts JSONOptions) ([]byte, error) {
+	records, err := z.Records(opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RFC8427 {
+		rrs := make([]map[string]interface{}, 0, len(records))
+		for _, r := range records {
+			rrs = append(rrs, rfc8427Record(r))
+		}
+		return json.MarshalIndent(rrs, "", "  ")
+	}
+
+	zone := JSONZone{Origin: opts.Origin, Records: []JSONRecord{}}
+	for _, r := range records {
+		if r.Type == "SOA" && zone.Origin == "" {
+			zone.Origin = r.Name
+		}
+		ttl := r.TTL
+		zone.Records = append(zone.Records, JSONRecord{
+			Owner:   r.Name,
+			TTL:     &ttl,
+			Class:   r.Class,
+			Type:    r.Type,
+			Rdata:   r.Values,
+			Comment: r.Entry.comment(),
+			File:    r.Zonefile.Path(),
+			Line:    r.Entry.LineNo() + 1,
+		})
+	}
+	return json.MarshalIndent(zone, "", "  ")
+}
+
+// Returns the record as an RFC 8427 resource record object
+func rfc8427Record(r Record) map[string]interface{} {
+	rr := map[string]interface{}{
+		"NAME":           r.Name,
+		"TYPEname":       r.Type,
+		"CLASSname":      r.Class,
+		"TTL":            r.TTL,
+		"rdata" + r.Type: strings.Join(r.Values, " "),
+	}
+	if typ, ok := typeCode(r.Type); ok {
+		rr["TYPE"] = typ
+	}
+	if class, ok := classCode(r.Class); ok {
+		rr["CLASS"] = class
+	}
+	if w, err := r.wire(); err == nil {
+		rr["RDLENGTH"] = len(w.Data)
+		rr["RDATAHEX"] = strings.ToUpper(hex.EncodeToString(w.Data))
+	}
+	return rr
+}
+
+// Returns the comments on the lines of the entry, without the semicolons,
+// one per line.
+func (e Entry) comment() string {
+	var comments []string
+	for _, tt := range e.tokens[e.startOfLine():] {
+		if tt.t.typ == tokenComment {
+			comments = append(comments, strings.TrimSpace(
+				strings.TrimPrefix(string(tt.t.val), ";")))
+		}
+	}
+	return strings.Join(comments, "\n")
+}
+
+// Creates a zonefile from JSON as returned by ExportJSON, either a
+// JSONZone or an array of RFC 8427 resource records, which need a NAME,
+// a TYPEname or TYPE and either an rdata member for the type or
+// RDATAHEX.  The zonefile starts with $ORIGIN if the origin is known,
+// and its columns are lined up.  Comments are put after their record.
+//
+// Errors in records are returned with the index of the record, counting
+// from 0, such as a TTL that is out of range or rdata that doesn't fit
+// the type.
+func ImportJSON(data []byte, opts JSONOptions) (*Zonefile, error) {
+	var zone JSONZone
+	var err error
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		zone.Records, err = rfc8427Records(data)
+	} else {
+		err = json.Unmarshal(data, &zone)
+	}
+	if err != nil {
+		return nil, err
+	}
+	origin := zone.Origin
+	if origin == "" {
+		origin = opts.Origin
+	}
+	if origin != "" && !isAbsolute(origin) {
+		return nil, errors.New("origin must be absolute")
+	}
+
+	var lines []string
+	var ttl *int
+	for i, r := range zone.Records {
+		if r.Owner == "" || r.Type == "" || len(r.Rdata) == 0 {
+			return nil, fmt.Errorf("record %d: missing owner, type or rdata",
+				i)
+		}
+		class := r.Class
+		if class == "" {
+			class = "IN"
+		}
+		if err := checkName(r.Owner); err != nil {
+			return nil, fmt.Errorf("record %d: %v", i, err)
+		}
+		for _, v := range append([]string{class, r.Type}, r.Rdata...) {
+			if _, err := valueItems(v); err != nil {
+				return nil, fmt.Errorf("record %d: %v", i, err)
+			}
+		}
+		if r.TTL != nil {
+			ttl = r.TTL
+		} else if ttl == nil {
+			// There is no $TTL to fall back on
+			dflt := jsonDefaultTTL
+			r.TTL, ttl = &dflt, &dflt
+		}
+		line := recordLine(origin, r.Owner, r.TTL, class, r.Type, r.Rdata)
+		if r.Comment != "" {
+			line += " ; " + strings.Join(strings.Fields(r.Comment), " ")
+		}
+		lines = append(lines, line)
+	}
+	z, perr := formattedZonefile(origin, lines)
+	if perr != nil {
+		return nil, fmt.Errorf("record %d: %v", perr.LineNo(), perr)
+	}
+
+	// Check the values
+	if _, err := z.Records(""); err != nil {
+		if perr, ok := err.(ParsingError); ok {
+			i := perr.LineNo()
+			if origin != "" {
+				i--
+			}
+			return nil, fmt.Errorf("record %d: %v", i, perr)
+		}
+		return nil, err
+	}
+	return z, nil
+}
+
+// Converts RFC 8427 resource records into JSONRecords
+func rfc8427Records(data []byte) ([]JSONRecord, error) {
+	var rrs []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &rrs); err != nil {
+		return nil, err
+	}
+	records := make([]JSONRecord, 0, len(rrs))
+	for i, rr := range rrs {
+		var r JSONRecord
+		var code, class uint16
+		var ttl int
+		var rdata, rdataHex string
+		for _, f := range []struct {
+			name string
+			v    interface{}
+		}{
+			{"NAME", &r.Owner},
+			{"TYPEname", &r.Type},
+			{"TYPE", &code},
+			{"CLASSname", &r.Class},
+			{"CLASS", &class},
+			{"TTL", &ttl},
+			{"RDATAHEX", &rdataHex},
+		} {
+			if v, ok := rr[f.name]; ok {
+				if err := json.Unmarshal(v, f.v); err != nil {
+					return nil, fmt.Errorf("record %d: %s: %v", i, f.name,
+						err)
+				}
+				if f.name == "TTL" {
+					r.TTL = &ttl
+				}
+			}
+		}
+		if r.Type == "" && code != 0 {
+			r.Type = typeName(code)
+		}
+		if r.Class == "" && class != 0 {
+			r.Class = className(class)
+		}
+		if v, ok := rr["rdata"+r.Type]; ok && r.Type != "" {
+			if err := json.Unmarshal(v, &rdata); err != nil {
+				return nil, fmt.Errorf("record %d: rdata%s: %v", i, r.Type,
+					err)
+			}
+			r.Rdata = []string{rdata}
+		} else if _, ok := rr["RDATAHEX"]; ok {
+			data, err := hex.DecodeString(rdataHex)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: RDATAHEX: %v", i, err)
+			}
+			code, _ := typeCode(r.Type)
+			values, err := rdataFromWire(r.Type, wire.RR{Name: r.Owner,
+				Type: code, Data: data})
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %v", i, err)
+			}
+			r.Rdata = values
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Encodes the zonefile as by ExportJSON, with the origin taken from the
+// zonefile.
+func (z *Zonefile) MarshalJSON() ([]byte, error) {
+	return ExportJSON(z, JSONOptions{})
+}
+
+// Replaces the zonefile by one created from JSON by ImportJSON
+func (z *Zonefile) UnmarshalJSON(data []byte) error {
+	c, err := ImportJSON(data, JSONOptions{})
+	if err != nil {
+		return err
+	}
+	z.replaceWith(c)
+	return nil
+}
@@ -0,0 +1,206 @@
+package zonefile_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"strings"
+	"testing"
+)
+
+const jsonZone = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  300 IN TXT "hello world"
+`
+
+func ExampleExportJSON() {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+www 300 IN A 192.0.2.1 ; web server
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	data, err2 := zonefile.ExportJSON(zf, zonefile.JSONOptions{})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	fmt.Println(string(data))
+	// Output:
+	// {
+	//   "records": [
+	//     {
+	//       "owner": "www.example.com.",
+	//       "ttl": 300,
+	//       "class": "IN",
+	//       "type": "A",
+	//       "rdata": [
+	//         "192.0.2.1"
+	//       ],
+	//       "comment": "web server",
+	//       "line": 2
+	//     }
+	//   ]
+	// }
+}
+
+func ExampleImportJSON() {
+	zf, err := zonefile.ImportJSON([]byte(`{
+  "origin": "example.com.",
+  "records": [
+    {"owner": "example.com.", "ttl": 3600, "type": "NS",
+     "rdata": ["ns1.example.com."]},
+    {"owner": "ns1", "type": "A", "rdata": ["192.0.2.1"],
+     "comment": "in the basement"},
+    {"owner": "mail.example.com.", "ttl": 300, "type": "MX",
+     "rdata": ["10", "mx.example.org."]}
+  ]
+}`), zonefile.JSONOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(string(zf.Save()))
+	// Output:
+	// $ORIGIN example.com.
+	// @    3600 IN NS ns1
+	// ns1       IN A  192.0.2.1 ; in the basement
+	// mail 300  IN MX 10 mx.example.org.
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	zf, err := zonefile.Load([]byte(jsonZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rfc8427 := range []bool{false, true} {
+		data, err := zonefile.ExportJSON(zf, zonefile.JSONOptions{
+			RFC8427: rfc8427})
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, err := zonefile.ImportJSON(data, zonefile.JSONOptions{
+			Origin: "example.com."})
+		if err != nil {
+			t.Fatalf("importing %s: %v", data, err)
+		}
+		changes, err := zonefile.DiffOrigin(zf, imported, "example.com.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 0 {
+			t.Fatalf("records differ after importing %s:\n%s", data,
+				imported.Save())
+		}
+		if got := string(imported.Save()); !rfc8427 &&
+			!strings.Contains(got, "; in the basement") {
+			t.Fatalf("comment was lost:\n%s", got)
+		}
+	}
+
+	// Through encoding/json
+	data, err2 := json.Marshal(zf)
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	var imported zonefile.Zonefile
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Fatal(err)
+	}
+	if got := imported.Save(); !strings.HasPrefix(string(got),
+		"$ORIGIN example.com.\n@ ") {
+		t.Fatalf("got\n%s", got)
+	}
+}
+
+func TestImportRFC8427(t *testing.T) {
+	zf, err := zonefile.ImportJSON([]byte(`[
+  {"NAME": "www.example.com.", "TYPE": 1, "CLASS": 1, "TTL": 300,
+   "RDATAHEX": "C0000201"},
+  {"NAME": "example.com.", "TYPEname": "TXT", "TTL": 300,
+   "rdataTXT": "\"v=spf1 -all\""},
+  {"NAME": "example.com.", "TYPE": 15, "TTL": 300,
+   "RDATAHEX": "000A046D61696C076578616D706C6503636F6D00"}
+]`), zonefile.JSONOptions{Origin: "example.com."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `$ORIGIN example.com.
+www 300 IN A   192.0.2.1
+@   300 IN TXT "v=spf1 -all"
+@   300 IN MX  10 mail
+`
+	if got := string(zf.Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
+
+func TestImportJSONErrors(t *testing.T) {
+	for _, test := range []struct {
+		data, err string
+	}{
+		{`{"records": [{"owner": "www", "type": "A", "rdata": ["1.2.3.4"]}]}`,
+			"record 0: relative domain name without origin"},
+		{`{"origin": "example.com.", "records": [
+			{"owner": "www", "ttl": 60, "type": "A", "rdata": ["1.2.3.4"]},
+			{"owner": "ftp", "type": "A", "rdata": ["1.2.3"]}]}`,
+			"record 1: "},
+		{`{"records": [{"owner": "www.example.com.", "type": "A"}]}`,
+			"record 0: missing owner, type or rdata"},
+		{`{"origin": "example.com.", "records": [{"owner": "www",
+			"type": "A", "rdata": ["1.2.3.4\nevil 60 IN A 6.6.6.6"]}]}`,
+			"record 0: invalid value"},
+		{`{"origin": "example.com.", "records": [{"owner": "www",
+			"type": "NS", "rdata": ["ns1 ("]}, {"owner": "ftp",
+			"type": "A", "rdata": ["6.6.6.6"]}]}`,
+			"record 0: invalid value"},
+		{`{"origin": "example.com.", "records": [{"owner": "www evil",
+			"type": "A", "rdata": ["1.2.3.4"]}]}`,
+			`record 0: invalid name "www evil"`},
+		{`{"origin": "example.com.", "records": [{"owner": "www",
+			"type": "TXT", "rdata": ["\"a\n\"\""]}]}`,
+			"record 0: invalid value"},
+	} {
+		_, err := zonefile.ImportJSON([]byte(test.data), zonefile.JSONOptions{})
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Fatalf("expected error %q, not %v", test.err, err)
+		}
+	}
+}
+
+func TestImportJSONValues(t *testing.T) {
+	zf, err := zonefile.ImportJSON([]byte(`{
+  "origin": "example.com.",
+  "records": [
+    {"owner": "www", "type": "A", "rdata": ["192.0.2.1"],
+     "comment": "first line\nsecond line"},
+    {"owner": "www", "type": "TXT", "rdata": ["\"say \\\"hi\\\"\"", "b"]},
+    {"owner": "ftp", "ttl": 60, "type": "CNAME", "rdata": ["www"]},
+    {"owner": "mail", "type": "A", "rdata": ["192.0.2.2"]}
+  ]
+}`), zonefile.JSONOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first record gets an hour, the others the TTL before them
+	expected := `$ORIGIN example.com.
+www  3600 IN A     192.0.2.1 ; first line second line
+www       IN TXT   "say \"hi\"" b
+ftp  60   IN CNAME www
+mail      IN A     192.0.2.2
+`
+	if got := string(zf.Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+	records, err := zf.Records("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[1].TTL != 3600 || records[3].TTL != 60 {
+		t.Fatalf("got %v", records)
+	}
+}
@@ -0,0 +1,234 @@
+package zonefile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// An RRset that was changed differently in both versions given to Merge
+type MergeConflict struct {
+	Name, Class, Type string
+
+	// The records of the RRset in each version
+	Base, Ours, Theirs []Record
+}
+
+func (c MergeConflict) String() string {
+	return fmt.Sprintf("conflicting changes to %s %s %s", c.Name, c.Class,
+		c.Type)
+}
+
+// Merges the changes from base to theirs into ours, record by record, as
+// a three-way merge.  Ours is not changed: the merged zonefile is a copy of
+// ours, with the changes from theirs applied as by Apply.  The serial of
+// the merged zonefile is one more than the greatest of the serials of ours
+// and theirs, unless theirs has no changes from base: then the merged
+// zonefile is the same as ours, serial and all.
+//
+// RRsets that were changed in both ours and theirs are a conflict, unless
+// they were changed in the same way.  A conflicting RRset is left as it is
+// in ours, with a comment above it that lists the records in theirs.
+//
+// The zonefiles must start with $ORIGIN; use MergeOrigin otherwise.
+func Merge(base, ours, theirs *Zonefile) (*Zonefile, []MergeConflict,
+	error) {
+	return MergeOrigin(base, ours, theirs, "")
+}
+
+// Like Merge, but resolves the zonefiles with the given origin, as Records.
+func MergeOrigin(base, ours, theirs *Zonefile, origin string) (
+	*Zonefile, []MergeConflict, error) {
+	var rrsets [3]map[rrsetKey][]Record
+	var keys []rrsetKey // in the order in which we came across them
+	seen := make(map[rrsetKey]bool)
+	for i, z := range []*Zonefile{base, ours, theirs} {
+		records, err := z.Records(origin)
+		if err != nil {
+			return nil, nil, err
+		}
+		rrsets[i] = make(map[rrsetKey][]Record)
+		for _, r := range records {
+			k := recordKeyOf(&r).rrsetKey
+			rrsets[i][k] = append(rrsets[i][k], r)
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	merged, err := ours.Copy()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ops []Operation
+	var conflicts []MergeConflict
+	theirsChanged := false
+	for _, k := range keys {
+		b, o, t := rrsets[0][k], rrsets[1][k], rrsets[2][k]
+		baseSet, ourSet := rrsetContents(b), rrsetContents(o)
+		theirSet := rrsetContents(t)
+		if baseSet != theirSet {
+			theirsChanged = true
+		}
+		if ourSet == theirSet || baseSet == theirSet {
+			continue
+		}
+		if baseSet != ourSet {
+			name, class, typ := "", "", ""
+			for _, rs := range [][]Record{o, t, b} {
+				if len(rs) > 0 {
+					name, class, typ = rs[0].Name, rs[0].Class, rs[0].Type
+					break
+				}
+			}
+			conflicts = append(conflicts, MergeConflict{name, class, typ,
+				b, o, t})
+			continue
+		}
+		ops = append(ops, replaceRRset(o, t)...)
+	}
+
+	failed, err := merged.Apply(ops, ApplyOptions{Origin: origin})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(failed) > 0 {
+		return nil, nil, failed[0]
+	}
+
+	if !theirsChanged {
+		return merged, nil, nil
+	}
+	if err := mergeSerials(merged, ours, theirs); err != nil {
+		return nil, nil, err
+	}
+	for _, c := range conflicts {
+		if err := merged.markConflict(c, origin); err != nil {
+			return nil, nil, err
+		}
+	}
+	return merged, conflicts, nil
+}
+
+// Returns the contents of an RRset in a form that can be compared: its
+// records without owner and, for SOA records, without serial.
+func rrsetContents(records []Record) string {
+	var rs []string
+	for _, r := range records {
+		rdata := r.rdata
+		if r.Type == "SOA" && len(rdata) == 7 {
+			rdata = append([]string{}, rdata...)
+			rdata[2] = ""
+		}
+		rs = append(rs, fmt.Sprintf("%d %s", r.TTL, strings.Join(rdata, " ")))
+	}
+	sort.Strings(rs)
+	// Duplicate records are the same as one
+	var unique []string
+	for i, r := range rs {
+		if i == 0 || r != rs[i-1] {
+			unique = append(unique, r)
+		}
+	}
+	return strings.Join(unique, "\n")
+}
+
+// Returns the operations that turn RRset a into RRset b
+func replaceRRset(a, b []Record) (ops []Operation) {
+	inB := make(map[string]bool)
+	for _, r := range b {
+		inB[rrsetContents([]Record{r})] = true
+	}
+	inA := make(map[string]bool)
+	for _, r := range a {
+		s := rrsetContents([]Record{r})
+		inA[s] = true
+		if !inB[s] {
+			ops = append(ops, Operation{Kind: DeleteRR, Name: r.Name,
+				Class: r.Class, Type: r.Type, Values: r.Values})
+		}
+	}
+	for _, r := range b {
+		s := rrsetContents([]Record{r})
+		if !inA[s] {
+			ttl := r.TTL
+			ops = append(ops, Operation{Kind: AddRR, Name: r.Name, TTL: &ttl,
+				Class: r.Class, Type: r.Type, Values: r.Values})
+			inA[s] = true
+		}
+	}
+	return
+}
+
+// Sets the serial of the merged zonefile to one more than the greatest
+// serial of ours and theirs.
+func mergeSerials(merged, ours, theirs *Zonefile) error {
+	if merged.SOA() == nil {
+		return nil
+	}
+	serial, err := ours.Serial()
+	if err != nil {
+		return err
+	}
+	if theirs.SOA() != nil {
+		theirSerial, err := theirs.Serial()
+		if err != nil {
+			return err
+		}
+		if theirSerial.Greater(serial) {
+			serial = theirSerial
+		}
+	}
+	if serial, err = serial.Add(1); err != nil {
+		return err
+	}
+	_, _, err = merged.BumpSerial(SetSerial(serial))
+	return err
+}
+
+// Adds a comment about the conflict above the RRset, or at the end of the
+// zonefile if ours doesn't have it.
+func (z *Zonefile) markConflict(c MergeConflict, origin string) error {
+	lines := []string{"; CONFLICT: " + c.String() + "; theirs has:"}
+	for _, r := range c.Theirs {
+		lines = append(lines, ";   "+r.String())
+	}
+	if len(c.Theirs) == 0 {
+		lines = append(lines, ";   no records")
+	}
+
+	records, err := z.Records(origin)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if r.Zonefile == z && equalNames(r.Name, c.Name) &&
+			r.Type == c.Type && r.Class == c.Class {
+			r.Entry.addCommentLines(lines)
+			return nil
+		}
+	}
+	if !z.endsOnNewline() {
+		z.suffix = append(z.suffix, tttNewline.t)
+	}
+	for _, l := range lines {
+		z.suffix = append(z.suffix, token{typ: tokenComment, val: []byte(l)},
+			tttNewline.t)
+	}
+	return nil
+}
+
+// Adds comment lines right above the entry
+func (e *Entry) addCommentLines(lines []string) {
+	iStart := e.startOfLine()
+	tokens := append([]taggedToken{}, e.tokens[:iStart]...)
+	for _, l := range lines {
+		c := tttComment
+		c.t.val = []byte(l)
+		tokens = append(tokens, c, tttNewline)
+	}
+	e.tokens = append(tokens, e.tokens[iStart:]...)
+}
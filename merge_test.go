@@ -0,0 +1,110 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func ExampleMerge() {
+	load := func(s string) *zonefile.Zonefile {
+		zf, err := zonefile.Load([]byte(s))
+		if err != nil {
+			panic(err)
+		}
+		return zf
+	}
+	base := load(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 10 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.4
+`)
+	ours := load(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 11 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.5 ; moved
+`)
+	theirs := load(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 12 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.4
+mail IN A   1.2.3.6
+`)
+	merged, conflicts, err := zonefile.Merge(base, ours, theirs)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(len(conflicts), "conflicts")
+	fmt.Print(string(merged.Save()))
+	// Output:
+	// 0 conflicts
+	// $ORIGIN example.com.
+	// $TTL 3600
+	// @    IN SOA ns1 hostmaster 13 3600 600 604800 60
+	//      IN NS  ns1
+	// ns1  IN A   1.2.3.4
+	// www  IN A   1.2.3.5 ; moved
+	// mail IN A   1.2.3.6
+}
+
+func TestMergeConflict(t *testing.T) {
+	load := func(s string) *zonefile.Zonefile {
+		zf, err := zonefile.Load([]byte("$ORIGIN example.com.\n$TTL 60\n" +
+			"@ SOA ns1 hm 1 2 3 4 5\n" + s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zf
+	}
+	base := load("a A 1.2.3.4\nb A 1.2.3.4\nc A 1.2.3.4\n")
+	ours := load("a A 1.2.3.5\nb A 1.2.3.5\nc A 1.2.3.4\n")
+	theirs := load("a A 1.2.3.6\nb A 1.2.3.5\n")
+	merged, conflicts, err := zonefile.Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Name != "a.example.com." ||
+		len(conflicts[0].Theirs) != 1 {
+		t.Fatal("Unexpected conflicts:", conflicts)
+	}
+	expected := "$ORIGIN example.com.\n$TTL 60\n@ SOA ns1 hm 2 2 3 4 5\n" +
+		"; CONFLICT: conflicting changes to a.example.com. IN A; " +
+		"theirs has:\n" +
+		";   a.example.com. 60 IN A 1.2.3.6\n" +
+		"a A 1.2.3.5\nb A 1.2.3.5\n"
+	if string(merged.Save()) != expected {
+		t.Fatalf("Unexpected merge: %q", merged.Save())
+	}
+	if string(ours.Save()) == string(merged.Save()) {
+		t.Fatal("Ours was changed")
+	}
+}
+
+func TestMergeUnchanged(t *testing.T) {
+	load := func(s string) *zonefile.Zonefile {
+		zf, err := zonefile.Load([]byte("$ORIGIN example.com.\n$TTL 60\n" + s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return zf
+	}
+	base := load("@ SOA ns1 hm 1 2 3 4 5\na A 1.2.3.4\n")
+	ours := load("@ SOA ns1 hm 3 2 3 4 5\na A 1.2.3.5\n")
+	theirs := load("@ SOA ns1 hm 1 2 3 4 5\na A 1.2.3.4\n")
+
+	// Theirs has no changes, so we keep ours, serial and all
+	merged, conflicts, err := zonefile.Merge(base, ours, theirs)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatal(err, conflicts)
+	}
+	if string(merged.Save()) != string(ours.Save()) {
+		t.Fatalf("Unexpected merge: %q", merged.Save())
+	}
+}
@@ -0,0 +1,140 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Options for Entry.SetMultiline
+type MultilineOptions struct {
+	// Add comments with the names of the fields, such as "; serial",
+	// for those fields that don't have a comment yet.
+	Labels bool
+}
+
+// How the values of records of a certain type are split over lines
+type multilineLayout struct {
+	first  int      // number of values that stay on the first line
+	labels []string // names of the values that follow
+}
+
+var multilineLayouts = map[string]multilineLayout{
+	"SOA": {2, []string{"serial", "refresh", "retry", "expire", "minimum"}},
+	"RRSIG": {4, []string{"expiration", "inception", "key tag", "signer",
+		"signature"}},
+	"SIG": {4, []string{"expiration", "inception", "key tag", "signer",
+		"signature"}},
+	"DNSKEY":  {3, []string{"key"}},
+	"CDNSKEY": {3, []string{"key"}},
+	"KEY":     {3, []string{"key"}},
+	"DS":      {3, []string{"digest"}},
+	"CDS":     {3, []string{"digest"}},
+	"DLV":     {3, []string{"digest"}},
+	"TA":      {3, []string{"digest"}},
+	"TLSA":    {3, []string{"data"}},
+	"SMIMEA":  {3, []string{"data"}},
+	"NSEC3":   {4, nil},
+}
+
+// Renders the values of the entry over multiple lines in a parenthesised
+// group with one field per line, as is usual for SOA records:
+//
+//	@  IN SOA ns1.example.com. hostmaster.example.com. (
+//	          2019010101 ; serial
+//	          3600       ; refresh
+//	          ...
+//	          )
+//
+// Comments on the entry are kept with the value they follow.
+func (e *Entry) SetMultiline(opts MultilineOptions) error {
+	if e.isControl {
+		return errors.New("control entries can't be split over lines")
+	}
+	defer e.recount()()
+	is := e.find(useType)
+	if len(is) == 0 {
+		return errors.New("entry does not have a type")
+	}
+	iType := is[0]
+	iEnd := len(e.tokens)
+	if e.endsOnNewline() {
+		iEnd--
+	}
+
+	// Collect the values and the comments after them
+	var values []taggedToken
+	comments := make(map[int][]byte) // keyed by index of value (or -1)
+	var sep []byte
+	for i := iType + 1; i < iEnd; i++ {
+		tt := e.tokens[i]
+		switch {
+		case tt.u == useValue:
+			values = append(values, tt)
+		case tt.t.typ == tokenComment:
+			j := len(values) - 1
+			if c, ok := comments[j]; ok {
+				comments[j] = append(append(c, ' '), tt.t.val...)
+			} else {
+				comments[j] = tt.t.val
+			}
+		case i == iType+1 && tt.t.isInlineSpace():
+			sep = tt.t.val
+		}
+	}
+	s := e.style()
+	if sep == nil {
+		sep = s.separator(0, -1)
+	}
+
+	layout := multilineLayouts[string(e.Type())]
+	if layout.first > len(values) {
+		layout.first = len(values)
+	}
+
+	// The first line
+	tokens := append([]taggedToken{}, e.tokens[:iType+1]...)
+	tokens = append(tokens, newSpace(sep))
+	for _, v := range values[:layout.first] {
+		tokens = append(tokens, v, tttSpace)
+	}
+	tokens = append(tokens, tttLeftParen)
+	var firstComments [][]byte
+	for j := -1; j < layout.first; j++ {
+		if c, ok := comments[j]; ok {
+			firstComments = append(firstComments, c)
+		}
+	}
+	if len(firstComments) > 0 {
+		tComment := tttComment
+		tComment.t.val = bytes.Join(firstComments, []byte{' '})
+		tokens = append(tokens, tttSpace, tComment)
+	}
+
+	// Continuation lines are indented up to the first value
+	indent := []byte(padding(0, advance(e.column(iType+1), sep), s.useTabs))
+	newline := newSpace(append([]byte{'\n'}, indent...))
+
+	width := 0
+	for _, v := range values[layout.first:] {
+		if len(v.t.val) > width {
+			width = len(v.t.val)
+		}
+	}
+	for j := layout.first; j < len(values); j++ {
+		v := values[j]
+		tokens = append(tokens, newline, v)
+		comment, ok := comments[j]
+		if k := j - layout.first; !ok && opts.Labels && k < len(layout.labels) {
+			comment = []byte("; " + layout.labels[k])
+		}
+		if comment != nil {
+			tComment := tttComment
+			tComment.t.val = comment
+			tokens = append(tokens, newSpace([]byte(padding(
+				len(v.t.val), width+1, false))), tComment)
+		}
+	}
+	tokens = append(tokens, newline, tttRightParen)
+	e.tokens = append(tokens, e.tokens[iEnd:]...)
+	return nil
+}
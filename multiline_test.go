@@ -0,0 +1,81 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"reflect"
+	"testing"
+)
+
+func TestSetMultiline(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"@ IN SOA ns1.example.com. hostmaster.example.com. " +
+			"1 3600 600 604800 60 ; the SOA\n" +
+			"www IN A 1.2.3.4\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	values := zf.Entries()[0].Values()
+	if err := zf.Entries()[0].SetMultiline(
+		zonefile.MultilineOptions{Labels: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "@ IN SOA ns1.example.com. hostmaster.example.com. (\n" +
+		"         1      ; serial\n" +
+		"         3600   ; refresh\n" +
+		"         600    ; retry\n" +
+		"         604800 ; expire\n" +
+		"         60     ; the SOA\n" +
+		"         )\n" +
+		"www IN A 1.2.3.4\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+
+	zf2, err := zonefile.Load(zf.Save())
+	if err != nil {
+		t.Fatal("Couldn't parse result:", err)
+	}
+	if !reflect.DeepEqual(zf2.Entries()[0].Values(), values) {
+		t.Fatal("Values changed:", zf2.Entries()[0].Values())
+	}
+	if len(zf2.Entries()) != 2 {
+		t.Fatal("Number of entries changed")
+	}
+}
+
+func TestSetMultilineKeepsComments(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"@\tIN\tSOA\tns1 hostmaster ( ; apex\n" +
+			"\t\t\t1 ; version\n" +
+			"\t\t\t2 3 4 5 )\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	zf.Entries()[0].SetMultiline(zonefile.MultilineOptions{})
+	expected := "@\tIN\tSOA\tns1 hostmaster ( ; apex\n" +
+		"\t\t\t1 ; version\n" +
+		"\t\t\t2\n" +
+		"\t\t\t3\n" +
+		"\t\t\t4\n" +
+		"\t\t\t5\n" +
+		"\t\t\t)\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
+
+func ExampleEntry_SetMultiline() {
+	z := zonefile.New()
+	entry, _ := zonefile.ParseEntry([]byte(
+		"@ IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 604800 60"))
+	z.AddEntry(entry).SetMultiline(zonefile.MultilineOptions{Labels: true})
+	fmt.Println(string(z.Save()))
+	// Output: @ IN SOA ns1.example.com. hostmaster.example.com. (
+	//          1      ; serial
+	//          3600   ; refresh
+	//          600    ; retry
+	//          604800 ; expire
+	//          60     ; minimum
+	//          )
+}
@@ -0,0 +1,93 @@
+package zonefile
+
+import (
+	"bytes"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"strings"
+)
+
+// Checks whether the domain name is absolute, that is: whether it ends
+// on an unescaped dot.
+func isAbsolute(name string) bool {
+	return len(name) > 0 && name[len(name)-1] == '.' &&
+		!isEscaped(name, len(name)-1)
+}
+
+// Checks whether the character at index i of s is escaped by a backslash
+func isEscaped(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// Returns the domain name as an absolute name with respect to the origin.
+// If the origin is unknown, the name is returned as is.
+func absoluteName(name, origin string) string {
+	if name == "@" {
+		if origin == "" {
+			return name
+		}
+		return origin
+	}
+	if isAbsolute(name) || origin == "" {
+		return name
+	}
+	if origin == "." {
+		return name + "."
+	}
+	return name + "." + origin
+}
+
+// Returns the absolute domain name relative to the origin, if it's
+// within the origin.  The origin itself is returned as "@".
+func relativeName(name, origin string) string {
+	if origin == "" {
+		return name
+	}
+	if equalNames(name, origin) {
+		return "@"
+	}
+	if origin == "." || !isAbsolute(name) {
+		return name
+	}
+	suffix := "." + origin
+	i := len(name) - len(suffix)
+	if i <= 0 || !strings.EqualFold(name[i:], suffix) || isEscaped(name, i) {
+		return name
+	}
+	return name[:i]
+}
+
+// Compares two domain names case-insensitively
+func equalNames(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// Compares two absolute domain names in the canonical order of RFC 4034,
+// that is: label by label from the root.  Returns -1, 0 or 1.
+func compareNames(a, b string) int {
+	la, errA := wire.SplitName(a)
+	lb, errB := wire.SplitName(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	for i, j := len(la)-1, len(lb)-1; i >= 0 || j >= 0; i, j = i-1, j-1 {
+		if i < 0 {
+			return -1
+		}
+		if j < 0 {
+			return 1
+		}
+		if c := bytes.Compare(bytes.ToLower(la[i]),
+			bytes.ToLower(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,191 @@
+package zonefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The defaults for NotifyOptions
+const (
+	defaultNotifyAttempts = 5
+	defaultNotifyTimeout  = 2 * time.Second
+)
+
+// Options for SendNotify
+type NotifyOptions struct {
+	// The origin of the zone, if the zonefile doesn't start with $ORIGIN
+	Origin string
+
+	// The servers to notify: hosts or IP addresses, optionally with a
+	// port.  If there are none, the nameservers in the NS records of the
+	// zone are notified, except the primary in the SOA record.
+	Servers []string
+
+	// How many times a NOTIFY message is sent to a server that doesn't
+	// respond; 5 if zero.
+	Attempts int
+
+	// How long to wait for a response to each attempt; 2s if zero.
+	Timeout time.Duration
+}
+
+// The servers that didn't acknowledge a NOTIFY message, with the reason
+type NotifyError map[string]error
+
+func (e NotifyError) Error() string {
+	servers := make([]string, 0, len(e))
+	for server := range e {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	msgs := make([]string, len(servers))
+	for i, server := range servers {
+		msgs[i] = fmt.Sprintf("%s: %v", server, e[server])
+	}
+	return "NOTIFY failed for " + strings.Join(msgs, "; ")
+}
+
+// Tells the secondaries of the zone that it changed, with NOTIFY messages
+// (RFC 1996), so that they transfer it right away.  The messages are sent
+// to all servers at once and are sent again to those that don't respond.
+// If a server isn't given by address, the addresses of the nameserver in
+// the zone are used if there are any.  Returns a NotifyError if some
+// servers didn't acknowledge the message.
+func SendNotify(ctx context.Context, z *Zonefile, opts NotifyOptions) error {
+	records, err := z.Records(opts.Origin)
+	if err != nil {
+		return err
+	}
+	var soa *Record
+	for i, r := range records {
+		if r.Type == "SOA" {
+			soa = &records[i]
+			break
+		}
+	}
+	if soa == nil {
+		return errors.New("zone has no SOA record")
+	}
+	soaRR, err := soa.wire()
+	if err != nil {
+		return err
+	}
+	msg, err := (&wire.Message{
+		ID:            wire.NewID(),
+		Opcode:        wire.OpcodeNotify,
+		Authoritative: true,
+		Question: []wire.Question{{Name: soa.Name, Type: wire.TypeSOA,
+			Class: soaRR.Class}},
+		Answer: []wire.RR{soaRR},
+	}).Pack()
+	if err != nil {
+		return err
+	}
+
+	servers := opts.Servers
+	if len(servers) == 0 {
+		servers = notifyTargets(records, soa)
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = defaultNotifyAttempts
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultNotifyTimeout
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make(NotifyError)
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server string) {
+			defer wg.Done()
+			if err := notify(ctx, server, msg, opts); err != nil {
+				mu.Lock()
+				failed[server] = err
+				mu.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// Returns the nameservers of the zone other than the primary, by the
+// addresses in the zone if it has them and by name otherwise.
+func notifyTargets(records []Record, soa *Record) (servers []string) {
+	addrs := make(map[string][]string)
+	for _, r := range records {
+		if (r.Type == "A" || r.Type == "AAAA") && len(r.Values) == 1 {
+			name := strings.ToLower(r.Name)
+			addrs[name] = append(addrs[name], r.Values[0])
+		}
+	}
+	primary := ""
+	if len(soa.Values) > 0 {
+		primary = strings.ToLower(soa.Values[0])
+	}
+	seen := make(map[string]bool)
+	for _, r := range records {
+		if r.Type != "NS" || len(r.Values) != 1 ||
+			!strings.EqualFold(r.Name, soa.Name) {
+			continue
+		}
+		target := strings.ToLower(r.Values[0])
+		if target == primary || seen[target] {
+			continue
+		}
+		seen[target] = true
+		if len(addrs[target]) > 0 {
+			servers = append(servers, addrs[target]...)
+		} else {
+			servers = append(servers, target)
+		}
+	}
+	return servers
+}
+
+// Sends the NOTIFY message to the server until it responds
+func notify(ctx context.Context, server string, msg []byte,
+	opts NotifyOptions) error {
+	var err error
+	for i := 0; i < opts.Attempts; i++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		var resp *wire.Message
+		resp, err = wire.Exchange(attemptCtx, server, msg)
+		if err == nil {
+			cancel()
+			switch {
+			case resp.Opcode != wire.OpcodeNotify:
+				return errors.New("response is not a NOTIFY response")
+			case resp.Rcode != wire.RcodeSuccess:
+				return fmt.Errorf("server responded with %v",
+					Rcode(resp.Rcode))
+			}
+			return nil
+		}
+		if ne, ok := err.(*net.OpError); ok && ne.Op == "dial" {
+			cancel()
+			return err
+		}
+
+		// Wait out the attempt before trying again, also if the server
+		// isn't listening (yet).
+		<-attemptCtx.Done()
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return err
+}
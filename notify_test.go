@@ -0,0 +1,80 @@
+package zonefile_test
+
+import (
+	"context"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"testing"
+	"time"
+)
+
+// Answers NOTIFY messages, except the first few, and sends their serials
+// on the channel.
+func serveNotify(conn net.PacketConn, drop int, serials chan<- uint32) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		q, err := wire.Unpack(buf[:n])
+		if err != nil || q.Opcode != wire.OpcodeNotify || len(q.Answer) != 1 {
+			continue
+		}
+		serials <- wire.SOASerial(q.Answer[0])
+		if drop > 0 {
+			drop--
+			continue
+		}
+		resp, _ := (&wire.Message{ID: q.ID, Response: true,
+			Opcode: q.Opcode, Authoritative: true,
+			Question: q.Question}).Pack()
+		conn.WriteTo(resp, addr)
+	}
+}
+
+func TestSendNotify(t *testing.T) {
+	zf, err := zonefile.Load([]byte(primaryZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err2 := net.ListenPacket("udp", "127.0.0.1:0")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	defer conn.Close()
+	serials := make(chan uint32, 10)
+	go serveNotify(conn, 2, serials)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err2 = zonefile.SendNotify(ctx, zf, zonefile.NotifyOptions{
+		Servers: []string{conn.LocalAddr().String()},
+		Timeout: 100 * time.Millisecond,
+	})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if len(serials) != 3 {
+		t.Fatalf("sent %d NOTIFY messages instead of 3", len(serials))
+	}
+	if serial := <-serials; serial != 1 {
+		t.Fatalf("NOTIFY has serial %d", serial)
+	}
+
+	// Gives up after the attempts if the server doesn't respond
+	silent, err2 := net.ListenPacket("udp", "127.0.0.1:0")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	defer silent.Close()
+	err2 = zonefile.SendNotify(ctx, zf, zonefile.NotifyOptions{
+		Servers:  []string{silent.LocalAddr().String()},
+		Timeout:  100 * time.Millisecond,
+		Attempts: 1,
+	})
+	if ne, ok := err2.(zonefile.NotifyError); !ok || len(ne) != 1 {
+		t.Fatalf("expected a NotifyError, not %v", err2)
+	}
+}
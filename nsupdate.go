@@ -0,0 +1,216 @@
+package zonefile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"strings"
+)
+
+// Options for NSUpdateScript, UpdateMessage and SendUpdate
+type UpdateOptions struct {
+	// The origin of the zone, if the zonefiles don't start with $ORIGIN
+	Origin string
+
+	// The server to put in the script, if any
+	Server string
+
+	// Leave out the prerequisites that make sure each changed RRset is
+	// still as in the old zonefile.
+	NoPrerequisites bool
+}
+
+// An update of a zone that turns one version into another
+type updatePlan struct {
+	zone  string // the apex
+	class string
+
+	// The RRsets the update changes, with their records in the old
+	// version, which are none if the RRset must not exist.
+	prereqs []updatePrereq
+
+	deletes []*Record
+	adds    []*Record
+}
+
+type updatePrereq struct {
+	name, class, typ string
+	records          []Record
+}
+
+// Works out the update that turns the old version of a zone into the new
+// one, using Diff.
+func planUpdate(old, new *Zonefile, opts UpdateOptions) (*updatePlan,
+	error) {
+	changes, err := DiffOrigin(old, new, opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+	oldRecords, err := old.Records(opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+	newRecords, err := new.Records(opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &updatePlan{}
+	for _, records := range [][]Record{newRecords, oldRecords} {
+		for _, r := range records {
+			if r.Type == "SOA" && p.zone == "" {
+				p.zone, p.class = r.Name, r.Class
+			}
+		}
+	}
+	if p.zone == "" {
+		return nil, errors.New("zone has no SOA record")
+	}
+
+	rrsets := make(map[rrsetKey][]Record)
+	for _, r := range oldRecords {
+		k := recordKeyOf(&r).rrsetKey
+		rrsets[k] = append(rrsets[k], r)
+	}
+	guarded := make(map[rrsetKey]bool)
+	for _, c := range changes {
+		r := c.record()
+		// The server takes care of the serial, and only accepts a new SOA
+		// record if its serial is greater, so there is nothing to guard.
+		if k := recordKeyOf(r).rrsetKey; !guarded[k] && r.Type != "SOA" {
+			guarded[k] = true
+			p.prereqs = append(p.prereqs, updatePrereq{r.Name, r.Class,
+				r.Type, rrsets[k]})
+		}
+		if c.Old != nil && r.Type != "SOA" {
+			p.deletes = append(p.deletes, c.Old)
+		}
+		if c.New != nil {
+			p.adds = append(p.adds, c.New)
+		}
+	}
+	if opts.NoPrerequisites {
+		p.prereqs = nil
+	}
+	return p, nil
+}
+
+// Returns an nsupdate script that turns the old version of a zone into the
+// new one.  Unless turned off in the options, the script has prerequisites
+// that make sure each RRset it changes is still as in the old version, so
+// that the update fails if someone else changed it in the meantime.
+//
+// The SOA record is only added if it changed; a server accepts it if its
+// serial is greater and otherwise increments the serial itself.
+func NSUpdateScript(old, new *Zonefile, opts UpdateOptions) (string,
+	error) {
+	p, err := planUpdate(old, new, opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if opts.Server != "" {
+		if host, port, err := net.SplitHostPort(opts.Server); err == nil {
+			fmt.Fprintf(&b, "server %s %s\n", host, port)
+		} else {
+			fmt.Fprintf(&b, "server %s\n", opts.Server)
+		}
+	}
+	fmt.Fprintf(&b, "zone %s\n", p.zone)
+	if p.class != "IN" {
+		fmt.Fprintf(&b, "class %s\n", p.class)
+	}
+	for _, pr := range p.prereqs {
+		if len(pr.records) == 0 {
+			fmt.Fprintf(&b, "prereq nxrrset %s %s %s\n", pr.name, pr.class,
+				pr.typ)
+		}
+		for _, r := range pr.records {
+			fmt.Fprintf(&b, "prereq yxrrset %s %s %s %s\n", r.Name, r.Class,
+				r.Type, strings.Join(r.Values, " "))
+		}
+	}
+	for _, r := range p.deletes {
+		fmt.Fprintf(&b, "update delete %s %s %s %s\n", r.Name, r.Class,
+			r.Type, strings.Join(r.Values, " "))
+	}
+	for _, r := range p.adds {
+		fmt.Fprintf(&b, "update add %s\n", r)
+	}
+	b.WriteString("send\n")
+	return b.String(), nil
+}
+
+// Returns a DNS UPDATE message (RFC 2136) in wire format that turns the
+// old version of a zone into the new one, with the same prerequisites and
+// updates as the script returned by NSUpdateScript.  The message has a
+// random ID.
+func UpdateMessage(old, new *Zonefile, opts UpdateOptions) ([]byte,
+	error) {
+	p, err := planUpdate(old, new, opts)
+	if err != nil {
+		return nil, err
+	}
+	class, ok := classCode(p.class)
+	if !ok {
+		return nil, fmt.Errorf("unknown class %s", p.class)
+	}
+	m := wire.Message{
+		ID:       wire.NewID(),
+		Opcode:   wire.OpcodeUpdate,
+		Question: []wire.Question{{Name: p.zone, Type: wire.TypeSOA, Class: class}},
+	}
+	for _, pr := range p.prereqs {
+		if len(pr.records) == 0 {
+			typ, _ := typeCode(pr.typ)
+			m.Answer = append(m.Answer, wire.RR{Name: pr.name, Type: typ,
+				Class: wire.ClassNONE})
+		}
+		for _, r := range pr.records {
+			rr, err := r.wire()
+			if err != nil {
+				return nil, err
+			}
+			rr.TTL = 0
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	for _, r := range p.deletes {
+		rr, err := r.wire()
+		if err != nil {
+			return nil, err
+		}
+		rr.Class, rr.TTL = wire.ClassNONE, 0
+		m.Authority = append(m.Authority, rr)
+	}
+	for _, r := range p.adds {
+		rr, err := r.wire()
+		if err != nil {
+			return nil, err
+		}
+		m.Authority = append(m.Authority, rr)
+	}
+	return m.Pack()
+}
+
+// Sends a DNS UPDATE message, as returned by UpdateMessage, to the server
+// and returns the response code.  The server is a host or IP address,
+// optionally with a port.  An error is returned if there is no valid
+// response; a response code other than RcodeNoError is not an error.
+func SendUpdate(ctx context.Context, server string, old, new *Zonefile,
+	opts UpdateOptions) (Rcode, error) {
+	msg, err := UpdateMessage(old, new, opts)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := wire.Exchange(ctx, server, msg)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Opcode != wire.OpcodeUpdate {
+		return 0, errors.New("response is not an UPDATE response")
+	}
+	return Rcode(resp.Rcode), nil
+}
@@ -0,0 +1,134 @@
+package zonefile_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+const nsupdateOld = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.4
+`
+
+const nsupdateNew = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 2 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.5
+mail IN A   1.2.3.6
+`
+
+func ExampleNSUpdateScript() {
+	old, err := zonefile.Load([]byte(nsupdateOld))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	new, err := zonefile.Load([]byte(nsupdateNew))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	script, err2 := zonefile.NSUpdateScript(old, new, zonefile.UpdateOptions{
+		Server: "192.0.2.1:5353",
+	})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	fmt.Print(script)
+	// Output:
+	// server 192.0.2.1 5353
+	// zone example.com.
+	// prereq nxrrset mail.example.com. IN A
+	// prereq yxrrset www.example.com. IN A 1.2.3.4
+	// update delete www.example.com. IN A 1.2.3.4
+	// update add example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2 3600 600 604800 60
+	// update add mail.example.com. 3600 IN A 1.2.3.6
+	// update add www.example.com. 3600 IN A 1.2.3.5
+	// send
+}
+
+// Answers UPDATE messages by applying them to the zonefile, until the
+// connection is closed.
+func serveUpdates(conn net.PacketConn, zf *zonefile.Zonefile,
+	mux *sync.Mutex) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		mux.Lock()
+		rcode, err := zf.ApplyUpdate(buf[:n], zonefile.ApplyOptions{})
+		mux.Unlock()
+		if err != nil {
+			rcode = zonefile.RcodeServFail
+		}
+		resp, err := zonefile.UpdateResponse(buf[:n], rcode)
+		if err == nil {
+			conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func TestSendUpdate(t *testing.T) {
+	old, err := zonefile.Load([]byte(nsupdateOld))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := zonefile.Load([]byte(nsupdateNew))
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary, err := zonefile.Load([]byte(nsupdateOld))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err2 := net.ListenPacket("udp", "127.0.0.1:0")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	defer conn.Close()
+	var mux sync.Mutex
+	go serveUpdates(conn, primary, &mux)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	rcode, err2 := zonefile.SendUpdate(ctx, conn.LocalAddr().String(), old,
+		new, zonefile.UpdateOptions{})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if rcode != zonefile.RcodeNoError {
+		t.Fatalf("got %v", rcode)
+	}
+	mux.Lock()
+	changes, err2 := zonefile.Diff(primary, new)
+	mux.Unlock()
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("primary differs from new zone: %v", changes)
+	}
+
+	// The prerequisites no longer hold
+	rcode, err2 = zonefile.SendUpdate(ctx, conn.LocalAddr().String(), old,
+		new, zonefile.UpdateOptions{})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if rcode != zonefile.RcodeYXRRSet {
+		t.Fatalf("got %v instead of YXRRSET", rcode)
+	}
+}
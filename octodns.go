@@ -0,0 +1,446 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/yaml"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The TTL OctoDNS gives records without one
+const octoDNSDefaultTTL = 3600
+
+// Options for ExportOctoDNS and ImportOctoDNS
+type OctoDNSOptions struct {
+	// The origin of the zone, as for Records.  OctoDNS configurations are
+	// relative to the zone, so it's needed to import one.  When exporting,
+	// the owner of the SOA record is used if it's empty.
+	Origin string
+
+	// The values of an SOA record to put at the apex when importing, such
+	// as "ns1 hostmaster 1 3600 600 604800 60", as OctoDNS leaves the SOA
+	// record to the provider.  There is none if it's empty.
+	SOA string
+}
+
+// The names of the fields of the values of the record types that OctoDNS
+// has a structure for.  The fields are in the order of the zonefile.
+var octoDNSFields = map[string][]string{
+	"MX":    {"preference", "exchange"},
+	"SRV":   {"priority", "weight", "port", "target"},
+	"CAA":   {"flags", "tag", "value"},
+	"NAPTR": {"order", "preference", "flags", "service", "regexp", "replacement"},
+	"SSHFP": {"algorithm", "fingerprint_type", "fingerprint"},
+	"TLSA": {"certificate_usage", "selector", "matching_type",
+		"certificate_association_data"},
+	"DS": {"key_tag", "algorithm", "digest_type", "digest"},
+}
+
+// The record types whose values OctoDNS keeps as strings
+var octoDNSStrings = map[string]bool{
+	"A": true, "AAAA": true, "CNAME": true, "DNAME": true, "NS": true,
+	"PTR": true, "TXT": true, "SPF": true,
+}
+
+// An RRset as OctoDNS has it
+type octoDNSRecord struct {
+	name   string // relative to the origin; empty for the apex
+	typ    string
+	ttl    int
+	values []*yaml.Node
+}
+
+// Returns the records of the zone as an OctoDNS zone configuration in
+// YAML: the records are grouped by their name relative to the origin and
+// their type, with a single value as "value" and several as "values".
+// MX, SRV, CAA, NAPTR, SSHFP, TLSA and DS records have structured values.
+// The character-strings of TXT and SPF records are joined when that loses
+// nothing, and kept as quoted chunks otherwise.
+//
+// The SOA record is left out, as OctoDNS leaves it to the provider.  An
+// error is returned for records of other types, records outside the zone
+// or of another class than IN, and RRsets whose records have different
+// TTLs.
+func ExportOctoDNS(z *Zonefile, opts OctoDNSOptions) ([]byte, error) {
+	records, err := z.Records(opts.Origin)
+	if err != nil {
+		return nil, err
+	}
+	origin := opts.Origin
+	for _, r := range records {
+		if r.Type == "SOA" && origin == "" {
+			origin = r.Name
+		}
+	}
+	if origin == "" {
+		return nil, errors.New("origin of the zone is unknown")
+	}
+
+	var rrsets []*octoDNSRecord
+	byKey := make(map[string]*octoDNSRecord)
+	for _, r := range records {
+		if r.Type == "SOA" {
+			continue
+		}
+		name := strings.ToLower(relativeName(r.Name, origin))
+		if name == "@" {
+			name = ""
+		} else if isAbsolute(name) {
+			return nil, fmt.Errorf("%s is outside the zone %s", r.Name, origin)
+		}
+		if r.Class != "IN" {
+			return nil, fmt.Errorf("%s %s: OctoDNS only has class IN",
+				r.Name, r.Type)
+		}
+		value, err := octoDNSValue(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", r.Name, r.Type, err)
+		}
+		key := name + " " + r.Type
+		rrset := byKey[key]
+		if rrset == nil {
+			rrset = &octoDNSRecord{name: name, typ: r.Type, ttl: r.TTL}
+			byKey[key] = rrset
+			rrsets = append(rrsets, rrset)
+		} else if rrset.ttl != r.TTL {
+			return nil, fmt.Errorf("%s %s: records have different TTLs",
+				r.Name, r.Type)
+		}
+		rrset.values = append(rrset.values, value)
+	}
+
+	sort.SliceStable(rrsets, func(i, j int) bool {
+		a, b := rrsets[i], rrsets[j]
+		if a.name != b.name {
+			return naturalLess(a.name, b.name)
+		}
+		return a.typ < b.typ
+	})
+	root := &yaml.Node{Kind: yaml.Mapping}
+	for _, rrset := range rrsets {
+		n := &yaml.Node{Kind: yaml.Mapping}
+		n.Set("ttl", yaml.Int(rrset.ttl))
+		n.Set("type", yaml.String(rrset.typ))
+		if len(rrset.values) == 1 {
+			n.Set("value", rrset.values[0])
+		} else {
+			n.Set("values", &yaml.Node{Kind: yaml.Sequence,
+				Items: rrset.values})
+		}
+		existing := root.Get(rrset.name)
+		switch {
+		case existing == nil:
+			root.Set(rrset.name, n)
+		case existing.Kind == yaml.Mapping:
+			root.Values[len(root.Values)-1] = &yaml.Node{
+				Kind: yaml.Sequence, Items: []*yaml.Node{existing, n}}
+		default:
+			existing.Items = append(existing.Items, n)
+		}
+	}
+	return yaml.Marshal(root), nil
+}
+
+// Returns the value of the record as OctoDNS has it
+func octoDNSValue(r Record) (*yaml.Node, error) {
+	if r.Type == "TXT" || r.Type == "SPF" {
+		return octoDNSText(r.Values)
+	}
+	if octoDNSStrings[r.Type] {
+		return yaml.String(strings.Join(r.Values, " ")), nil
+	}
+	names, ok := octoDNSFields[r.Type]
+	if !ok {
+		return nil, errors.New("OctoDNS has no such records")
+	}
+	kinds := rdataFields[r.Type]
+	if len(r.Values) < len(kinds) {
+		return nil, errors.New("missing values")
+	}
+	n := &yaml.Node{Kind: yaml.Mapping}
+	for i, kind := range kinds {
+		v := r.Values[i]
+		switch kind {
+		case fieldUint8, fieldUint16:
+			number, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			n.Set(names[i], yaml.Int(number))
+		case fieldString:
+			decoded, err := decodeString([]byte(v))
+			if err != nil {
+				return nil, err
+			}
+			n.Set(names[i], yaml.String(string(decoded)))
+		case fieldHex:
+			n.Set(names[i], yaml.String(strings.Join(r.Values[i:], "")))
+		default:
+			n.Set(names[i], yaml.String(v))
+		}
+	}
+	n.SortKeys()
+	return n, nil
+}
+
+// Returns the character-strings of a TXT or SPF record as an OctoDNS
+// value.  They're joined if ImportOctoDNS would split the text into the
+// same strings again, and written as quoted chunks, as in "a" "b",
+// otherwise.  Semicolons are escaped either way, as OctoDNS wants them.
+func octoDNSText(values []string) (*yaml.Node, error) {
+	var text []byte
+	strs := make([][]byte, len(values))
+	chunked := false
+	for i, v := range values {
+		s, err := decodeString([]byte(v))
+		if err != nil {
+			return nil, err
+		}
+		if i < len(values)-1 && len(s) != 255 || i > 0 && len(s) == 0 {
+			chunked = true
+		}
+		strs[i] = s
+		text = append(text, s...)
+	}
+	if chunked || bytes.HasPrefix(text, []byte(`"`)) {
+		chunks := make([]string, len(strs))
+		for i, s := range strs {
+			chunks[i] = quoteString(s)
+		}
+		text = []byte(strings.Join(chunks, " "))
+	}
+	return yaml.String(strings.Replace(string(text), ";", `\;`, -1)), nil
+}
+
+// Compares names as OctoDNS orders them, with numbers in order of their
+// value.
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := digits(a), digits(b)
+			x, y := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(x) != len(y) {
+				return len(x) < len(y)
+			}
+			if x != y {
+				return x < y
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// Returns the number of digits at the start of the string
+func digits(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+// Creates a zonefile from an OctoDNS zone configuration in YAML, as
+// written by ExportOctoDNS.  The zonefile starts with $ORIGIN, and with
+// an SOA record if its values are in the options.  Records without TTL
+// get 3600, as in OctoDNS.  Keys OctoDNS uses for other purposes, such as
+// "octodns", are ignored.
+//
+// Names and values must be what a zonefile would have as a single item,
+// except for the text of TXT and SPF records, which is quoted as needed.
+// Errors are returned with the YAML line, or the name and type of the
+// record they're about.
+func ImportOctoDNS(data []byte, opts OctoDNSOptions) (*Zonefile, error) {
+	origin := opts.Origin
+	if origin == "" {
+		return nil, errors.New("origin of the zone is needed")
+	}
+	if !isAbsolute(origin) {
+		origin += "."
+	}
+	root, err := yaml.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.IsNull() {
+		root = &yaml.Node{Kind: yaml.Mapping}
+	}
+	if root.Kind != yaml.Mapping {
+		return nil, errors.New("zone configuration is not a mapping")
+	}
+
+	var lines, labels []string
+	if opts.SOA != "" {
+		ttl := octoDNSDefaultTTL
+		lines = append(lines, recordLine(origin, origin, &ttl, "IN", "SOA",
+			strings.Fields(opts.SOA)))
+		labels = append(labels, "SOA record")
+	}
+	for i, name := range root.Keys {
+		n := root.Values[i]
+		items := []*yaml.Node{n}
+		if n.Kind == yaml.Sequence {
+			items = n.Items
+		}
+		owner := origin
+		if name != "" {
+			if err := checkName(name); err != nil {
+				return nil, fmt.Errorf("line %d: %v", n.Line, err)
+			}
+			owner = name + "." + origin
+		}
+		for _, item := range items {
+			typ, ttl, values, err := octoDNSRecordValues(item)
+			label := fmt.Sprintf("'%s' %s", name, typ)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s: %v", item.Line, label,
+					err)
+			}
+			for _, v := range values {
+				lines = append(lines, recordLine(origin, owner, &ttl, "IN",
+					typ, v))
+				labels = append(labels, label)
+			}
+		}
+	}
+
+	z, perr := formattedZonefile(origin, lines)
+	if perr != nil {
+		if i := perr.LineNo(); i >= 0 && i < len(labels) {
+			return nil, fmt.Errorf("%s: %v", labels[i], perr)
+		}
+		return nil, perr
+	}
+	if _, err := z.Records(""); err != nil {
+		if perr, ok := err.(ParsingError); ok && perr.LineNo() > 0 &&
+			perr.LineNo() <= len(labels) {
+			return nil, fmt.Errorf("%s: %v", labels[perr.LineNo()-1], perr)
+		}
+		return nil, err
+	}
+	return z, nil
+}
+
+// Returns the type, the TTL and the values of each record of an OctoDNS
+// record.
+func octoDNSRecordValues(n *yaml.Node) (typ string, ttl int,
+	values [][]string, err error) {
+	if n.Kind != yaml.Mapping {
+		return "", 0, nil, errors.New("record is not a mapping")
+	}
+	if t := n.Get("type"); t != nil && t.Kind == yaml.Scalar {
+		typ = strings.ToUpper(t.Value)
+	}
+	if typ == "" {
+		return "", 0, nil, errors.New("record has no type")
+	}
+	ttl = octoDNSDefaultTTL
+	if t := n.Get("ttl"); t != nil {
+		if ttl, err = strconv.Atoi(t.Value); err != nil || ttl < 0 {
+			return typ, 0, nil, fmt.Errorf("invalid TTL %q", t.Value)
+		}
+	}
+	var items []*yaml.Node
+	if v := n.Get("values"); v != nil && v.Kind == yaml.Sequence {
+		items = v.Items
+	} else if v != nil {
+		items = []*yaml.Node{v}
+	} else if v := n.Get("value"); v != nil {
+		items = []*yaml.Node{v}
+	}
+	if len(items) == 0 {
+		return typ, 0, nil, errors.New("record has no values")
+	}
+	for _, item := range items {
+		v, err := octoDNSZonefileValues(typ, item)
+		if err != nil {
+			return typ, 0, nil, err
+		}
+		values = append(values, v)
+	}
+	return typ, ttl, values, nil
+}
+
+// Returns the values, as in a zonefile, of an OctoDNS value
+func octoDNSZonefileValues(typ string, n *yaml.Node) ([]string, error) {
+	if octoDNSStrings[typ] {
+		if n.Kind != yaml.Scalar || n.IsNull() {
+			return nil, errors.New("value is not a string")
+		}
+		if typ != "TXT" && typ != "SPF" {
+			if err := checkItem(n.Value); err != nil {
+				return nil, err
+			}
+			return []string{n.Value}, nil
+		}
+		if strings.HasPrefix(n.Value, `"`) {
+			return octoDNSChunks(n.Value)
+		}
+		// Character-strings are at most 255 octets long
+		s := strings.Replace(n.Value, `\;`, ";", -1)
+		var values []string
+		for len(s) > 255 {
+			values = append(values, quoteString([]byte(s[:255])))
+			s = s[255:]
+		}
+		return append(values, quoteString([]byte(s))), nil
+	}
+
+	names, ok := octoDNSFields[typ]
+	if !ok {
+		return nil, errors.New("unsupported type")
+	}
+	if n.Kind != yaml.Mapping {
+		return nil, errors.New("value is not a mapping")
+	}
+	kinds := rdataFields[typ]
+	var values []string
+	for i, name := range names {
+		field := n.Get(name)
+		// Older versions of OctoDNS had other names for MX values
+		if field == nil && typ == "MX" {
+			field = n.Get(map[string]string{"preference": "priority",
+				"exchange": "value"}[name])
+		}
+		if field == nil || field.Kind != yaml.Scalar || field.IsNull() {
+			return nil, fmt.Errorf("value has no %s", name)
+		}
+		if kinds[i] == fieldString {
+			values = append(values, quoteString([]byte(field.Value)))
+			continue
+		}
+		if err := checkItem(field.Value); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		values = append(values, field.Value)
+	}
+	return values, nil
+}
+
+// Returns the quoted chunks of a TXT or SPF value, as in "a" "b", as
+// values of a zonefile
+func octoDNSChunks(s string) ([]string, error) {
+	var values []string
+	var err error
+	for t := range lex([]byte(s)).tokens {
+		switch {
+		case err != nil || t.typ == tokenWhiteSpace || t.typ == tokenEOF:
+		case t.typ != tokenQuotedItem:
+			err = fmt.Errorf("invalid quoted chunks %q", s)
+		default:
+			var chunk []byte
+			if chunk, err = decodeString(t.val); err == nil {
+				values = append(values, quoteString(chunk))
+			}
+		}
+	}
+	return values, err
+}
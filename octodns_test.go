@@ -0,0 +1,181 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"strings"
+	"testing"
+)
+
+var octoDNSZone = `$ORIGIN example.com.
+$TTL 3600
+@       IN SOA   ns1 hostmaster 1 3600 600 604800 60
+        IN NS    ns1
+        IN NS    ns2.example.org.
+        IN MX    10 mail
+        IN MX    20 mail.example.org.
+        IN TXT   "v=spf1 mx -all"
+        IN CAA   0 issue "letsencrypt.org; validationmethods=dns-01"
+ns1     IN A     192.0.2.1
+mail    IN A     192.0.2.2
+        IN AAAA  2001:db8::2
+www 300 IN CNAME @
+*.dyn   IN A     192.0.2.3
+_sip._tcp IN SRV 10 60 5060 sip
+sip     IN A     192.0.2.4
+host2   IN A     192.0.2.5
+host10  IN A     192.0.2.6
+host10  IN SSHFP 1 1 0123456789abcdef0123 456789abcdef01234567
+_443._tcp.www IN TLSA 3 1 1 0123456789ABCDEF
+multi   IN TXT   "a;" "b"
+quoted  IN TXT   "\"q\""
+long    IN TXT   "` + strings.Repeat("a", 255) + `" "` + strings.Repeat("b", 10) + `"
+`
+
+func ExampleExportOctoDNS() {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+@   3600 IN SOA ns1 hostmaster 1 3600 600 604800 60
+@   3600 IN NS  ns1
+@   3600 IN MX  10 mail
+www 300  IN A   192.0.2.1
+www 300  IN A   192.0.2.2
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	data, err2 := zonefile.ExportOctoDNS(zf, zonefile.OctoDNSOptions{})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	fmt.Print(string(data))
+	// Output:
+	// ---
+	// '':
+	// - ttl: 3600
+	//   type: MX
+	//   value:
+	//     exchange: mail.example.com.
+	//     preference: 10
+	// - ttl: 3600
+	//   type: NS
+	//   value: ns1.example.com.
+	// www:
+	//   ttl: 300
+	//   type: A
+	//   values:
+	//   - 192.0.2.1
+	//   - 192.0.2.2
+}
+
+func TestOctoDNSRoundTrip(t *testing.T) {
+	zf, err := zonefile.Load([]byte(octoDNSZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err2 := zonefile.ExportOctoDNS(zf, zonefile.OctoDNSOptions{})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	for _, s := range []string{
+		"'*.dyn':", "value: v=spf1 mx -all\n",
+		"value: letsencrypt.org; validationmethods=dns-01",
+		"\nhost2:", "fingerprint: 0123456789abcdef0123456789abcdef01234567",
+		"port: 5060", `value: '"a\;" "b"'`, `value: '"\"q\""'`,
+	} {
+		if !strings.Contains(string(data), s) {
+			t.Fatalf("%q is missing from\n%s", s, data)
+		}
+	}
+	if strings.Index(string(data), "host2:") >
+		strings.Index(string(data), "host10:") {
+		t.Fatalf("host2 should come before host10:\n%s", data)
+	}
+
+	imported, err2 := zonefile.ImportOctoDNS(data, zonefile.OctoDNSOptions{
+		Origin: "example.com", SOA: "ns1 hostmaster 1 3600 600 604800 60"})
+	if err2 != nil {
+		t.Fatalf("importing\n%s: %v", data, err2)
+	}
+	changes, err2 := zonefile.DiffOrigin(zf, imported, "example.com.")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("records differ after importing\n%s:\n%s", data,
+			imported.Save())
+	}
+
+	// And back again
+	again, err2 := zonefile.ExportOctoDNS(imported, zonefile.OctoDNSOptions{})
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if string(again) != string(data) {
+		t.Fatalf("got\n%s\ninstead of\n%s", again, data)
+	}
+}
+
+func TestImportOctoDNS(t *testing.T) {
+	zf, err := zonefile.ImportOctoDNS([]byte(`# Managed by hand
+---
+'':
+  - type: ns
+    values: [ns1.example.com., "ns2.example.org."]
+  - type: MX
+    ttl: 300
+    values:
+      - priority: 10      # as in older versions
+        value: mail.example.com.
+  - type: TXT
+    value: "v=DMARC1\\; p=none"
+    octodns:
+      ignored: true
+mail:
+  type: A
+  value: 192.0.2.2
+`), zonefile.OctoDNSOptions{Origin: "example.com."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `$ORIGIN example.com.
+@    3600 IN NS  ns1
+@    3600 IN NS  ns2.example.org.
+@    300  IN MX  10 mail
+@    3600 IN TXT "v=DMARC1; p=none"
+mail 3600 IN A   192.0.2.2
+`
+	if got := string(zf.Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
+
+func TestImportOctoDNSErrors(t *testing.T) {
+	for _, test := range []struct {
+		data, err string
+	}{
+		{"www:\n  type: A\n  value: 1.2.3\n", "'www' A: "},
+		{"www:\n  type: LOC\n  value: x\n", "line 2: 'www' LOC: unsupported type"},
+		{"www:\n  type: MX\n  value:\n    preference: 10\n",
+			"line 2: 'www' MX: value has no exchange"},
+		{"www:\n  type: A\n    value: 1.2.3.4\n", "line 3: "},
+		{"www:\n  type: A\n  value: \"1.2.3.4\\n\\n\\n\\\"\"\n",
+			"line 2: 'www' A: invalid value"},
+		{"www:\n  type: A\n  value: \"1.2.3.4\\nevil 60 IN A 6.6.6.6\"\n",
+			"line 2: 'www' A: invalid value"},
+		{"www:\n  type: MX\n  value:\n    preference: 10\n" +
+			"    exchange: \"\\n\\\"\"\n",
+			"line 2: 'www' MX: exchange: invalid value"},
+		{"www:\n  type: TXT\n  value: '\"a\" b'\n",
+			"line 2: 'www' TXT: invalid quoted chunks"},
+		{"www evil:\n  type: A\n  value: 1.2.3.4\n",
+			`line 2: invalid name "www evil"`},
+	} {
+		_, err := zonefile.ImportOctoDNS([]byte(test.data),
+			zonefile.OctoDNSOptions{Origin: "example.com."})
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Fatalf("expected error %q, not %v", test.err, err)
+		}
+	}
+}
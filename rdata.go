@@ -0,0 +1,421 @@
+package zonefile
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of fields in the values of records
+type fieldKind int
+
+const (
+	fieldName   fieldKind = iota // a domain name
+	fieldUint8                   // an 8-bit number
+	fieldUint16                  // a 16-bit number
+	fieldUint32                  // a 32-bit number
+	fieldPeriod                  // a 32-bit number of seconds, maybe with units
+	fieldIPv4                    // an IPv4 address
+	fieldIPv6                    // an IPv6 address
+	fieldString                  // a character-string
+	fieldType                    // a type, such as A
+	fieldTime                    // a time as in RRSIG records
+	fieldTag                     // an unquoted word, such as the tag of a CAA record
+	fieldSalt                    // hexadecimal string or "-", as in NSEC3
+	fieldBase32                  // base32 with extended hex alphabet
+
+	// The following kinds take the remaining values of a record
+	fieldStrings // one or more character-strings
+	fieldBase64  // base64, possibly split over multiple values
+	fieldHex     // hexadecimal, possibly split over multiple values
+	fieldTypes   // a list of types, as in NSEC records
+)
+
+// Checks whether the field takes all remaining values
+func (k fieldKind) isRest() bool {
+	return k >= fieldStrings
+}
+
+// The fields of the values of the types we know about.  Values of other
+// types are treated as opaque.
+var rdataFields = map[string][]fieldKind{
+	"A":          {fieldIPv4},
+	"AAAA":       {fieldIPv6},
+	"NS":         {fieldName},
+	"MD":         {fieldName},
+	"MF":         {fieldName},
+	"CNAME":      {fieldName},
+	"MB":         {fieldName},
+	"MG":         {fieldName},
+	"MR":         {fieldName},
+	"PTR":        {fieldName},
+	"DNAME":      {fieldName},
+	"SOA":        {fieldName, fieldName, fieldUint32, fieldPeriod, fieldPeriod, fieldPeriod, fieldPeriod},
+	"HINFO":      {fieldString, fieldString},
+	"MINFO":      {fieldName, fieldName},
+	"MX":         {fieldUint16, fieldName},
+	"RT":         {fieldUint16, fieldName},
+	"AFSDB":      {fieldUint16, fieldName},
+	"KX":         {fieldUint16, fieldName},
+	"PX":         {fieldUint16, fieldName, fieldName},
+	"RP":         {fieldName, fieldName},
+	"TXT":        {fieldStrings},
+	"SPF":        {fieldStrings},
+	"X25":        {fieldString},
+	"SRV":        {fieldUint16, fieldUint16, fieldUint16, fieldName},
+	"NAPTR":      {fieldUint16, fieldUint16, fieldString, fieldString, fieldString, fieldName},
+	"CAA":        {fieldUint8, fieldTag, fieldString},
+	"URI":        {fieldUint16, fieldUint16, fieldString},
+	"DS":         {fieldUint16, fieldUint8, fieldUint8, fieldHex},
+	"CDS":        {fieldUint16, fieldUint8, fieldUint8, fieldHex},
+	"DLV":        {fieldUint16, fieldUint8, fieldUint8, fieldHex},
+	"TA":         {fieldUint16, fieldUint8, fieldUint8, fieldHex},
+	"DNSKEY":     {fieldUint16, fieldUint8, fieldUint8, fieldBase64},
+	"CDNSKEY":    {fieldUint16, fieldUint8, fieldUint8, fieldBase64},
+	"KEY":        {fieldUint16, fieldUint8, fieldUint8, fieldBase64},
+	"RRSIG":      {fieldType, fieldUint8, fieldUint8, fieldUint32, fieldTime, fieldTime, fieldUint16, fieldName, fieldBase64},
+	"SIG":        {fieldType, fieldUint8, fieldUint8, fieldUint32, fieldTime, fieldTime, fieldUint16, fieldName, fieldBase64},
+	"NSEC":       {fieldName, fieldTypes},
+	"NSEC3":      {fieldUint8, fieldUint8, fieldUint16, fieldSalt, fieldBase32, fieldTypes},
+	"NSEC3PARAM": {fieldUint8, fieldUint8, fieldUint16, fieldSalt},
+	"TLSA":       {fieldUint8, fieldUint8, fieldUint8, fieldHex},
+	"SMIMEA":     {fieldUint8, fieldUint8, fieldUint8, fieldHex},
+	"SSHFP":      {fieldUint8, fieldUint8, fieldHex},
+	"OPENPGPKEY": {fieldBase64},
+	"DHCID":      {fieldBase64},
+	"CSYNC":      {fieldUint32, fieldUint16, fieldTypes},
+}
+
+// The numeric values of the types, as used on the wire
+var typeCodes = map[string]uint16{
+	"A": 1, "NS": 2, "MD": 3, "MF": 4, "CNAME": 5, "SOA": 6, "MB": 7,
+	"MG": 8, "MR": 9, "NULL": 10, "WKS": 11, "PTR": 12, "HINFO": 13,
+	"MINFO": 14, "MX": 15, "TXT": 16, "RP": 17, "AFSDB": 18, "X25": 19,
+	"ISDN": 20, "RT": 21, "NSAP": 22, "NSAP-PTR": 23, "SIG": 24, "KEY": 25,
+	"PX": 26, "GPOS": 27, "AAAA": 28, "LOC": 29, "NXT": 30, "EID": 31,
+	"NIMLOC": 32, "SRV": 33, "ATMA": 34, "NAPTR": 35, "KX": 36, "CERT": 37,
+	"A6": 38, "DNAME": 39, "SINK": 40, "OPT": 41, "APL": 42, "DS": 43,
+	"SSHFP": 44, "IPSECKEY": 45, "RRSIG": 46, "NSEC": 47, "DNSKEY": 48,
+	"DHCID": 49, "NSEC3": 50, "NSEC3PARAM": 51, "TLSA": 52, "SMIMEA": 53,
+	"HIP": 55, "NINFO": 56, "RKEY": 57, "TALINK": 58, "CDS": 59,
+	"CDNSKEY": 60, "OPENPGPKEY": 61, "CSYNC": 62, "SPF": 99, "UINFO": 100,
+	"UID": 101, "GID": 102, "UNSPEC": 103, "NID": 104, "L32": 105,
+	"L64": 106, "LP": 107, "EUI48": 108, "EUI64": 109, "TKEY": 249,
+	"TSIG": 250, "IXFR": 251, "AXFR": 252, "MAILB": 253, "MAILA": 254,
+	"ANY": 255, "URI": 256, "CAA": 257, "AVC": 258, "TA": 32768,
+	"DLV": 32769,
+}
+
+var typeNames map[uint16]string
+
+func init() {
+	typeNames = make(map[uint16]string)
+	for name, code := range typeCodes {
+		typeNames[code] = name
+	}
+}
+
+// Returns the numeric value of a type, which is either a mnemonic such
+// as AAAA or of the form TYPE28.
+func typeCode(typ string) (uint16, bool) {
+	typ = strings.ToUpper(typ)
+	if code, ok := typeCodes[typ]; ok {
+		return code, true
+	}
+	if strings.HasPrefix(typ, "TYPE") {
+		v, err := strconv.ParseUint(typ[4:], 10, 16)
+		return uint16(v), err == nil
+	}
+	return 0, false
+}
+
+// Returns the mnemonic of the type, or TYPE123 if it has none
+func typeName(code uint16) string {
+	if name, ok := typeNames[code]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(code))
+}
+
+var base32HexNoPadding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Checks the values of a record of the given type and returns them in
+// canonical form, one string for each field.  The values are as they are
+// written in the zonefile, with quotes and escapes.  Domain names are made
+// absolute with respect to the origin.  The second return value is the
+// index of the value that is wrong, if any.
+func canonicalRdata(typ string, values [][]byte, origin string) (
+	fields []string, iBad int, err error) {
+	kinds, ok := rdataFields[typ]
+	if !ok || isGenericRdata(values) {
+		for _, v := range values {
+			fields = append(fields, string(v))
+		}
+		return
+	}
+
+	for i, kind := range kinds {
+		if i == len(values) && kind == fieldTypes {
+			return append(fields, ""), 0, nil
+		}
+		if i >= len(values) {
+			return nil, len(values) - 1, fmt.Errorf(
+				"too few values for %s record", typ)
+		}
+		if kind.isRest() {
+			field, iBad, err := canonicalRest(kind, values[i:])
+			if err != nil {
+				return nil, i + iBad, err
+			}
+			return append(fields, field), 0, nil
+		}
+		field, err := canonicalField(kind, values[i], origin)
+		if err != nil {
+			return nil, i, err
+		}
+		fields = append(fields, field)
+	}
+	if len(values) > len(kinds) {
+		return nil, len(kinds), fmt.Errorf(
+			"too many values for %s record", typ)
+	}
+	return
+}
+
+// Checks whether the values are in the generic format of RFC 3597
+func isGenericRdata(values [][]byte) bool {
+	return len(values) >= 2 && bytes.Equal(values[0], []byte(`\#`))
+}
+
+// Checks the value of a single field and returns it in canonical form.
+func canonicalField(kind fieldKind, v []byte, origin string) (
+	string, error) {
+	s := string(v)
+	switch kind {
+	case fieldName:
+		name := absoluteName(s, origin)
+		if !isAbsolute(name) {
+			return "", errors.New("relative domain name without origin")
+		}
+		return wire.CanonicalName(name)
+	case fieldUint8, fieldUint16, fieldUint32:
+		bits := map[fieldKind]int{
+			fieldUint8: 8, fieldUint16: 16, fieldUint32: 32}[kind]
+		n, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return "", fmt.Errorf("invalid %d-bit number", bits)
+		}
+		return strconv.FormatUint(n, 10), nil
+	case fieldPeriod:
+		n, err := parsePeriod(s)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatUint(uint64(n), 10), nil
+	case fieldIPv4:
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() == nil || strings.Contains(s, ":") {
+			return "", errors.New("invalid IPv4 address")
+		}
+		return ip.To4().String(), nil
+	case fieldIPv6:
+		ip := net.ParseIP(s)
+		if ip == nil || !strings.Contains(s, ":") {
+			return "", errors.New("invalid IPv6 address")
+		}
+		return formatIPv6(ip), nil
+	case fieldString:
+		str, err := decodeString(v)
+		if err != nil {
+			return "", err
+		}
+		return quoteString(str), nil
+	case fieldType:
+		code, ok := typeCode(s)
+		if !ok {
+			return "", errors.New("unknown type")
+		}
+		return typeName(code), nil
+	case fieldTime:
+		t, err := parseTime(s)
+		if err != nil {
+			return "", err
+		}
+		return formatTime(t), nil
+	case fieldTag:
+		if len(v) == 0 || len(v) > 255 {
+			return "", errors.New("invalid tag")
+		}
+		return strings.ToLower(s), nil
+	case fieldSalt:
+		if s == "-" {
+			return s, nil
+		}
+		salt, err := hex.DecodeString(s)
+		if err != nil || len(salt) > 255 {
+			return "", errors.New("invalid salt")
+		}
+		return strings.ToUpper(s), nil
+	case fieldBase32:
+		if _, err := base32HexNoPadding.DecodeString(
+			strings.ToUpper(s)); err != nil {
+			return "", errors.New("invalid base32")
+		}
+		return strings.ToUpper(s), nil
+	}
+	panic("not a single field")
+}
+
+// Checks the values of a field that takes the remaining values and returns
+// it in canonical form.
+func canonicalRest(kind fieldKind, values [][]byte) (string, int, error) {
+	switch kind {
+	case fieldStrings:
+		var ss []string
+		for i, v := range values {
+			str, err := decodeString(v)
+			if err != nil {
+				return "", i, err
+			}
+			ss = append(ss, quoteString(str))
+		}
+		return strings.Join(ss, " "), 0, nil
+	case fieldBase64:
+		data, err := base64.StdEncoding.DecodeString(
+			string(bytes.Join(values, nil)))
+		if err != nil {
+			return "", 0, errors.New("invalid base64")
+		}
+		return base64.StdEncoding.EncodeToString(data), 0, nil
+	case fieldHex:
+		data, err := hex.DecodeString(string(bytes.Join(values, nil)))
+		if err != nil {
+			return "", 0, errors.New("invalid hexadecimal string")
+		}
+		return strings.ToUpper(hex.EncodeToString(data)), 0, nil
+	case fieldTypes:
+		var codes []int
+		seen := make(map[uint16]bool)
+		for i, v := range values {
+			code, ok := typeCode(string(v))
+			if !ok {
+				return "", i, errors.New("unknown type")
+			}
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, int(code))
+			}
+		}
+		sort.Ints(codes)
+		var names []string
+		for _, code := range codes {
+			names = append(names, typeName(uint16(code)))
+		}
+		return strings.Join(names, " "), 0, nil
+	}
+	panic("not a rest field")
+}
+
+// Decodes a character-string in presentation format, which may be quoted
+func decodeString(v []byte) ([]byte, error) {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		v = v[1 : len(v)-1]
+	}
+	var ret []byte
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c == '\\' {
+			switch {
+			case i+3 < len(v) && isDigit(v[i+1]) && isDigit(v[i+2]) &&
+				isDigit(v[i+3]):
+				n := int(v[i+1]-'0')*100 + int(v[i+2]-'0')*10 +
+					int(v[i+3]-'0')
+				if n > 255 {
+					return nil, errors.New("invalid escape in string")
+				}
+				c = byte(n)
+				i += 3
+			case i+1 < len(v):
+				c = v[i+1]
+				i++
+			default:
+				return nil, errors.New("invalid escape in string")
+			}
+		}
+		ret = append(ret, c)
+	}
+	if len(ret) > 255 {
+		return nil, errors.New("character-string is too long")
+	}
+	return ret, nil
+}
+
+// Writes a character-string in presentation format
+func quoteString(v []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, c := range v {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&buf, "\\%03d", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// Formats the IPv6 address.  net.IP writes IPv4-mapped addresses as
+// IPv4 addresses, which aren't valid in AAAA records, so those get their
+// ::ffff: prefix back.
+func formatIPv6(ip net.IP) string {
+	s := ip.String()
+	if !strings.Contains(s, ":") {
+		s = "::ffff:" + s
+	}
+	return s
+}
+
+// Parses a time as in RRSIG records: either YYYYMMDDHHmmSS or the number
+// of seconds since the epoch.
+func parseTime(s string) (uint32, error) {
+	if len(s) == 14 {
+		t, err := time.Parse("20060102150405", s)
+		if err != nil {
+			return 0, errors.New("invalid time")
+		}
+		// Times are taken modulo 2^32 as RFC 4034 describes
+		return uint32(t.Unix()), nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid time")
+	}
+	return uint32(n), nil
+}
+
+// Writes a time as in RRSIG records as YYYYMMDDHHmmSS.  The time is
+// taken to be the one closest to now, as RFC 4034 describes.
+func formatTime(t uint32) string {
+	now := time.Now().Unix()
+	v := int64(t) + (now>>32)<<32
+	if v-now > 1<<31 {
+		v -= 1 << 32
+	} else if now-v > 1<<31 {
+		v += 1 << 32
+	}
+	return time.Unix(v, 0).UTC().Format("20060102150405")
+}
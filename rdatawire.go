@@ -0,0 +1,369 @@
+package zonefile
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Encodes values in canonical form, as returned by canonicalRdata, in
+// wire format.
+func rdataToWire(typ string, fields []string) ([]byte, error) {
+	kinds, ok := rdataFields[typ]
+	if !ok || isGenericRdata(stringsToBytes(fields)) {
+		return genericToWire(fields)
+	}
+	var b []byte
+	var err error
+	for i, kind := range kinds {
+		if i >= len(fields) {
+			return nil, fmt.Errorf("too few values for %s record", typ)
+		}
+		if b, err = appendField(b, kind, fields[i]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Decodes the data of a record in wire format into values as they would
+// be written in a zonefile.  Domain names are absolute.
+func rdataFromWire(typ string, rr wire.RR) ([]string, error) {
+	kinds, ok := rdataFields[typ]
+	if !ok {
+		return []string{`\#`, strconv.Itoa(len(rr.Data)),
+			strings.ToUpper(hex.EncodeToString(rr.Data))}, nil
+	}
+	var values []string
+	off := 0
+	for _, kind := range kinds {
+		vs, next, err := readField(rr, off, kind)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s record: %v", typ, err)
+		}
+		values = append(values, vs...)
+		off = next
+	}
+	if off != len(rr.Data) {
+		return nil, fmt.Errorf("invalid %s record: trailing data", typ)
+	}
+	return values, nil
+}
+
+func stringsToBytes(ss []string) (r [][]byte) {
+	for _, s := range ss {
+		r = append(r, []byte(s))
+	}
+	return
+}
+
+// Encodes values in the generic format of RFC 3597
+func genericToWire(fields []string) ([]byte, error) {
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, errors.New("values of unknown type must be in the " +
+			`\# format`)
+	}
+	length, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, errors.New("invalid length")
+	}
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, errors.New("invalid hexadecimal string")
+	}
+	if len(data) != length {
+		return nil, errors.New("length doesn't match data")
+	}
+	return data, nil
+}
+
+// Appends a field in canonical form in wire format
+func appendField(b []byte, kind fieldKind, field string) ([]byte, error) {
+	switch kind {
+	case fieldName:
+		return wire.AppendName(b, field)
+	case fieldUint8, fieldUint16, fieldUint32, fieldPeriod, fieldTime:
+		var n uint64
+		if kind == fieldTime {
+			t, err := parseTime(field)
+			if err != nil {
+				return nil, err
+			}
+			n = uint64(t)
+		} else {
+			var err error
+			if n, err = strconv.ParseUint(field, 10, 32); err != nil {
+				return nil, err
+			}
+		}
+		switch kind {
+		case fieldUint8:
+			return append(b, byte(n)), nil
+		case fieldUint16:
+			return append(b, byte(n>>8), byte(n)), nil
+		}
+		return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n)), nil
+	case fieldIPv4:
+		return append(b, net.ParseIP(field).To4()...), nil
+	case fieldIPv6:
+		return append(b, net.ParseIP(field).To16()...), nil
+	case fieldString:
+		return appendString(b, []byte(field))
+	case fieldType:
+		code, _ := typeCode(field)
+		return append(b, byte(code>>8), byte(code)), nil
+	case fieldTag:
+		return append(append(b, byte(len(field))), field...), nil
+	case fieldSalt:
+		if field == "-" {
+			return append(b, 0), nil
+		}
+		salt, _ := hex.DecodeString(field)
+		return append(append(b, byte(len(salt))), salt...), nil
+	case fieldBase32:
+		data, _ := base32HexNoPadding.DecodeString(field)
+		return append(append(b, byte(len(data))), data...), nil
+	case fieldStrings:
+		for _, s := range splitStrings(field) {
+			var err error
+			if b, err = appendString(b, []byte(s)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case fieldBase64:
+		data, _ := base64.StdEncoding.DecodeString(field)
+		return append(b, data...), nil
+	case fieldHex:
+		data, _ := hex.DecodeString(field)
+		return append(b, data...), nil
+	case fieldTypes:
+		return appendTypeBitmap(b, strings.Fields(field)), nil
+	}
+	panic("unknown field kind")
+}
+
+// Appends a quoted character-string in wire format
+func appendString(b []byte, quoted []byte) ([]byte, error) {
+	s, err := decodeString(quoted)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(b, byte(len(s))), s...), nil
+}
+
+// Splits quoted character-strings separated by spaces
+func splitStrings(field string) (r []string) {
+	for i := 0; i < len(field); i++ {
+		if field[i] != '"' {
+			continue
+		}
+		j := i + 1
+		for ; j < len(field) && field[j] != '"'; j++ {
+			if field[j] == '\\' {
+				j++
+			}
+		}
+		r = append(r, field[i:j+1])
+		i = j
+	}
+	return
+}
+
+// Appends the type bitmap of RFC 4034 for the types
+func appendTypeBitmap(b []byte, types []string) []byte {
+	var windows [256][32]byte
+	var used [256]int // the number of octets used in each window
+	for _, t := range types {
+		code, _ := typeCode(t)
+		w, n := code>>8, code&0xff
+		windows[w][n/8] |= 0x80 >> (n % 8)
+		if int(n/8)+1 > used[w] {
+			used[w] = int(n/8) + 1
+		}
+	}
+	for w := range windows {
+		if used[w] > 0 {
+			b = append(b, byte(w), byte(used[w]))
+			b = append(b, windows[w][:used[w]]...)
+		}
+	}
+	return b
+}
+
+// Reads a field in wire format at the given offset in the data of the
+// record and returns it as values in presentation format.
+func readField(rr wire.RR, off int, kind fieldKind) (
+	[]string, int, error) {
+	data := rr.Data
+	need := func(n int) error {
+		if off+n > len(data) {
+			return errors.New("too short")
+		}
+		return nil
+	}
+	switch kind {
+	case fieldName:
+		name, next, err := rr.ReadName(off)
+		return []string{name}, next, err
+	case fieldUint8:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		return []string{strconv.Itoa(int(data[off]))}, off + 1, nil
+	case fieldUint16, fieldType:
+		if err := need(2); err != nil {
+			return nil, 0, err
+		}
+		n := binary.BigEndian.Uint16(data[off:])
+		if kind == fieldType {
+			return []string{typeName(n)}, off + 2, nil
+		}
+		return []string{strconv.Itoa(int(n))}, off + 2, nil
+	case fieldUint32, fieldPeriod, fieldTime:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		n := binary.BigEndian.Uint32(data[off:])
+		if kind == fieldTime {
+			return []string{formatTime(n)}, off + 4, nil
+		}
+		return []string{strconv.FormatUint(uint64(n), 10)}, off + 4, nil
+	case fieldIPv4:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		return []string{net.IP(data[off : off+4]).String()}, off + 4, nil
+	case fieldIPv6:
+		if err := need(16); err != nil {
+			return nil, 0, err
+		}
+		return []string{formatIPv6(data[off : off+16])}, off + 16, nil
+	case fieldString, fieldTag, fieldSalt, fieldBase32:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		n := int(data[off])
+		if err := need(1 + n); err != nil {
+			return nil, 0, err
+		}
+		s := data[off+1 : off+1+n]
+		next := off + 1 + n
+		switch kind {
+		case fieldTag:
+			return []string{string(s)}, next, nil
+		case fieldSalt:
+			if n == 0 {
+				return []string{"-"}, next, nil
+			}
+			return []string{strings.ToUpper(hex.EncodeToString(s))}, next, nil
+		case fieldBase32:
+			return []string{base32HexNoPadding.EncodeToString(s)}, next, nil
+		}
+		return []string{quoteString(s)}, next, nil
+	case fieldStrings:
+		var r []string
+		for off < len(data) {
+			n := int(data[off])
+			if err := need(1 + n); err != nil {
+				return nil, 0, err
+			}
+			r = append(r, quoteString(data[off+1:off+1+n]))
+			off += 1 + n
+		}
+		if len(r) == 0 {
+			return nil, 0, errors.New("no character-strings")
+		}
+		return r, off, nil
+	case fieldBase64:
+		return []string{base64.StdEncoding.EncodeToString(data[off:])},
+			len(data), nil
+	case fieldHex:
+		return []string{strings.ToUpper(hex.EncodeToString(data[off:]))},
+			len(data), nil
+	case fieldTypes:
+		var r []string
+		for off < len(data) {
+			if err := need(2); err != nil {
+				return nil, 0, err
+			}
+			w, n := int(data[off]), int(data[off+1])
+			if n == 0 || n > 32 {
+				return nil, 0, errors.New("invalid type bitmap")
+			}
+			if err := need(2 + n); err != nil {
+				return nil, 0, err
+			}
+			for i, octet := range data[off+2 : off+2+n] {
+				for bit := 0; bit < 8; bit++ {
+					if octet&(0x80>>uint(bit)) != 0 {
+						r = append(r, typeName(uint16(w<<8|i*8+bit)))
+					}
+				}
+			}
+			off += 2 + n
+		}
+		return r, off, nil
+	}
+	panic("unknown field kind")
+}
+
+// Returns the record in wire format
+func (r Record) wire() (wire.RR, error) {
+	code, ok := typeCode(r.Type)
+	if !ok {
+		return wire.RR{}, fmt.Errorf("unknown type %s", r.Type)
+	}
+	class, ok := classCode(r.Class)
+	if !ok {
+		return wire.RR{}, fmt.Errorf("unknown class %s", r.Class)
+	}
+	data, err := rdataToWire(r.Type, r.rdata)
+	if err != nil {
+		return wire.RR{}, err
+	}
+	return wire.RR{Name: r.Name, Type: code, Class: class,
+		TTL: uint32(r.TTL), Data: data}, nil
+}
+
+// The numeric values of the classes
+var classCodes = map[string]uint16{
+	"IN": 1, "CS": 2, "CH": 3, "HS": 4, "NONE": 254, "ANY": 255,
+}
+
+// Returns the numeric value of a class, which is either a mnemonic such
+// as IN or of the form CLASS1.
+func classCode(class string) (uint16, bool) {
+	class = strings.ToUpper(class)
+	if code, ok := classCodes[class]; ok {
+		return code, true
+	}
+	if strings.HasPrefix(class, "CLASS") {
+		v, err := strconv.ParseUint(class[5:], 10, 16)
+		return uint16(v), err == nil
+	}
+	return 0, false
+}
+
+// Returns the mnemonic of the class, or CLASS123 if it has none
+func className(code uint16) string {
+	for name, c := range classCodes {
+		if c == code {
+			return name
+		}
+	}
+	return "CLASS" + strconv.Itoa(int(code))
+}
+
+// Returns the numeric type and class of the record and its data, as they
+// are in DNS messages.  Domain names in the data are not compressed.
+func (r Record) Wire() (typ, class uint16, data []byte, err error) {
+	rr, err := r.wire()
+	return rr.Type, rr.Class, rr.Data, err
+}
@@ -0,0 +1,371 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A resource record as a nameserver would serve it.  Its owner name is
+// absolute and its TTL and class are filled in, also when the entry it
+// comes from leaves them out.
+type Record struct {
+	Name  string // absolute owner name
+	TTL   int
+	Class string
+	Type  string
+
+	// The values as written in the zonefile, except that domain names
+	// are made absolute.
+	Values []string
+
+	Entry    *Entry    // the entry the record comes from ...
+	Zonefile *Zonefile // ... which is part of this zonefile
+
+	rdata           []string // the fields of the values in canonical form
+	origin          string   // the origin in effect for the entry
+	ttlFromPrevious bool     // whether the TTL is that of a previous record
+}
+
+// Writes the record as an entry in a zonefile
+func (r Record) String() string {
+	return fmt.Sprintf("%s %d %s %s %s", r.Name, r.TTL, r.Class, r.Type,
+		strings.Join(r.Values, " "))
+}
+
+// Writes the record in canonical form: domain names are in lower case
+// and all values are written in the same way, so that records which are
+// the same have the same canonical form.
+func (r Record) Canonical() string {
+	name, err := wire.CanonicalName(r.Name)
+	if err != nil {
+		name = r.Name
+	}
+	return fmt.Sprintf("%s %d %s %s %s", name, r.TTL,
+		strings.ToUpper(r.Class), r.Type, strings.Join(r.rdata, " "))
+}
+
+// Reads and parses the zonefile at the given path.  The path is used to
+// find the files included by $INCLUDE entries.  Parsing errors are
+// returned as ParsingError, which is also a FileError with the path.
+func LoadFile(path string) (*Zonefile, error) {
+	return loadFile(path, ioutil.ReadFile)
+}
+
+// Reads the zonefile at the given path with readFile, as LoadFile.  The
+// files it includes are read with readFile too.
+func loadFile(path string, readFile func(string) ([]byte, error)) (
+	*Zonefile, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	z, perr := Load(data)
+	if perr != nil {
+		return nil, parsingError{perr.Error(), perr.LineNo(), perr.ColNo(),
+			path}
+	}
+	z.path, z.readFile = path, readFile
+	return z, nil
+}
+
+// Reads the zonefile included from this one at the given path
+func (z *Zonefile) loadInclude(path string) (*Zonefile, error) {
+	if z.readFile == nil {
+		return LoadFile(path)
+	}
+	return loadFile(path, z.readFile)
+}
+
+// The path of the zonefile, if it was read by LoadFile
+func (z *Zonefile) Path() string {
+	return z.path
+}
+
+// Sets the path of the zonefile, as if it was read from there by
+// LoadFile, so that relative $INCLUDE paths are taken relative to it
+func (z *Zonefile) SetPath(path string) {
+	z.path = path
+}
+
+// Returns a copy of the zonefile that can be changed without changing this
+// one.  It has the same path, and includes the same versions of files.
+func (z *Zonefile) Copy() (*Zonefile, error) {
+	c, perr := Load(z.Save())
+	if perr != nil {
+		return nil, perr
+	}
+	c.path, c.readFile = z.path, z.readFile
+	return c, nil
+}
+
+// Returns the path of the file included by the given $INCLUDE entry.
+// Relative paths are taken relative to the directory of the zonefile.
+func (z *Zonefile) IncludePath(e Entry) (string, error) {
+	vs := e.Values()
+	if string(e.Command()) != "$INCLUDE" || len(vs) == 0 {
+		return "", errors.New("not an $INCLUDE entry")
+	}
+	path := string(vs[0])
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	if z.path == "" {
+		return "", errors.New("can't resolve $INCLUDE " + path +
+			" without the path of the zonefile")
+	}
+	return filepath.Join(filepath.Dir(z.path), path), nil
+}
+
+// Reads the zonefiles included by $INCLUDE entries in this zonefile.
+// Files included by those are not read.
+func (z *Zonefile) Includes() (r []*Zonefile, err error) {
+	for _, e := range z.entries {
+		if string(e.Command()) != "$INCLUDE" {
+			continue
+		}
+		path, err := z.IncludePath(e)
+		if err != nil {
+			return nil, err
+		}
+		inc, err := z.loadInclude(path)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, inc)
+	}
+	return
+}
+
+// Returns the records in the zonefile and the files it includes.  The
+// origin is the origin of the zone, which may be left empty if the
+// zonefile starts with an $ORIGIN entry.
+//
+// Owner names, TTLs and classes are resolved as named does: an entry
+// without TTL gets the TTL of the last $TTL entry, otherwise that of the
+// previous record, otherwise the minimum TTL of the SOA record.  Values
+// of types we know are checked.  Errors are returned as ParsingError, and
+// their FileError tells whether they are in an included file.
+func (z *Zonefile) Records(origin string) ([]Record, error) {
+	r, err := z.resolve(origin, false)
+	if err != nil {
+		return nil, err
+	}
+	return r.records, nil
+}
+
+// Resolves the records in the zonefile, keeping track of the states of
+// the resolver if track is set
+func (z *Zonefile) resolve(origin string, track bool) (*resolver, error) {
+	if origin != "" && !isAbsolute(origin) {
+		return nil, errors.New("origin must be absolute")
+	}
+	r := &resolver{track: track}
+	r.origin = origin
+	if err := r.resolve(z); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Maximum depth of nested $INCLUDEs
+const maxIncludeDepth = 16
+
+// Keeps track of the state while resolving records
+type resolver struct {
+	resolverState
+	depth   int
+	records []Record
+
+	// If track is set, the state before each entry of the zonefile, and
+	// after the last, is kept in states, and the index of the entry of
+	// the zonefile that each record comes from, or that includes the
+	// file it comes from, in entries.
+	track   bool
+	states  []resolverState
+	entries []int
+}
+
+// What the resolver carries over from one entry to the next
+type resolverState struct {
+	origin     string
+	defaultTTL *int // set by $TTL
+	lastTTL    *int // of the previous record
+	soaMinimum *int
+	lastOwner  string
+	lastClass  string
+}
+
+func (r *resolver) resolve(z *Zonefile) error {
+	top := r.track && r.depth == 0
+	for i := range z.entries {
+		if top {
+			r.states = append(r.states, r.resolverState)
+		}
+		if err := r.entry(z, &z.entries[i]); err != nil {
+			return err
+		}
+	}
+	if top {
+		r.states = append(r.states, r.resolverState)
+	}
+	return nil
+}
+
+// Resolves the entry, which is one of the zonefile
+func (r *resolver) entry(z *Zonefile, e *Entry) error {
+	if e.isControl {
+		return r.control(z, e)
+	}
+	return r.record(z, e)
+}
+
+// Returns an error about the given token in the zonefile, at its start
+func (z *Zonefile) errorAt(t token, format string,
+	args ...interface{}) ParsingError {
+	return parsingError{fmt.Sprintf(format, args...), t.lineno, t.colno,
+		z.path}
+}
+
+// Handles an $ORIGIN, $TTL or $INCLUDE entry
+func (r *resolver) control(z *Zonefile, e *Entry) error {
+	cmd := e.tokens[e.find(useControl)[0]].t
+	values := e.rawValues()
+	if len(values) == 0 {
+		return z.errorAt(cmd, "missing value for %s", cmd.val)
+	}
+	switch string(cmd.val) {
+	case "$ORIGIN":
+		origin := absoluteName(string(values[0].val), r.origin)
+		if _, err := wire.SplitName(origin); err != nil {
+			return z.errorAt(values[0], "%s", err)
+		}
+		r.origin = origin
+	case "$TTL":
+		ttl, err := parseTTL(string(values[0].val))
+		if err != nil {
+			return z.errorAt(values[0], "%s", err)
+		}
+		r.defaultTTL = &ttl
+	case "$INCLUDE":
+		if r.depth >= maxIncludeDepth {
+			return z.errorAt(cmd, "too many nested $INCLUDEs")
+		}
+		path, err := z.IncludePath(*e)
+		if err != nil {
+			return z.errorAt(values[0], "%s", err)
+		}
+		inc, err := z.loadInclude(path)
+		if err != nil {
+			if _, ok := err.(ParsingError); ok {
+				return err
+			}
+			return z.errorAt(values[0], "%s", err)
+		}
+		origin := r.origin
+		if len(values) > 1 {
+			r.origin = absoluteName(string(values[1].val), origin)
+			if _, err := wire.SplitName(r.origin); err != nil {
+				return z.errorAt(values[1], "%s", err)
+			}
+		}
+		r.depth++
+		err = r.resolve(inc)
+		r.depth--
+		r.origin = origin
+		return err
+	}
+	return nil
+}
+
+// Resolves the record in the entry
+func (r *resolver) record(z *Zonefile, e *Entry) error {
+	rec := Record{Entry: e, Zonefile: z, origin: r.origin}
+	first := e.tokens[e.startOfLine()].t
+
+	if is := e.find(useDomain); len(is) > 0 {
+		t := e.tokens[is[0]].t
+		rec.Name = absoluteName(string(t.val), r.origin)
+		if !isAbsolute(rec.Name) {
+			return z.errorAt(t, "relative domain name without origin")
+		}
+		if _, err := wire.SplitName(rec.Name); err != nil {
+			return z.errorAt(t, "%s", err)
+		}
+		r.lastOwner = rec.Name
+	} else if r.lastOwner == "" {
+		return z.errorAt(first, "missing owner name")
+	} else {
+		rec.Name = r.lastOwner
+	}
+
+	rec.Class = string(e.Class())
+	if rec.Class == "" {
+		rec.Class = r.lastClass
+	}
+	if rec.Class == "" {
+		rec.Class = "IN"
+	}
+	r.lastClass = rec.Class
+
+	rec.Type = string(e.Type())
+	values := e.rawValues()
+	var raw [][]byte
+	for _, v := range values {
+		raw = append(raw, v.val)
+	}
+	rdata, iBad, err := canonicalRdata(rec.Type, raw, r.origin)
+	if err != nil {
+		t := e.tokens[e.find(useType)[0]].t
+		if iBad >= 0 && iBad < len(values) {
+			t = values[iBad]
+		}
+		return z.errorAt(t, "%s", err)
+	}
+	rec.rdata = rdata
+	kinds := rdataFields[rec.Type]
+	for i, v := range raw {
+		value := string(v)
+		if i < len(kinds) && kinds[i] == fieldName && !isGenericRdata(raw) {
+			value = absoluteName(value, r.origin)
+		}
+		rec.Values = append(rec.Values, value)
+	}
+
+	if rec.Type == "SOA" && len(rdata) == 7 {
+		minimum, _ := strconv.Atoi(rdata[6])
+		r.soaMinimum = &minimum
+	}
+	switch ttl := e.TTL(); {
+	case ttl != nil:
+		rec.TTL = *ttl
+		r.lastTTL = ttl
+	case r.defaultTTL != nil:
+		rec.TTL = *r.defaultTTL
+	case r.lastTTL != nil:
+		rec.TTL = *r.lastTTL
+		rec.ttlFromPrevious = true
+	case r.soaMinimum != nil:
+		rec.TTL = *r.soaMinimum
+	default:
+		return z.errorAt(first, "no TTL specified")
+	}
+
+	r.records = append(r.records, rec)
+	if r.track {
+		r.entries = append(r.entries, len(r.states)-1)
+	}
+	return nil
+}
+
+// Returns the tokens of the values of the entry, as they are written
+func (e Entry) rawValues() (r []token) {
+	for _, i := range e.find(useValue) {
+		r = append(r, e.tokens[i].t)
+	}
+	return
+}
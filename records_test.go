@@ -0,0 +1,190 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func ExampleZonefile_Records() {
+	zf, err := zonefile.Load([]byte(`
+$ORIGIN example.com.
+$TTL 1h
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1     A   1.2.3.4
+www  60 CNAME @`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	records, err2 := zf.Records("")
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	for _, r := range records {
+		fmt.Println(r)
+	}
+	// Output:
+	// example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 604800 60
+	// example.com. 3600 IN NS ns1.example.com.
+	// ns1.example.com. 3600 IN A 1.2.3.4
+	// www.example.com. 60 IN CNAME example.com.
+}
+
+func TestRecordsTTL(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"@ IN SOA ns1 hostmaster 1 3600 600 604800 60\n" +
+			"a A 1.2.3.4\n" +
+			"b 1d A 1.2.3.4\n" +
+			"c A 1.2.3.4\n" +
+			"$TTL 2h\n" +
+			"d A 1.2.3.4\n" +
+			"e 30 A 1.2.3.4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err2 := zf.Records("example.com.")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	expected := []int{60, 60, 86400, 86400, 7200, 30}
+	if len(records) != len(expected) {
+		t.Fatal("Unexpected number of records:", len(records))
+	}
+	for i, r := range records {
+		if r.TTL != expected[i] {
+			t.Fatalf("Unexpected TTL for %s: %d", r.Name, r.TTL)
+		}
+	}
+}
+
+func TestRecordsErrors(t *testing.T) {
+	for _, test := range []struct {
+		zone   string
+		origin string
+		line   int
+	}{
+		{"www 60 A 1.2.3.4", "", 0},
+		{"$TTL 60\nwww. A 1.2.3.4\nx A 1.2.3.4.5", "example.com.", 2},
+		{"$TTL 60\n A 1.2.3.4", "example.com.", 1},
+		{"www. A 1.2.3.4", "", 0},
+		{"$TTL 1x", "", 0},
+		{"$TTL 60\nwww. MX ten mail.", "", 1},
+	} {
+		zf, err := zonefile.Load([]byte(test.zone))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err2 := zf.Records(test.origin)
+		if err2 == nil {
+			t.Fatalf("Expected error for %q", test.zone)
+		}
+		perr, ok := err2.(zonefile.ParsingError)
+		if !ok {
+			t.Fatalf("Expected ParsingError for %q: %v", test.zone, err2)
+		}
+		if perr.LineNo() != test.line {
+			t.Fatalf("Unexpected line for %q: %d (%v)", test.zone,
+				perr.LineNo(), perr)
+		}
+	}
+}
+
+func TestRecordCanonical(t *testing.T) {
+	a, err := zonefile.Load([]byte(
+		"$ORIGIN example.com.\n" +
+			"$TTL 3600\n" +
+			"@ IN MX 10 mail ; comment\n" +
+			"txt TXT \"a b\" c\n" +
+			"aaaa AAAA 2001:db8::1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := zonefile.Load([]byte(
+		"EXAMPLE.com. 1h IN MX ( 10\n" +
+			"   MAIL.example.com. )\n" +
+			"TXT.example.com. 1h TXT \"a\\032b\" \"c\"\n" +
+			"aaaa.example.com. 3600 AAAA 2001:0db8:0:0::1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err2 := a.Records("")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	rb, err2 := b.Records("")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	for i := range ra {
+		if ra[i].Canonical() != rb[i].Canonical() {
+			t.Fatalf("%q != %q", ra[i].Canonical(), rb[i].Canonical())
+		}
+	}
+	if string(ra[0].Entry.Type()) != "MX" {
+		t.Fatal("Record doesn't point to its entry")
+	}
+}
+
+func TestRecordsInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("hosts.inc", "www A 1.2.3.4\n")
+	write("broken.inc", "\nmail A 1.2.3\n")
+	path := write("example.com.zone",
+		"$ORIGIN example.com.\n"+
+			"$TTL 60\n"+
+			"$INCLUDE hosts.inc sub\n"+
+			"ftp A 1.2.3.4\n")
+
+	zf, err := zonefile.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zf.Path() != path {
+		t.Fatal("Unexpected path:", zf.Path())
+	}
+	records, err := zf.Records("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 ||
+		records[0].Name != "www.sub.example.com." ||
+		records[1].Name != "ftp.example.com." {
+		t.Fatal("Unexpected records:", records)
+	}
+	if records[0].Zonefile.Path() != filepath.Join(dir, "hosts.inc") {
+		t.Fatal("Unexpected zonefile:", records[0].Zonefile.Path())
+	}
+
+	// Errors in included files should point to the included file
+	path = write("broken.zone", "$TTL 60\n$INCLUDE broken.inc example.com.\n")
+	zf, err = zonefile.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = zf.Records("")
+	perr, ok := err.(zonefile.ParsingError)
+	ferr, ok2 := err.(zonefile.FileError)
+	if !ok || !ok2 {
+		t.Fatal("Expected ParsingError and FileError:", err)
+	}
+	if ferr.File() != filepath.Join(dir, "broken.inc") || perr.LineNo() != 1 {
+		t.Fatal("Unexpected error location:", ferr.File(), perr.LineNo())
+	}
+}
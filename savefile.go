@@ -0,0 +1,93 @@
+package zonefile
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Writes the zonefile to the file at the given path.
+//
+// The zonefile is first written to a temporary file in the same directory,
+// which is synced to disk and then renamed over the original file.  Thus
+// the file will contain either the old or the new zonefile, even if we
+// crash halfway.  The mode and, where supported, the owner and group of an
+// existing file are preserved.  If we may not give the new file the owner
+// or group of the existing one, an error is returned and the file is left
+// alone.  A new file gets mode 0666 less the umask, as with os.Create.  If
+// the path is a symlink, the file it points to is replaced.
+func (z *Zonefile) SaveFile(path string) (err error) {
+	if resolved, err2 := filepath.EvalSymlinks(path); err2 == nil {
+		path = resolved
+	}
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	fh, err := createTemp(dir, base)
+	if err != nil {
+		return err
+	}
+	tmpPath := fh.Name()
+	defer func() {
+		if err != nil {
+			fh.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	data := z.Save()
+	if _, err = fh.Write(data); err != nil {
+		return err
+	}
+
+	if info != nil {
+		if err = fh.Chmod(info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err = chown(fh, info); err != nil {
+			return fmt.Errorf("can't keep the owner and group of %s: %v",
+				path, err)
+		}
+	}
+
+	if err = fh.Sync(); err != nil {
+		return err
+	}
+	if err = fh.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	// Sync the directory, so that the rename itself is on disk too.
+	// Not all platforms support this, so we ignore errors.
+	if dh, err2 := os.Open(dir); err2 == nil {
+		dh.Sync()
+		dh.Close()
+	}
+	return nil
+}
+
+// Creates a new file in dir to write the zonefile to, which gets the mode
+// os.Create would give it
+func createTemp(dir, base string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, "."+base+".tmp"+
+			strconv.FormatUint(uint64(rand.Uint32()), 10))
+		fh, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && try < 100 {
+			continue
+		}
+		return fh, err
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package zonefile
+
+import (
+	"os"
+)
+
+// Ownership can't be set on this platform
+func chown(fh *os.File, info os.FileInfo) error {
+	return nil
+}
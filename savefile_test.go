@@ -0,0 +1,107 @@
+package zonefile_test
+
+import (
+	"github.com/bwesterb/go-zonefile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSaveFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "example.com.zone")
+
+	// A shorter zonefile should replace the whole file
+	if err := ioutil.WriteFile(path, []byte(
+		"@ IN SOA ns1 hostmaster 2019031400 3600 600 604800 60\n"+
+			"www IN A 1.2.3.4\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	zf, perr := zonefile.Load([]byte(
+		"@ IN SOA ns1 hostmaster 1 3600 600 604800 60\n"))
+	if perr != nil {
+		t.Fatal(perr)
+	}
+	if err := zf.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(zf.Save()) {
+		t.Fatalf("Unexpected contents: %q", data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0640 {
+		t.Fatal("Mode was not preserved:", info.Mode())
+	}
+
+	// No temporary files should be left behind
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatal("Unexpected files in directory:", len(files))
+	}
+
+	// Saving through a symlink should keep the symlink
+	if runtime.GOOS == "windows" {
+		return
+	}
+	link := filepath.Join(dir, "link.zone")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := zonefile.New().SaveFile(link); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil ||
+		info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("Symlink was replaced", err)
+	}
+	if data, _ := ioutil.ReadFile(path); len(data) != 0 {
+		t.Fatalf("Unexpected contents: %q", data)
+	}
+}
+
+func TestSaveFileNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "zonefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A new file gets the same mode as one made by os.Create, which
+	// follows the umask
+	fh, err := os.Create(filepath.Join(dir, "created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fh.Close()
+	path := filepath.Join(dir, "example.com.zone")
+	if err := zonefile.New().SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+	created, err := os.Stat(filepath.Join(dir, "created"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Mode() != created.Mode() {
+		t.Fatalf("Mode %v instead of %v", saved.Mode(), created.Mode())
+	}
+}
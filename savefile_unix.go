@@ -0,0 +1,45 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package zonefile
+
+import (
+	"os"
+	"syscall"
+)
+
+// Gives the file the owner and group described by info, where they
+// differ.  Usually only root may change the owner, and only to a group
+// it's in.
+func chown(fh *os.File, info os.FileInfo) error {
+	want, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	tmp, err := fh.Stat()
+	if err != nil {
+		return err
+	}
+	have, ok := tmp.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	uid, gid := -1, -1
+	if want.Uid != have.Uid {
+		uid = int(want.Uid)
+	}
+	if want.Gid != have.Gid {
+		gid = int(want.Gid)
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+	if err := fh.Chown(uid, gid); err != nil {
+		// Leave out the name of the temporary file
+		if perr, ok := err.(*os.PathError); ok {
+			return perr.Err
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package secondary
+
+import (
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"strings"
+)
+
+// Answers NOTIFY messages (RFC 1996) for the zone on the connection, and
+// makes Run check the primary when one arrives, until the connection is
+// closed.  If the primary is given as an IP address, only NOTIFY messages
+// from that address are accepted.
+func (s *Secondary) ServeNotify(conn net.PacketConn) error {
+	buf := make([]byte, 0xffff)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return err
+		}
+		if resp := s.handleNotify(buf[:n], addr); resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// Returns the response to a NOTIFY message, or nil if there should be none
+func (s *Secondary) handleNotify(msg []byte, from net.Addr) []byte {
+	q, err := wire.Unpack(msg)
+	if err != nil || q.Response {
+		return nil
+	}
+	resp := wire.Message{ID: q.ID, Response: true, Opcode: q.Opcode,
+		Question: q.Question}
+	switch {
+	case q.Opcode != wire.OpcodeNotify:
+		resp.Rcode = wire.RcodeNotImp
+	case len(q.Question) != 1 || q.Question[0].Type != wire.TypeSOA:
+		resp.Rcode = wire.RcodeFormErr
+	case !strings.EqualFold(q.Question[0].Name, s.zone()):
+		resp.Rcode = wire.RcodeNotAuth
+	case !s.fromPrimary(from):
+		resp.Rcode = wire.RcodeRefused
+	default:
+		resp.Authoritative = true
+		s.logf("received NOTIFY for zone %s from %v", s.zone(), from)
+		s.Notify()
+	}
+	b, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Checks whether the address is that of the primary, if we know it
+func (s *Secondary) fromPrimary(from net.Addr) bool {
+	host := s.Primary
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	udp, ok := from.(*net.UDPAddr)
+	if ip == nil || !ok {
+		return true
+	}
+	return ip.Equal(udp.IP)
+}
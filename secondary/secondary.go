@@ -0,0 +1,289 @@
+// Package secondary keeps a copy of a zone on a primary nameserver up to
+// date in a zonefile, as a secondary nameserver would (RFC 1034, section
+// 4.3.5).
+//
+// The SOA record of the primary is checked every refresh interval of the
+// SOA record, or every retry interval after a failure.  If its serial is
+// greater (RFC 1982), the zone is transferred, with IXFR where possible,
+// and the zonefile is written atomically.  Changes are applied in place,
+// so comments in the zonefile are kept.  When the primary can't be reached
+// for longer than the expire interval, the zonefile is moved out of the
+// way, so that it's not served any more.  A NOTIFY message (RFC 1996) from
+// the primary triggers a check right away.
+package secondary
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long we wait before checking again if the zone has no SOA record
+// to take the timers from.
+const defaultRetry = 5 * time.Minute
+
+// Keeps a zonefile up to date with a zone on a primary
+type Secondary struct {
+	Primary string // host or IP address of the primary, optionally with port
+	Zone    string // the name of the zone
+	Path    string // where the zonefile is kept
+
+	// Called for the events worth logging; may be nil
+	Logf func(format string, args ...interface{})
+
+	mu          sync.Mutex
+	zf          *zonefile.Zonefile
+	soa         timers    // of the last version of the zone we had
+	haveSOA     bool      // whether soa is set
+	lastSuccess time.Time // when we last talked to the primary
+	expired     bool
+
+	notifyOnce sync.Once
+	notify     chan struct{}
+}
+
+// The timers of an SOA record
+type timers struct {
+	serial                 zonefile.Serial
+	refresh, retry, expire time.Duration
+}
+
+// Returns the timers of an SOA record in wire format
+func soaTimers(data []byte) timers {
+	if len(data) < 20 {
+		return timers{retry: defaultRetry}
+	}
+	v := func(i int) uint32 {
+		return binary.BigEndian.Uint32(data[len(data)-20+4*i:])
+	}
+	return timers{
+		serial:  zonefile.Serial(v(0)),
+		refresh: time.Duration(v(1)) * time.Second,
+		retry:   time.Duration(v(2)) * time.Second,
+		expire:  time.Duration(v(3)) * time.Second,
+	}
+}
+
+func (s *Secondary) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Returns the name of the zone as an absolute name
+func (s *Secondary) zone() string {
+	if strings.HasSuffix(s.Zone, ".") {
+		return s.Zone
+	}
+	return s.Zone + "."
+}
+
+// Sets our copy of the zone and takes the timers from its SOA record
+func (s *Secondary) setZonefile(zf *zonefile.Zonefile) {
+	s.zf = zf
+	s.soa, s.haveSOA = timers{retry: defaultRetry}, false
+	records, err := zf.Records(s.zone())
+	if err != nil {
+		return
+	}
+	for _, r := range records {
+		if r.Type == "SOA" {
+			if _, _, data, err := r.Wire(); err == nil {
+				s.soa, s.haveSOA = soaTimers(data), true
+			}
+			return
+		}
+	}
+}
+
+// Reads the zonefile, if there is one.  Its modification time counts as
+// the last time we talked to the primary, for the expire timer.
+func (s *Secondary) load() error {
+	fi, err := os.Stat(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	zf, err := zonefile.LoadFile(s.Path)
+	if err != nil {
+		return err
+	}
+	s.setZonefile(zf)
+	s.lastSuccess = fi.ModTime()
+	return nil
+}
+
+// Checks the serial on the primary and transfers the zone if it's
+// greater than ours.  Returns whether the zonefile was written.
+func (s *Secondary) Refresh(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.zf == nil && !s.expired {
+		if err := s.load(); err != nil {
+			return false, err
+		}
+	}
+
+	if s.zf == nil || s.expired {
+		zf, err := zonefile.Transfer(ctx, s.Primary, s.zone())
+		if err != nil {
+			return false, err
+		}
+		if err := zf.SaveFile(s.Path); err != nil {
+			return false, err
+		}
+		s.setZonefile(zf)
+		s.lastSuccess, s.expired = time.Now(), false
+		s.logf("transferred zone %s with serial %v", s.zone(), s.soa.serial)
+		return true, nil
+	}
+
+	serial, err := s.primarySerial(ctx)
+	if err != nil {
+		return false, err
+	}
+	ours := s.soa.serial
+	if !serial.Greater(ours) {
+		s.lastSuccess = time.Now()
+		return false, nil
+	}
+
+	// Work on a copy, so that we still have the old version if writing
+	// fails.
+	zf, err := s.zf.Copy()
+	if err != nil {
+		return false, err
+	}
+	changed, err := zf.IncrementalTransfer(ctx, s.Primary, s.zone())
+	if err != nil {
+		return false, err
+	}
+	if changed {
+		if err := zf.SaveFile(s.Path); err != nil {
+			return false, err
+		}
+		s.setZonefile(zf)
+		s.logf("transferred zone %s from serial %v to %v", s.zone(), ours,
+			s.soa.serial)
+	}
+	s.lastSuccess = time.Now()
+	return changed, nil
+}
+
+// Asks the primary for the serial of the zone
+func (s *Secondary) primarySerial(ctx context.Context) (zonefile.Serial,
+	error) {
+	msg, err := (&wire.Message{
+		ID: wire.NewID(),
+		Question: []wire.Question{{Name: s.zone(), Type: wire.TypeSOA,
+			Class: wire.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := wire.Exchange(ctx, s.Primary, msg)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Rcode != wire.RcodeSuccess {
+		return 0, fmt.Errorf("primary responded with %v",
+			zonefile.Rcode(resp.Rcode))
+	}
+	if !resp.Authoritative {
+		return 0, errors.New("primary is not authoritative for the zone")
+	}
+	for _, rr := range resp.Answer {
+		if rr.Type == wire.TypeSOA {
+			return zonefile.Serial(wire.SOASerial(rr)), nil
+		}
+	}
+	return 0, errors.New("primary didn't send the SOA record")
+}
+
+// Moves the zonefile out of the way, if it has expired.  Returns whether
+// it has.
+func (s *Secondary) expire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired || !s.haveSOA || time.Since(s.lastSuccess) < s.soa.expire {
+		return s.expired
+	}
+	s.expired = true
+	s.zf = nil
+	if err := os.Rename(s.Path, s.Path+".expired"); err != nil &&
+		!os.IsNotExist(err) {
+		s.logf("zone %s expired, but: %v", s.zone(), err)
+	} else {
+		s.logf("zone %s expired; moved it to %s.expired", s.zone(), s.Path)
+	}
+	return true
+}
+
+// Whether the zone has expired: the primary couldn't be reached for
+// longer than the expire interval.  The zonefile is moved to the path
+// with ".expired" appended until the zone is transferred again.
+func (s *Secondary) Expired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expired
+}
+
+// Makes Run check the primary right away, as when a NOTIFY message is
+// received.
+func (s *Secondary) Notify() {
+	select {
+	case s.notifications() <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Secondary) notifications() chan struct{} {
+	s.notifyOnce.Do(func() {
+		s.notify = make(chan struct{}, 1)
+	})
+	return s.notify
+}
+
+// Keeps the zonefile up to date until the context is done.  Errors are
+// logged and the check is retried after the retry interval.
+func (s *Secondary) Run(ctx context.Context) error {
+	notify := s.notifications()
+	for {
+		_, err := s.Refresh(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logf("refreshing zone %s: %v", s.zone(), err)
+		}
+		s.expire()
+		s.mu.Lock()
+		wait := s.soa.refresh
+		if err != nil || !s.haveSOA || s.expired {
+			wait = s.soa.retry
+		}
+		s.mu.Unlock()
+		if wait <= 0 {
+			wait = time.Second
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
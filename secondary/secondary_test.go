@@ -0,0 +1,209 @@
+package secondary_test
+
+import (
+	"context"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"github.com/bwesterb/go-zonefile/secondary"
+	"github.com/bwesterb/go-zonefile/server"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Refresh after an hour, retry after a second and expire after two
+const primaryZone = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 1 2 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1
+www  IN A   192.0.2.2
+`
+
+func startPrimary(t *testing.T) *server.Server {
+	zf, err := zonefile.Load([]byte(primaryZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err2 := server.New(zf, "")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if err := s.AllowTransfer("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Changes the address of www on the primary and bumps the serial
+func changeWWW(t *testing.T, s *server.Server, old, new string) {
+	err := s.Edit(func(zf *zonefile.Zonefile) error {
+		conflicts, err := zf.Apply([]zonefile.Operation{
+			{Kind: zonefile.DeleteRR, Name: "www", Type: "A",
+				Values: []string{old}},
+			{Kind: zonefile.AddRR, Name: "www", Type: "A",
+				Values: []string{new}},
+		}, zonefile.ApplyOptions{BumpSerial: zonefile.IncrementSerial})
+		if len(conflicts) > 0 {
+			return conflicts[0]
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "secondary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRefresh(t *testing.T) {
+	primary := startPrimary(t)
+	defer primary.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := &secondary.Secondary{
+		Primary: primary.Addr().String(),
+		Zone:    "example.com",
+		Path:    filepath.Join(dir, "example.com.zone"),
+	}
+	for i, expected := range []bool{true, false} {
+		changed, err := s.Refresh(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != expected {
+			t.Fatalf("refresh %d: changed is %v", i, changed)
+		}
+	}
+
+	// Comments we add are kept
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "192.0.2.1",
+		"192.0.2.1 ; our nameserver", 1))
+	if err := ioutil.WriteFile(s.Path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s = &secondary.Secondary{Primary: s.Primary, Zone: s.Zone, Path: s.Path}
+
+	changeWWW(t, primary, "192.0.2.2", "192.0.2.3")
+	changed, err := s.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(s.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !strings.Contains(string(data), "our nameserver") ||
+		!strings.Contains(string(data), "192.0.2.3") ||
+		!strings.Contains(string(data), "hostmaster 2 ") {
+		t.Fatalf("zonefile wasn't updated:\n%s", data)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	primary := startPrimary(t)
+	defer primary.Close()
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := &secondary.Secondary{
+		Primary: primary.Addr().String(),
+		Zone:    "example.com.",
+		Path:    filepath.Join(dir, "example.com.zone"),
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go s.ServeNotify(conn)
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	waitFor(t, s.Path, "192.0.2.2")
+
+	changeWWW(t, primary, "192.0.2.2", "192.0.2.3")
+	msg, _ := (&wire.Message{
+		ID:     wire.NewID(),
+		Opcode: wire.OpcodeNotify,
+		Question: []wire.Question{{Name: "example.com.", Type: wire.TypeSOA,
+			Class: wire.ClassINET}},
+	}).Pack()
+	resp, err := wire.Exchange(ctx, conn.LocalAddr().String(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != wire.RcodeSuccess || !resp.Authoritative {
+		t.Fatalf("wrong response to NOTIFY: %+v", resp)
+	}
+	waitFor(t, s.Path, "192.0.2.3")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	primary := startPrimary(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s := &secondary.Secondary{
+		Primary: primary.Addr().String(),
+		Zone:    "example.com.",
+		Path:    filepath.Join(dir, "example.com.zone"),
+	}
+	if _, err := s.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	primary.Close()
+	go s.Run(ctx)
+	for !s.Expired() {
+		if ctx.Err() != nil {
+			t.Fatal("zone didn't expire")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if _, err := os.Stat(s.Path); !os.IsNotExist(err) {
+		t.Fatal("expired zonefile is still there")
+	}
+	if _, err := os.Stat(s.Path + ".expired"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Waits until the file contains the string
+func waitFor(t *testing.T, path, s string) {
+	for i := 0; i < 50; i++ {
+		data, _ := ioutil.ReadFile(path)
+		if strings.Contains(string(data), s) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("%s doesn't contain %s", path, s)
+}
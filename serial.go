@@ -0,0 +1,157 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// The serial of a zone.  Serials wrap around and are compared using the
+// serial number arithmetic of RFC 1982.
+type Serial uint32
+
+// The largest amount a serial can be increased by in one step
+const MaxSerialIncrement = 1<<31 - 1
+
+// Returned when a new serial would not be greater than the old one, which
+// secondaries would take as the serial going backwards.
+var ErrSerialBackwards = errors.New("new serial is not greater than the old one")
+
+// Adds n to the serial, wrapping around as described in RFC 1982.
+func (s Serial) Add(n uint32) (Serial, error) {
+	if n > MaxSerialIncrement {
+		return s, errors.New("serial increment is too large")
+	}
+	return s + Serial(n), nil
+}
+
+// Checks whether the serial is less than t as described in RFC 1982.
+// Note that if s and t are exactly 2^31 apart, neither is less than the
+// other.
+func (s Serial) Less(t Serial) bool {
+	return s != t && uint32(t-s) < 1<<31
+}
+
+// Checks whether the serial is greater than t as described in RFC 1982.
+func (s Serial) Greater(t Serial) bool {
+	return t.Less(s)
+}
+
+func (s Serial) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+// Computes the new serial of a zone from the old one
+type SerialStrategy func(old Serial) (Serial, error)
+
+// Increments the serial by one
+func IncrementSerial(old Serial) (Serial, error) {
+	return old + 1, nil
+}
+
+// Returns a strategy that sets the serial to the given date in the
+// YYYYMMDDnn format.  If the old serial is that date or later, it is
+// incremented instead: the counter nn rolls and, after 99 changes in a
+// day, the serial will run ahead of the date.
+func DateSerial(date time.Time) SerialStrategy {
+	year, month, day := date.Date()
+	return func(old Serial) (Serial, error) {
+		v := ((uint64(year)*100+uint64(month))*100 + uint64(day)) * 100
+		if year < 0 || v > math.MaxUint32 {
+			return old, errors.New("year is out of range for a serial")
+		}
+		s := Serial(v)
+		if s.Greater(old) {
+			return s, nil
+		}
+		return old + 1, nil
+	}
+}
+
+// Returns a strategy that sets the serial to the given time as seconds
+// since the Unix epoch.  If the old serial is that time or later, it is
+// incremented instead.
+func UnixTimeSerial(t time.Time) SerialStrategy {
+	return func(old Serial) (Serial, error) {
+		s := Serial(t.Unix())
+		if s.Greater(old) {
+			return s, nil
+		}
+		return old + 1, nil
+	}
+}
+
+// Returns a strategy that sets the serial to the given value.
+func SetSerial(serial Serial) SerialStrategy {
+	return func(old Serial) (Serial, error) {
+		return serial, nil
+	}
+}
+
+// Parses a serial
+func ParseSerial(s []byte) (Serial, error) {
+	v, err := strconv.ParseUint(string(s), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return Serial(v), nil
+}
+
+// Returns the first SOA entry in the zonefile, or nil if there is none.
+func (z *Zonefile) SOA() *Entry {
+	for i := range z.entries {
+		if bytes.Equal(z.entries[i].Type(), []byte("SOA")) {
+			return &z.entries[i]
+		}
+	}
+	return nil
+}
+
+// Returns the serial in the SOA record of the zonefile
+func (z *Zonefile) Serial() (Serial, error) {
+	soa := z.SOA()
+	if soa == nil {
+		return 0, errors.New("could not find SOA entry")
+	}
+	return soa.serial()
+}
+
+// Changes the serial in the SOA record of the zonefile as the strategy
+// says.  Returns the old and new serial.  If the new serial is not
+// greater than the old one, the zonefile is not changed and
+// ErrSerialBackwards is returned.
+func (z *Zonefile) BumpSerial(strategy SerialStrategy) (old, new Serial,
+	err error) {
+	soa := z.SOA()
+	if soa == nil {
+		return 0, 0, errors.New("could not find SOA entry")
+	}
+	old, err = soa.serial()
+	if err != nil {
+		return
+	}
+	new, err = strategy(old)
+	if err != nil {
+		return
+	}
+	if !new.Greater(old) {
+		return old, new, ErrSerialBackwards
+	}
+	err = soa.SetValue(2, []byte(new.String()))
+	return
+}
+
+// Returns the serial of an SOA entry
+func (e Entry) serial() (Serial, error) {
+	vs := e.Values()
+	if len(vs) != 7 {
+		return 0, errors.New("wrong number of parameters to SOA entry")
+	}
+	s, err := ParseSerial(vs[2])
+	if err != nil {
+		return 0, errors.New("could not parse serial: " + err.Error())
+	}
+	return s, nil
+}
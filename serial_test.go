@@ -0,0 +1,123 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+	"time"
+)
+
+func TestSerialArithmetic(t *testing.T) {
+	for _, test := range []struct {
+		a, b    zonefile.Serial
+		less    bool
+		greater bool
+	}{
+		{1, 2, true, false},
+		{2, 1, false, true},
+		{1, 1, false, false},
+		{4294967295, 0, true, false},
+		{0, 4294967295, false, true},
+		{0, 1<<31 - 1, true, false},
+		{0, 1 << 31, false, false}, // undefined
+		{1 << 31, 0, false, false}, // undefined
+		{100, 1<<31 + 101, false, true},
+	} {
+		if test.a.Less(test.b) != test.less {
+			t.Errorf("%v < %v should be %v", test.a, test.b, test.less)
+		}
+		if test.a.Greater(test.b) != test.greater {
+			t.Errorf("%v > %v should be %v", test.a, test.b, test.greater)
+		}
+	}
+
+	s, err := zonefile.Serial(4294967295).Add(2)
+	if err != nil || s != 1 {
+		t.Fatal("Adding should wrap around", s, err)
+	}
+	if _, err := zonefile.Serial(1).Add(1 << 31); err == nil {
+		t.Fatal("Adding 2^31 should not be allowed")
+	}
+}
+
+func TestSerialStrategies(t *testing.T) {
+	date := time.Date(2019, 3, 14, 12, 0, 0, 0, time.UTC)
+	for i, test := range []struct {
+		strategy zonefile.SerialStrategy
+		old, new zonefile.Serial
+	}{
+		{zonefile.IncrementSerial, 1, 2},
+		{zonefile.IncrementSerial, 4294967295, 0},
+		{zonefile.DateSerial(date), 1, 2019031400},
+		{zonefile.DateSerial(date), 2019031300, 2019031400},
+		{zonefile.DateSerial(date), 2019031400, 2019031401},
+		{zonefile.DateSerial(date), 2019031499, 2019031500},
+		{zonefile.DateSerial(date), 2019031512, 2019031513},
+		{zonefile.DateSerial(date), 4000000000, 4000000001},
+		{zonefile.UnixTimeSerial(date), 1, 1552564800},
+		{zonefile.UnixTimeSerial(date), 1552564800, 1552564801},
+		{zonefile.SetSerial(10), 5, 10},
+	} {
+		new, err := test.strategy(test.old)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if new != test.new {
+			t.Errorf("%d: expected %v, got %v", i, test.new, new)
+		}
+	}
+	// Dates whose serial doesn't fit in 32 bits
+	late := time.Date(4294, 12, 31, 0, 0, 0, 0, time.UTC)
+	if s, err := zonefile.DateSerial(late)(4294000000); err != nil || s != 4294123100 {
+		t.Fatalf("expected 4294123100, got %v, %v", s, err)
+	}
+	if _, err := zonefile.DateSerial(late.AddDate(1, 0, 0))(1); err == nil {
+		t.Fatal("expected an error for the year 4295")
+	}
+}
+
+func TestBumpSerial(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"@ IN SOA ns1 hostmaster ( 2019031400 3600 600 604800 60 )\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	old, new, err2 := zf.BumpSerial(zonefile.IncrementSerial)
+	if err2 != nil || old != 2019031400 || new != 2019031401 {
+		t.Fatal("Incrementing serial failed:", old, new, err2)
+	}
+	expected := "@ IN SOA ns1 hostmaster ( 2019031401 3600 600 604800 60 )\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+
+	// Setting the serial to a lower value should be refused
+	_, _, err2 = zf.BumpSerial(zonefile.SetSerial(1))
+	if err2 != zonefile.ErrSerialBackwards {
+		t.Fatal("Setting a lower serial should be refused:", err2)
+	}
+	if string(zf.Save()) != expected {
+		t.Fatal("Refused change of serial changed the zonefile")
+	}
+
+	// ... but a serial may wrap around
+	_, _, err2 = zf.BumpSerial(zonefile.SetSerial(4000000000))
+	if err2 != nil {
+		t.Fatal("Setting a higher serial should be allowed:", err2)
+	}
+	_, _, err2 = zf.BumpSerial(zonefile.SetSerial(1000))
+	if err2 != nil {
+		t.Fatal("Wrapping serial should be allowed:", err2)
+	}
+}
+
+func ExampleZonefile_BumpSerial() {
+	zf, _ := zonefile.Load([]byte(
+		"@ IN SOA ns1 hostmaster 2019031402 3600 600 604800 60"))
+	date := time.Date(2019, 3, 15, 0, 0, 0, 0, time.UTC)
+	old, new, _ := zf.BumpSerial(zonefile.DateSerial(date))
+	fmt.Println(old, "->", new)
+	fmt.Println(string(zf.Save()))
+	// Output: 2019031402 -> 2019031500
+	// @ IN SOA ns1 hostmaster 2019031500 3600 600 604800 60
+}
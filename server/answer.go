@@ -0,0 +1,166 @@
+package server
+
+import (
+	"github.com/bwesterb/go-zonefile/internal/wire"
+)
+
+// The number of CNAME records we follow in one answer
+const maxChain = 8
+
+// Fills in the answer to the question, as in section 4.3.2 of RFC 1034
+func (z *zone) answer(q wire.Question, resp *wire.Message) {
+	qname, err := wire.CanonicalName(q.Name)
+	if err != nil {
+		resp.Rcode = wire.RcodeFormErr
+		return
+	}
+	if q.Class != z.class && q.Class != wire.ClassANY ||
+		!wire.IsSubdomain(qname, z.apex) {
+		resp.Rcode = wire.RcodeRefused
+		return
+	}
+	switch q.Type {
+	case wire.TypeAXFR, wire.TypeIXFR, wire.TypeMAILA, wire.TypeMAILB:
+		resp.Rcode = wire.RcodeNotImp
+		return
+	}
+
+	resp.Authoritative = true
+	var targets []string // for the additional section
+	for chain := 0; ; chain++ {
+		// Stop at the first delegation on the way down
+		if ns := z.delegation(qname, q.Type); ns != nil {
+			resp.Authoritative = len(resp.Answer) > 0
+			resp.Authority = append(resp.Authority, rrs(ns)...)
+			targets = append(targets, targetsOf(ns)...)
+			break
+		}
+
+		rrsets, owner := z.names[qname], qname
+		if rrsets == nil {
+			owner = z.wildcard(qname)
+			rrsets = z.names[owner]
+		}
+		if rrsets == nil {
+			resp.Rcode = wire.RcodeNXDomain
+			resp.Authority = append(resp.Authority, z.negativeSOA())
+			break
+		}
+
+		var found []record
+		if q.Type == wire.TypeANY {
+			for _, rs := range rrsets {
+				found = append(found, rs...)
+			}
+		} else {
+			found = rrsets[q.Type]
+		}
+		if len(found) > 0 {
+			resp.Answer = append(resp.Answer, synthesise(found, qname)...)
+			targets = append(targets, targetsOf(found)...)
+			break
+		}
+
+		cname := rrsets[wire.TypeCNAME]
+		if len(cname) == 0 {
+			// NODATA
+			resp.Authority = append(resp.Authority, z.negativeSOA())
+			break
+		}
+		resp.Answer = append(resp.Answer, synthesise(cname, qname)...)
+		qname = cname[0].target
+		if !wire.IsSubdomain(qname, z.apex) || chain == maxChain {
+			break
+		}
+	}
+
+	resp.Additional = append(resp.Additional, z.addresses(targets)...)
+}
+
+// Returns the NS records of the delegation the name is in or below, if
+// any.  A DS query for the delegation itself is answered by this zone.
+func (z *zone) delegation(name string, typ uint16) []record {
+	labels, _ := wire.SplitName(name)
+	apex, _ := wire.SplitName(z.apex)
+	for i := len(labels) - len(apex) - 1; i >= 0; i-- {
+		if i == 0 && typ == typeDS {
+			break
+		}
+		cut := wire.JoinName(labels[i:])
+		if ns := z.names[cut][wire.TypeNS]; len(ns) > 0 {
+			return ns
+		}
+	}
+	return nil
+}
+
+const typeDS = 43
+
+// Returns the wildcard that matches the name, as in RFC 4592: the name *
+// below its closest encloser.  Returns "" if there is none.
+func (z *zone) wildcard(name string) string {
+	for n := name; n != z.apex && n != "."; {
+		n = wire.ParentName(n)
+		if z.names[n] == nil {
+			continue
+		}
+		// n is the closest encloser
+		wildcard := "*." + n
+		if n == "." {
+			wildcard = "*."
+		}
+		if z.names[wildcard] != nil {
+			return wildcard
+		}
+		return ""
+	}
+	return ""
+}
+
+// Returns the A and AAAA records of the names that are in the zone,
+// including glue.
+func (z *zone) addresses(names []string) (r []wire.RR) {
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] || !wire.IsSubdomain(name, z.apex) {
+			continue
+		}
+		seen[name] = true
+		for _, typ := range []uint16{typeA, typeAAAA} {
+			r = append(r, rrs(z.names[name][typ])...)
+		}
+	}
+	return
+}
+
+const (
+	typeA    = 1
+	typeAAAA = 28
+)
+
+// Returns the records with the given owner, which differs from theirs if
+// they come from a wildcard.
+func synthesise(records []record, owner string) []wire.RR {
+	r := rrs(records)
+	for i := range r {
+		r[i].Name = owner
+	}
+	return r
+}
+
+func rrs(records []record) (r []wire.RR) {
+	for _, rec := range records {
+		r = append(r, rec.rr)
+	}
+	return
+}
+
+// Returns the names to look up for the additional section
+func targetsOf(records []record) (r []string) {
+	for _, rec := range records {
+		if rec.target != "" && rec.rr.Type != wire.TypeCNAME {
+			r = append(r, rec.target)
+		}
+	}
+	return
+}
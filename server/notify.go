@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+)
+
+// Calls the function for each NOTIFY message (RFC 1996) for the zone, in
+// a goroutine of its own, for instance to reload the zonefile or to call
+// Refresh.  The serial is that of the SOA record in the message, or zero
+// and false if there is none.  NOTIFY messages are refused with NOTIMP
+// until a function is set.
+func (s *Server) OnNotify(f func(from net.Addr, serial zonefile.Serial,
+	ok bool)) {
+	s.mu.Lock()
+	s.onNotify = f
+	s.mu.Unlock()
+}
+
+// Returns the response to a NOTIFY message
+func (s *Server) notify(q *wire.Message, from net.Addr) []byte {
+	resp := &wire.Message{ID: q.ID, Response: true, Opcode: q.Opcode,
+		Question: q.Question}
+	s.mu.RLock()
+	z, f := s.zone, s.onNotify
+	s.mu.RUnlock()
+
+	var name string
+	var err error
+	if len(q.Question) == 1 {
+		name, err = wire.CanonicalName(q.Question[0].Name)
+	}
+	switch {
+	case f == nil:
+		resp.Rcode = wire.RcodeNotImp
+	case len(q.Question) != 1 || q.Question[0].Type != wire.TypeSOA ||
+		err != nil:
+		resp.Rcode = wire.RcodeFormErr
+	case name != z.apex || q.Question[0].Class != z.class:
+		resp.Rcode = wire.RcodeNotAuth
+	default:
+		resp.Authoritative = true
+		var serial zonefile.Serial
+		ok := false
+		for _, rr := range q.Answer {
+			if rr.Type == wire.TypeSOA {
+				serial, ok = soaSerial(rr), true
+			}
+		}
+		go f(from, serial, ok)
+	}
+	return pack(resp, 0xffff)
+}
+
+// Brings the zone up to date with the zone on the primary, as
+// Zonefile.IncrementalTransfer, and serves the result if it changed.  The
+// changes are kept in the journal, so that the server can in turn serve
+// IXFR to its own secondaries.  Returns whether the zone changed.
+func (s *Server) Refresh(ctx context.Context, primary string) (bool, error) {
+	s.editing.Lock()
+	defer s.editing.Unlock()
+	s.mu.RLock()
+	zf, origin := s.zf, s.origin
+	s.mu.RUnlock()
+	zf, err := zf.Copy()
+	if err != nil {
+		return false, err
+	}
+	changed, err := zf.IncrementalTransfer(ctx, primary, origin)
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, s.SetZonefile(zf, origin)
+}
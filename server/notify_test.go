@@ -0,0 +1,89 @@
+package server_test
+
+import (
+	"context"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	primary := startServer(t)
+	defer primary.Close()
+	if err := primary.AllowTransfer("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	secondary := startServer(t)
+	defer secondary.Close()
+	if err := secondary.AllowTransfer("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	refreshed := make(chan error)
+	secondary.OnNotify(func(from net.Addr, serial zonefile.Serial, ok bool) {
+		if !ok || serial != 2 {
+			t.Errorf("NOTIFY has serial %v, %v", serial, ok)
+		}
+		_, err := secondary.Refresh(ctx, primary.Addr().String())
+		refreshed <- err
+	})
+
+	var zf *zonefile.Zonefile
+	err := primary.Edit(func(z *zonefile.Zonefile) error {
+		conflicts, err := z.Apply([]zonefile.Operation{
+			{Kind: zonefile.DeleteRR, Name: "web", Type: "A",
+				Values: []string{"192.0.2.3"}},
+			{Kind: zonefile.AddRR, Name: "web", Type: "A",
+				Values: []string{"192.0.2.7"}},
+		}, zonefile.ApplyOptions{BumpSerial: zonefile.IncrementSerial})
+		if len(conflicts) > 0 {
+			return conflicts[0]
+		}
+		zf = z
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = zonefile.SendNotify(ctx, zf, zonefile.NotifyOptions{
+		Servers: []string{secondary.Addr().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-refreshed; err != nil {
+		t.Fatal(err)
+	}
+
+	resp := query(t, secondary.Addr().String(), "web.example.com.", 1)
+	if len(resp.Answer) != 1 || string(resp.Answer[0].Data) != "\xc0\x00\x02\x07" {
+		t.Fatalf("secondary didn't pick up the change: %+v", resp.Answer)
+	}
+
+	// The secondary serves the change as IXFR in turn
+	_, records := transfer(t, secondary.Addr().String(), wire.TypeIXFR, 1)
+	expected := "example.com./6 example.com./6 web.example.com./1 " +
+		"example.com./6 web.example.com./1 example.com./6"
+	if got := summary(records); got != expected {
+		t.Fatalf("IXFR is %s", got)
+	}
+}
+
+func TestNotifyRefused(t *testing.T) {
+	s := startServer(t)
+	defer s.Close()
+	zf, err := zonefile.Load([]byte(testZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err2 := zonefile.SendNotify(ctx, zf, zonefile.NotifyOptions{
+		Servers: []string{s.Addr().String()}})
+	if _, ok := err2.(zonefile.NotifyError); !ok {
+		t.Fatalf("NOTIFY wasn't refused: %v", err2)
+	}
+}
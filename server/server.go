@@ -0,0 +1,327 @@
+// Package server answers DNS queries for a zone straight from a Zonefile.
+//
+// It's a small authoritative nameserver over UDP and TCP, meant for tests
+// and small internal zones: it sets the AA bit, refers to the nameservers
+// of delegations, follows CNAME records within the zone, synthesises
+// records from wildcards, returns the SOA record with NXDOMAIN and NODATA
+// answers and truncates answers that don't fit in a UDP datagram.  It
+// doesn't do recursion, DNSSEC signing or EDNS beyond the payload size.
+//
+// Secondaries can transfer the zone with AXFR, or with IXFR from the
+// journal of changes the server keeps when the zone is replaced or edited,
+// if their addresses are allowed with AllowTransfer.  The server can be a
+// secondary itself, with Refresh and OnNotify.
+package server
+
+import (
+	"errors"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"sync"
+	"time"
+)
+
+// The payload size we advertise with EDNS
+const ednsSize = 1232
+
+// How long an idle TCP connection is kept open
+const tcpIdleTimeout = 10 * time.Second
+
+// Answers queries for a zone over UDP and TCP
+type Server struct {
+	mu     sync.RWMutex
+	zone   *zone
+	zf     *zonefile.Zonefile // the zonefile the zone was read from
+	origin string
+
+	journal     []delta // the last changes to the zone, oldest first
+	transferACL []*net.IPNet
+	editing     sync.Mutex // held during Edit and Refresh
+	onNotify    func(from net.Addr, serial zonefile.Serial, ok bool)
+
+	udp    net.PacketConn
+	tcp    net.Listener
+	wg     sync.WaitGroup
+	closed bool
+	conns  map[net.Conn]bool
+}
+
+// Creates a server for the zone in the zonefile.  The origin is that of
+// the zone, as for Zonefile.Records, and may be left empty if the zonefile
+// starts with $ORIGIN.  The server serves a copy: later changes to the
+// zonefile are not served until SetZonefile is called.
+func New(zf *zonefile.Zonefile, origin string) (*Server, error) {
+	z, err := newZone(zf, origin)
+	if err != nil {
+		return nil, err
+	}
+	if zf, err = zf.Copy(); err != nil {
+		return nil, err
+	}
+	return &Server{zone: z, zf: zf, origin: origin,
+		conns: make(map[net.Conn]bool)}, nil
+}
+
+// Replaces the zone that is served.  Queries that are being answered
+// still see the previous zone.  If the serial increased, the changes are
+// kept in a journal to answer IXFR queries; otherwise the journal is
+// cleared and secondaries have to transfer the whole zone.
+func (s *Server) SetZonefile(zf *zonefile.Zonefile, origin string) error {
+	z, err := newZone(zf, origin)
+	if err != nil {
+		return err
+	}
+	if zf, err = zf.Copy(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.record(s.zone, z)
+	s.zone, s.zf, s.origin = z, zf, origin
+	s.mu.Unlock()
+	return nil
+}
+
+// Edits the zone that is served: calls the function with a copy of the
+// zonefile and serves the result, as SetZonefile, unless the function
+// returns an error.  Remember to bump the serial, for instance with
+// ApplyOptions.BumpSerial.
+func (s *Server) Edit(edit func(zf *zonefile.Zonefile) error) error {
+	s.editing.Lock()
+	defer s.editing.Unlock()
+	s.mu.RLock()
+	zf, origin := s.zf, s.origin
+	s.mu.RUnlock()
+	zf, err := zf.Copy()
+	if err != nil {
+		return err
+	}
+	if err := edit(zf); err != nil {
+		return err
+	}
+	return s.SetZonefile(zf, origin)
+}
+
+// Returns the zone that is served
+func (s *Server) current() *zone {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.zone
+}
+
+// Starts answering queries on UDP and TCP at the address, in the
+// background.  If the port is 0, a free port is picked that is the same
+// for UDP and TCP; see Addr.
+func (s *Server) Listen(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.udp != nil || s.closed {
+		return errors.New("server is already listening or closed")
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		l.Close()
+		return err
+	}
+	s.udp, s.tcp = pc, l
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// Returns the address the server listens on, or nil if it doesn't
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+// Stops the server and waits until it's done
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var err error
+	if s.udp != nil {
+		err = s.udp.Close()
+		if err2 := s.tcp.Close(); err == nil {
+			err = err2
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 0xffff)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		for _, resp := range s.handle(buf[:n], addr, false) {
+			s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Answers the queries on a TCP connection until it's closed or idle
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		msg, err := wire.ReadTCP(conn)
+		if err != nil {
+			return
+		}
+		for _, resp := range s.handle(msg, conn.RemoteAddr(), true) {
+			if err := wire.WriteTCP(conn, resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Returns the response to a message from the address, which are several
+// messages for zone transfers and none if there should be no response.
+func (s *Server) handle(msg []byte, from net.Addr, tcp bool) [][]byte {
+	q, err := wire.Unpack(msg)
+	if err != nil {
+		if len(msg) < 12 || msg[2]&0x80 != 0 {
+			return nil
+		}
+		// Echo the header with FORMERR
+		resp := wire.Message{ID: uint16(msg[0])<<8 | uint16(msg[1]),
+			Response: true, Opcode: int(msg[2]>>3) & 0xf,
+			Rcode: wire.RcodeFormErr}
+		b, _ := resp.Pack()
+		return [][]byte{b}
+	}
+	if q.Response {
+		return nil
+	}
+	if q.Opcode == wire.OpcodeQuery && len(q.Question) == 1 &&
+		(q.Question[0].Type == wire.TypeAXFR ||
+			q.Question[0].Type == wire.TypeIXFR) {
+		return s.transfer(q, from, tcp)
+	}
+	if q.Opcode == wire.OpcodeNotify {
+		return [][]byte{s.notify(q, from)}
+	}
+
+	resp := &wire.Message{
+		ID:               q.ID,
+		Response:         true,
+		Opcode:           q.Opcode,
+		RecursionDesired: q.RecursionDesired,
+		Question:         q.Question,
+	}
+	maxSize := 0xffff
+	var opt *wire.RR
+	for i, rr := range q.Additional {
+		if rr.Type == wire.TypeOPT {
+			opt = &q.Additional[i]
+		}
+	}
+	if !tcp {
+		maxSize = wire.MaxUDPSize
+		if opt != nil && int(opt.Class) > maxSize {
+			maxSize = int(opt.Class)
+			if maxSize > ednsSize {
+				maxSize = ednsSize
+			}
+		}
+	}
+
+	switch {
+	case q.Opcode != wire.OpcodeQuery:
+		resp.Rcode = wire.RcodeNotImp
+	case len(q.Question) != 1:
+		resp.Rcode = wire.RcodeFormErr
+	default:
+		s.current().answer(q.Question[0], resp)
+	}
+	if opt != nil {
+		resp.Additional = append(resp.Additional, wire.RR{Name: ".",
+			Type: wire.TypeOPT, Class: ednsSize})
+	}
+	return [][]byte{pack(resp, maxSize)}
+}
+
+// Packs the response.  If it's too big, the additional section is left
+// out, except for the OPT record; if it's still too big, the answer and
+// authority sections are left out too and the TC bit is set.
+func pack(resp *wire.Message, maxSize int) []byte {
+	b, err := resp.Pack()
+	if err != nil {
+		resp.Answer, resp.Authority, resp.Additional = nil, nil, nil
+		resp.Rcode = wire.RcodeServFail
+		b, _ = resp.Pack()
+		return b
+	}
+	if len(b) <= maxSize {
+		return b
+	}
+	var opt []wire.RR
+	for _, rr := range resp.Additional {
+		if rr.Type == wire.TypeOPT {
+			opt = append(opt, rr)
+		}
+	}
+	resp.Additional = opt
+	if b, _ = resp.Pack(); len(b) <= maxSize {
+		return b
+	}
+	resp.Answer, resp.Authority = nil, nil
+	resp.Truncated = true
+	b, _ = resp.Pack()
+	return b
+}
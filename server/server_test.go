@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"github.com/bwesterb/go-zonefile/server"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testZone = `$ORIGIN example.com.
+$TTL 3600
+@          IN SOA   ns1 hostmaster 1 3600 600 604800 60
+           IN NS    ns1
+           IN MX    10 mail
+ns1        IN A     192.0.2.1
+mail       IN A     192.0.2.2
+www        IN CNAME web
+web        IN A     192.0.2.3
+ext        IN CNAME www.example.org.
+loop       IN CNAME loop
+*.dyn      IN A     192.0.2.4
+a.b.c      IN A     192.0.2.5
+sub        IN NS    ns.sub
+ns.sub     IN A     192.0.2.6
+big        IN TXT   "` + strings.Repeat("x", 200) + `"
+           IN TXT   "` + strings.Repeat("y", 200) + `"
+           IN TXT   "` + strings.Repeat("z", 200) + `"
+`
+
+func startServer(t testing.TB) *server.Server {
+	zf, err := zonefile.Load([]byte(testZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err2 := server.New(zf, "")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func query(t testing.TB, addr, name string, typ uint16) *wire.Message {
+	msg, err := (&wire.Message{
+		ID:       wire.NewID(),
+		Question: []wire.Question{{Name: name, Type: typ, Class: wire.ClassINET}},
+	}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := wire.Exchange(ctx, addr, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// Writes the owners and types of the records
+func summary(rrs []wire.RR) string {
+	var r []string
+	for _, rr := range rrs {
+		r = append(r, fmt.Sprintf("%s/%d", rr.Name, rr.Type))
+	}
+	return strings.Join(r, " ")
+}
+
+func TestServer(t *testing.T) {
+	s := startServer(t)
+	defer s.Close()
+	addr := s.Addr().String()
+
+	for _, test := range []struct {
+		name      string
+		typ       uint16
+		rcode     int
+		aa        bool
+		answer    string
+		authority string
+		extra     string
+	}{
+		{"web.example.com.", 1, 0, true, "web.example.com./1", "", ""},
+		{"WEB.Example.COM.", 1, 0, true, "WEB.Example.COM./1", "", ""},
+		{"example.com.", 15, 0, true, "example.com./15", "",
+			"mail.example.com./1"},
+		// CNAME chasing
+		{"www.example.com.", 1, 0, true,
+			"www.example.com./5 web.example.com./1", "", ""},
+		{"www.example.com.", 5, 0, true, "www.example.com./5", "", ""},
+		{"ext.example.com.", 1, 0, true, "ext.example.com./5", "", ""},
+		{"loop.example.com.", 1, 0, true, strings.Repeat(
+			"loop.example.com./5 ", 8) + "loop.example.com./5", "", ""},
+		// NODATA and NXDOMAIN
+		{"web.example.com.", 28, 0, true, "", "example.com./6", ""},
+		{"b.c.example.com.", 1, 0, true, "", "example.com./6", ""},
+		{"nx.example.com.", 1, 3, true, "", "example.com./6", ""},
+		// Wildcards
+		{"host.dyn.example.com.", 1, 0, true, "host.dyn.example.com./1", "",
+			""},
+		{"a.host.dyn.example.com.", 1, 0, true,
+			"a.host.dyn.example.com./1", "", ""},
+		{"host.dyn.example.com.", 28, 0, true, "", "example.com./6", ""},
+		// Referrals
+		{"sub.example.com.", 1, 0, false, "", "sub.example.com./2",
+			"ns.sub.example.com./1"},
+		{"www.sub.example.com.", 1, 0, false, "", "sub.example.com./2",
+			"ns.sub.example.com./1"},
+		// Not our zone
+		{"example.org.", 1, 5, false, "", "", ""},
+	} {
+		resp := query(t, addr, test.name, test.typ)
+		desc := fmt.Sprintf("%s/%d", test.name, test.typ)
+		if resp.Rcode != test.rcode {
+			t.Fatalf("%s: rcode %d instead of %d", desc, resp.Rcode,
+				test.rcode)
+		}
+		if resp.Authoritative != test.aa {
+			t.Fatalf("%s: AA is %v", desc, resp.Authoritative)
+		}
+		if got := summary(resp.Answer); got != test.answer {
+			t.Fatalf("%s: answer %q instead of %q", desc, got, test.answer)
+		}
+		if got := summary(resp.Authority); got != test.authority {
+			t.Fatalf("%s: authority %q instead of %q", desc, got,
+				test.authority)
+		}
+		if got := summary(resp.Additional); got != test.extra {
+			t.Fatalf("%s: additional %q instead of %q", desc, got, test.extra)
+		}
+	}
+}
+
+func TestServerNegativeTTL(t *testing.T) {
+	s := startServer(t)
+	defer s.Close()
+	resp := query(t, s.Addr().String(), "nx.example.com.", 1)
+	if len(resp.Authority) != 1 || resp.Authority[0].TTL != 60 {
+		t.Fatalf("SOA TTL is not the minimum: %+v", resp.Authority)
+	}
+}
+
+func TestServerTruncation(t *testing.T) {
+	s := startServer(t)
+	defer s.Close()
+	msg, _ := (&wire.Message{
+		ID: 1,
+		Question: []wire.Question{{Name: "big.example.com.", Type: 16,
+			Class: wire.ClassINET}},
+	}).Pack()
+
+	// Over UDP the answer doesn't fit ...
+	conn, err := net.Dial("udp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := wire.Unpack(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Truncated || len(resp.Answer) != 0 || n > 512 {
+		t.Fatalf("response is not truncated: %d bytes, %+v", n, resp)
+	}
+
+	// ... so Exchange retries over TCP
+	resp = query(t, s.Addr().String(), "big.example.com.", 16)
+	if resp.Truncated || len(resp.Answer) != 3 {
+		t.Fatalf("TCP response is truncated: %+v", resp)
+	}
+}
+
+func TestSetZonefile(t *testing.T) {
+	s := startServer(t)
+	defer s.Close()
+	zf, err := zonefile.Load([]byte(strings.Replace(testZone, "192.0.2.3",
+		"192.0.2.7", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetZonefile(zf, ""); err != nil {
+		t.Fatal(err)
+	}
+	resp := query(t, s.Addr().String(), "web.example.com.", 1)
+	if len(resp.Answer) != 1 || string(resp.Answer[0].Data) != "\xc0\x00\x02\x07" {
+		t.Fatalf("old zone is served: %+v", resp.Answer)
+	}
+}
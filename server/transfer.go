@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+)
+
+// The number of changes kept in the journal to answer IXFR queries
+const journalSize = 100
+
+// The number of octets of records we put in one message of a transfer,
+// leaving room for the header, the question and compression gone wrong.
+const transferBatch = 60000
+
+// The changes between two versions of the zone
+type delta struct {
+	oldSOA, newSOA wire.RR
+	removed, added []wire.RR
+}
+
+// Returns the serial of the zone
+func (z *zone) serial() zonefile.Serial {
+	return soaSerial(z.soa.rr)
+}
+
+func soaSerial(soa wire.RR) zonefile.Serial {
+	return zonefile.Serial(wire.SOASerial(soa))
+}
+
+// Returns the changes from the old to the new version of the zone, or
+// false if they can't be served as IXFR because the serial didn't
+// increase.
+func diffZones(old, new *zone) (delta, bool) {
+	if old.apex != new.apex || !new.serial().Greater(old.serial()) {
+		return delta{}, false
+	}
+	key := func(rr wire.RR) string {
+		return fmt.Sprintf("%s %d %d %d %x", rr.Name, rr.Type, rr.Class,
+			rr.TTL, rr.Data)
+	}
+	inOld := make(map[string]bool)
+	for _, r := range old.records {
+		inOld[key(r.rr)] = true
+	}
+	inNew := make(map[string]bool)
+	for _, r := range new.records {
+		inNew[key(r.rr)] = true
+	}
+	d := delta{oldSOA: old.soa.rr, newSOA: new.soa.rr}
+	for _, r := range old.records {
+		if !inNew[key(r.rr)] && r.rr.Type != wire.TypeSOA {
+			d.removed = append(d.removed, r.rr)
+		}
+	}
+	for _, r := range new.records {
+		if !inOld[key(r.rr)] && r.rr.Type != wire.TypeSOA {
+			d.added = append(d.added, r.rr)
+		}
+	}
+	return d, true
+}
+
+// Records the change to the new zone in the journal.  Must be called with
+// the lock held.
+func (s *Server) record(old, new *zone) {
+	d, ok := diffZones(old, new)
+	if !ok {
+		// Clients will have to do a full transfer
+		s.journal = nil
+		return
+	}
+	s.journal = append(s.journal, d)
+	if len(s.journal) > journalSize {
+		s.journal = append([]delta{}, s.journal[len(s.journal)-journalSize:]...)
+	}
+}
+
+// Returns the changes since the given serial, or false if the journal
+// doesn't go back that far.  Must be called with the lock held.
+func (s *Server) changesSince(serial zonefile.Serial) ([]delta, bool) {
+	for i, d := range s.journal {
+		if soaSerial(d.oldSOA) == serial {
+			return s.journal[i:], true
+		}
+	}
+	return nil, false
+}
+
+// Allows zone transfers to the given IP addresses and networks, such as
+// 192.0.2.1 or 2001:db8::/32.  Zone transfers are refused by default.
+func (s *Server) AllowTransfer(addrs ...string) error {
+	var nets []*net.IPNet
+	for _, a := range addrs {
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return fmt.Errorf("invalid address or network %q", a)
+			}
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			n = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		}
+		nets = append(nets, n)
+	}
+	s.mu.Lock()
+	s.transferACL = append(s.transferACL, nets...)
+	s.mu.Unlock()
+	return nil
+}
+
+// Checks whether the address may transfer the zone
+func (s *Server) mayTransfer(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, n := range s.transferACL {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the response to an AXFR (RFC 5936) or IXFR (RFC 1995) query,
+// which may take several messages over TCP.
+func (s *Server) transfer(q *wire.Message, from net.Addr, tcp bool) [][]byte {
+	resp := &wire.Message{ID: q.ID, Response: true, Opcode: q.Opcode,
+		Question: q.Question}
+	fail := func(rcode int) [][]byte {
+		resp.Rcode = rcode
+		return [][]byte{pack(resp, 0xffff)}
+	}
+
+	s.mu.RLock()
+	z := s.zone
+	var changes []delta
+	haveChanges := false
+	question := q.Question[0]
+	if question.Type == wire.TypeIXFR && len(q.Authority) == 1 &&
+		q.Authority[0].Type == wire.TypeSOA {
+		changes, haveChanges = s.changesSince(soaSerial(q.Authority[0]))
+	}
+	s.mu.RUnlock()
+
+	name, err := wire.CanonicalName(question.Name)
+	switch {
+	case err != nil:
+		return fail(wire.RcodeFormErr)
+	case name != z.apex || question.Class != z.class:
+		return fail(wire.RcodeNotAuth)
+	case !s.mayTransfer(from):
+		return fail(wire.RcodeRefused)
+	case question.Type == wire.TypeIXFR && (len(q.Authority) != 1 ||
+		q.Authority[0].Type != wire.TypeSOA):
+		return fail(wire.RcodeFormErr)
+	case question.Type == wire.TypeAXFR && !tcp:
+		return fail(wire.RcodeNotImp)
+	}
+	resp.Authoritative = true
+
+	var records []wire.RR
+	switch {
+	case question.Type == wire.TypeIXFR &&
+		!z.serial().Greater(soaSerial(q.Authority[0])):
+		// The client is up to date
+		records = []wire.RR{z.soa.rr}
+	case question.Type == wire.TypeIXFR && !tcp:
+		// The client should retry over TCP
+		records = []wire.RR{z.soa.rr}
+	case haveChanges:
+		records = append(records, z.soa.rr)
+		for _, d := range changes {
+			records = append(records, d.oldSOA)
+			records = append(records, d.removed...)
+			records = append(records, d.newSOA)
+			records = append(records, d.added...)
+		}
+		records = append(records, z.soa.rr)
+	default:
+		// AXFR, also in answer to IXFR if the journal doesn't go back
+		// far enough.
+		records = append(records, z.soa.rr)
+		for _, r := range z.records {
+			if r.rr.Type != wire.TypeSOA {
+				records = append(records, r.rr)
+			}
+		}
+		records = append(records, z.soa.rr)
+	}
+	return packTransfer(resp, records)
+}
+
+// Packs the records in as few messages as possible.  Only the first
+// message has the question.
+func packTransfer(resp *wire.Message, records []wire.RR) (msgs [][]byte) {
+	size := 0
+	for _, rr := range records {
+		rrSize := len(rr.Name) + 12 + len(rr.Data)
+		if size+rrSize > transferBatch && len(resp.Answer) > 0 {
+			msgs = append(msgs, pack(resp, 0xffff))
+			resp.Question, resp.Answer, size = nil, nil, 0
+		}
+		resp.Answer = append(resp.Answer, rr)
+		size += rrSize
+	}
+	return append(msgs, pack(resp, 0xffff))
+}
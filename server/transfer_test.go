@@ -0,0 +1,119 @@
+package server_test
+
+import (
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"testing"
+	"time"
+)
+
+// Sends a transfer query over TCP and returns the records of the response,
+// which ends with the second time the SOA record of the zone is seen.
+func transfer(t *testing.T, addr string, typ uint16, serial uint32) (
+	int, []wire.RR) {
+	q := wire.Message{
+		ID: wire.NewID(),
+		Question: []wire.Question{{Name: "example.com.", Type: typ,
+			Class: wire.ClassINET}},
+	}
+	if typ == wire.TypeIXFR {
+		data, _ := wire.AppendName(nil, "ns1.example.com.")
+		data, _ = wire.AppendName(data, "hostmaster.example.com.")
+		for _, v := range []uint32{serial, 3600, 600, 604800, 60} {
+			data = append(data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		}
+		q.Authority = []wire.RR{{Name: "example.com.", Type: wire.TypeSOA,
+			Class: wire.ClassINET, Data: data}}
+	}
+	msg, err := q.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := wire.WriteTCP(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+	var records []wire.RR
+	soas := 0
+	for {
+		b, err := wire.ReadTCP(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := wire.Unpack(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Rcode != wire.RcodeSuccess {
+			return resp.Rcode, nil
+		}
+		for _, rr := range resp.Answer {
+			records = append(records, rr)
+			if rr.Type == wire.TypeSOA && rr.Name == "example.com." &&
+				string(rr.Data) == string(records[0].Data) {
+				soas++
+			}
+		}
+		if soas >= 2 || len(records) == 1 && typ == wire.TypeIXFR {
+			return resp.Rcode, records
+		}
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	s := startServer(t)
+	defer s.Close()
+	addr := s.Addr().String()
+
+	if rcode, _ := transfer(t, addr, wire.TypeAXFR, 0); rcode != wire.RcodeRefused {
+		t.Fatalf("transfer was not refused: %d", rcode)
+	}
+	if err := s.AllowTransfer("10.0.0.0/8", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	_, records := transfer(t, addr, wire.TypeAXFR, 0)
+	if len(records) != 17 {
+		t.Fatalf("AXFR has %d records: %s", len(records), summary(records))
+	}
+
+	// Change www from a CNAME into an A record
+	err := s.Edit(func(zf *zonefile.Zonefile) error {
+		conflicts, err := zf.Apply([]zonefile.Operation{
+			{Kind: zonefile.DeleteRRset, Name: "www", Type: "CNAME"},
+			{Kind: zonefile.AddRR, Name: "www", Type: "A",
+				Values: []string{"192.0.2.3"}},
+		}, zonefile.ApplyOptions{BumpSerial: zonefile.IncrementSerial})
+		if len(conflicts) > 0 {
+			return conflicts[0]
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, records = transfer(t, addr, wire.TypeIXFR, 1)
+	expected := "example.com./6 example.com./6 www.example.com./5 " +
+		"example.com./6 www.example.com./1 example.com./6"
+	if got := summary(records); got != expected {
+		t.Fatalf("IXFR is %s", got)
+	}
+
+	// Up to date
+	_, records = transfer(t, addr, wire.TypeIXFR, 2)
+	if len(records) != 1 {
+		t.Fatalf("IXFR is %s", summary(records))
+	}
+
+	// Not in the journal: AXFR
+	_, records = transfer(t, addr, wire.TypeIXFR, 0)
+	if len(records) != 17 {
+		t.Fatalf("IXFR has %d records: %s", len(records), summary(records))
+	}
+}
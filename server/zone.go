@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+)
+
+// A record of the zone, ready to be put in a message
+type record struct {
+	rr     wire.RR
+	target string // the canonical domain name in the data to look up, if any
+}
+
+// A zone as it is served: an immutable snapshot of the records of a
+// zonefile.
+type zone struct {
+	apex  string // canonical, as all names in here
+	class uint16
+	soa   record
+
+	// The records by owner and type.  Names that exist only because there
+	// are records below them (empty non-terminals) have an empty map.
+	names map[string]map[uint16][]record
+
+	records []record // in the order of the zonefile
+}
+
+// The position of the domain name that is looked up in the data of the
+// records that have one, for CNAME chasing and additional section
+// processing.
+var targetIndex = map[string]int{
+	"CNAME": 0,
+	"NS":    0,
+	"MX":    1,
+	"SRV":   3,
+}
+
+// Resolves the records of the zonefile
+func newZone(zf *zonefile.Zonefile, origin string) (*zone, error) {
+	records, err := zf.Records(origin)
+	if err != nil {
+		return nil, err
+	}
+	z := &zone{names: make(map[string]map[uint16][]record)}
+	for _, r := range records {
+		if r.Type == "SOA" {
+			if z.apex, err = wire.CanonicalName(r.Name); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if z.apex == "" {
+		return nil, errors.New("zone has no SOA record")
+	}
+
+	for _, r := range records {
+		name, err := wire.CanonicalName(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !wire.IsSubdomain(name, z.apex) {
+			return nil, fmt.Errorf("%s is not in zone %s", r.Name, z.apex)
+		}
+		typ, class, data, err := r.Wire()
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", r.Name, r.Type, err)
+		}
+		rec := record{rr: wire.RR{Name: name, Type: typ, Class: class,
+			TTL: uint32(r.TTL), Data: data}}
+		if i, ok := targetIndex[r.Type]; ok && i < len(r.Values) {
+			if rec.target, err = wire.CanonicalName(r.Values[i]); err != nil {
+				return nil, err
+			}
+		}
+		if typ == wire.TypeSOA {
+			if z.soa.rr.Data != nil {
+				if name == z.apex {
+					return nil, errors.New("zone has more than one SOA record")
+				}
+				return nil, fmt.Errorf("SOA record for %s is not at the apex",
+					r.Name)
+			}
+			z.soa, z.class = rec, class
+		}
+		if z.names[name] == nil {
+			z.names[name] = make(map[uint16][]record)
+		}
+		if !z.contains(name, rec) {
+			z.names[name][typ] = append(z.names[name][typ], rec)
+			z.records = append(z.records, rec)
+		}
+		for n := name; n != z.apex && n != "."; {
+			n = wire.ParentName(n)
+			if z.names[n] == nil {
+				z.names[n] = make(map[uint16][]record)
+			}
+		}
+	}
+	return z, nil
+}
+
+// Checks whether the zone already has the record
+func (z *zone) contains(name string, rec record) bool {
+	for _, r := range z.names[name][rec.rr.Type] {
+		if bytes.Equal(r.rr.Data, rec.rr.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the SOA record as it is put in negative answers: with the TTL
+// the minimum of its own TTL and its minimum field (RFC 2308).
+func (z *zone) negativeSOA() wire.RR {
+	rr := z.soa.rr
+	if len(rr.Data) >= 4 {
+		min := binary.BigEndian.Uint32(rr.Data[len(rr.Data)-4:])
+		if min < rr.TTL {
+			rr.TTL = min
+		}
+	}
+	return rr
+}
@@ -0,0 +1,426 @@
+package zonefile
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// The layout of the records in a zonefile.  New and changed entries are
+// laid out in the same way, so they don't look out of place.
+type style struct {
+	inferred bool // whether there were records to infer the style from
+	useTabs  bool // whether fields are separated by tabs
+
+	// The column at which the owner, TTL, class, type and first value
+	// start, or -1 if these are not aligned.
+	columns [5]int
+
+	explicitTTL   bool   // whether most records have a TTL
+	explicitClass bool   // whether most records have a class
+	class         []byte // the class most records have
+}
+
+const colValue = colType + 1
+
+// Returns the column of the field with the given use, or -1.
+func fieldColumn(u tokenUse) int {
+	switch u {
+	case useDomain:
+		return colOwner
+	case useTTL:
+		return colTTL
+	case useClass:
+		return colClass
+	case useType:
+		return colType
+	case useValue:
+		return colValue
+	}
+	return -1
+}
+
+// Returns the style of the zonefile the entry is part of
+func (e Entry) style() style {
+	if e.zf == nil {
+		return plainStyle
+	}
+	return e.zf.inferStyle()
+}
+
+// Style with fields separated by a single space
+var plainStyle = style{columns: [5]int{-1, -1, -1, -1, -1}}
+
+// Infers the style of the records in the zonefile.  What it's inferred
+// from is counted once and kept up to date as entries are added, removed
+// and changed, so that adding many entries doesn't take quadratic time.
+func (z *Zonefile) inferStyle() (s style) {
+	for i := range s.columns {
+		s.columns[i] = -1
+	}
+	c := z.styleCounts()
+	if c.records == 0 {
+		return
+	}
+	s.inferred = true
+	s.useTabs = 2*c.tabs > c.seps
+	s.explicitTTL = 2*c.ttls > c.records
+	s.explicitClass = 2*c.classCount > c.records
+	s.class, _ = mostCommon(c.classes)
+
+	// We consider the records aligned if most types start at the same column
+	if _, n := mostCommonInt(c.starts[colType]); 2*n <= c.records {
+		return
+	}
+	for k := colTTL; k <= colValue; k++ {
+		if len(c.starts[k]) > 0 {
+			s.columns[k], _ = mostCommonInt(c.starts[k])
+		}
+	}
+	s.columns[colOwner] = 0
+	return
+}
+
+// What the style of a zonefile is inferred from: the layout of the
+// records summed up
+type styleCounts struct {
+	starts     [5]map[int]int // how many fields start at each column
+	classes    map[string]int // how many records have each class
+	records    int
+	ttls       int // the number of records with a TTL
+	classCount int // the number of records with a class
+	seps       int // the number of separators between fields
+	tabs       int // ... of which contain a tab
+}
+
+// The layout of the main line of a record, as counted in styleCounts
+type lineLayout struct {
+	starts [5]int // the column at which each field starts, or -1
+	class  string
+	seps   int
+	tabs   int
+}
+
+// Returns the counts the style of the zonefile is inferred from, which
+// are counted if they weren't yet
+func (z *Zonefile) styleCounts() *styleCounts {
+	if z.counts != nil {
+		return z.counts
+	}
+	z.counts = &styleCounts{classes: make(map[string]int)}
+	for i := range z.counts.starts {
+		z.counts.starts[i] = make(map[int]int)
+	}
+	for i := range z.entries {
+		z.count(&z.entries[i], 1)
+	}
+	return z.counts
+}
+
+// Adds the layout of the entry to the style counts, or with n -1 takes
+// it out, if they were counted
+func (z *Zonefile) count(e *Entry, n int) {
+	if z.counts != nil && !e.isControl {
+		z.counts.add(e.layoutOf(), n)
+	}
+}
+
+// Returns a function that updates the style counts of the zonefile of
+// the entry for the changes made to it in the meantime.  The counts are
+// made first, so that they don't include a half-changed entry.
+func (e *Entry) recount() func() {
+	if e.zf == nil || e.isControl {
+		return func() {}
+	}
+	c, before := e.zf.styleCounts(), e.layoutOf()
+	return func() {
+		c.add(before, -1)
+		c.add(e.layoutOf(), 1)
+	}
+}
+
+func (c *styleCounts) add(l lineLayout, n int) {
+	c.records += n
+	c.seps += n * l.seps
+	c.tabs += n * l.tabs
+	for k, col := range l.starts {
+		if col != -1 {
+			addCount(c.starts[k], col, n)
+		}
+	}
+	if l.starts[colTTL] != -1 {
+		c.ttls += n
+	}
+	if l.starts[colClass] != -1 {
+		c.classCount += n
+		if c.classes[l.class] += n; c.classes[l.class] == 0 {
+			delete(c.classes, l.class)
+		}
+	}
+}
+
+// Adds n to the count of the key, which is removed at zero
+func addCount(counts map[int]int, key, n int) {
+	if counts[key] += n; counts[key] == 0 {
+		delete(counts, key)
+	}
+}
+
+// Returns the layout of the main line of the entry, up to its first value
+func (e Entry) layoutOf() (l lineLayout) {
+	for i := range l.starts {
+		l.starts[i] = -1
+	}
+	col := 0
+Line:
+	for _, tt := range e.tokens[e.startOfLine():] {
+		switch tt.t.typ {
+		case tokenNewline, tokenComment, tokenLeftParen, tokenRightParen:
+			break Line
+		case tokenWhiteSpace:
+			if bytes.IndexAny(tt.t.val, "\r\n") != -1 {
+				break Line
+			}
+			l.seps++
+			if bytes.IndexByte(tt.t.val, '\t') != -1 {
+				l.tabs++
+			}
+		}
+		if k := fieldColumn(tt.u); k != -1 {
+			l.starts[k] = col
+			switch tt.u {
+			case useClass:
+				l.class = string(tt.t.val)
+			case useValue:
+				break Line
+			}
+		}
+		col = advance(col, tt.t.val)
+	}
+	return
+}
+
+// Returns the most common string and how often it occurs
+func mostCommon(counts map[string]int) (r []byte, n int) {
+	var best string
+	for v, c := range counts {
+		if c > n || (c == n && v < best) {
+			best, n = v, c
+		}
+	}
+	if n == 0 {
+		return nil, 0
+	}
+	return []byte(best), n
+}
+
+// Returns the most common number and how often it occurs
+func mostCommonInt(counts map[int]int) (r int, n int) {
+	for v, c := range counts {
+		if c > n || (c == n && v < r) {
+			r, n = v, c
+		}
+	}
+	return
+}
+
+// Whether the records in the zonefile are aligned in columns
+func (s style) aligned() bool {
+	return s.columns[colType] != -1
+}
+
+// Returns the whitespace that separates a field ending at column from
+// from a field that should start at column to.  If there is no room,
+// or to is -1, we use a single separator.
+func (s style) separator(from, to int) []byte {
+	if w := padding(from, to, s.useTabs); w != "" {
+		return []byte(w)
+	}
+	if s.useTabs {
+		return []byte{'\t'}
+	}
+	return []byte{' '}
+}
+
+// Returns the spaces or tabs to move from column from to column to,
+// which is empty if from is not to the left of to.
+func padding(from, to int, useTabs bool) string {
+	if from >= to {
+		return ""
+	}
+	if !useTabs {
+		return strings.Repeat(" ", to-from)
+	}
+	var tabs string
+	for ; from < to; from = advance(from, []byte{'\t'}) {
+		tabs += "\t"
+	}
+	return tabs
+}
+
+const tabWidth = 8
+
+// Returns the column after writing s starting at column col, where tabs
+// are expanded.
+func advance(col int, s []byte) int {
+	for _, c := range s {
+		if c == '\t' {
+			col = (col/tabWidth + 1) * tabWidth
+		} else {
+			col++
+		}
+	}
+	return col
+}
+
+// Returns the width of s on screen, where tabs are expanded
+func displayWidth(s string) int {
+	return advance(0, []byte(s))
+}
+
+// Creates a whitespace token
+func newSpace(ws []byte) taggedToken {
+	t := tttSpace
+	t.t.val = ws
+	return t
+}
+
+// Checks whether the token is whitespace within a line
+func (t token) isInlineSpace() bool {
+	return t.typ == tokenWhiteSpace && bytes.IndexAny(t.val, "\r\n") == -1
+}
+
+// Returns the column at which the ith token starts.
+func (e Entry) column(i int) (col int) {
+	for j := e.startOfLine(); j < i; j++ {
+		col = advance(col, e.tokens[j].t.val)
+	}
+	return
+}
+
+// Inserts the item as the ith token of the entry and adds whitespace
+// around it as needed.  The whitespace before the item follows the
+// style.  If the zonefile is aligned, we try to keep the next item in
+// its place.
+func (e *Entry) insertItem(i int, t taggedToken, s style) {
+	iStart := e.startOfLine()
+	toAdd := []taggedToken{t}
+
+	col := e.column(i)
+	if i > iStart && e.tokens[i-1].t.typ != tokenWhiteSpace ||
+		i == iStart && t.u != useDomain {
+		ws := newSpace(s.separator(col, s.columns[fieldColumn(t.u)]))
+		col = advance(col, ws.t.val)
+		toAdd = append([]taggedToken{ws}, toAdd...)
+	}
+	col = advance(col, t.t.val)
+
+	// Find the whitespace up to the next item on the line
+	iNext := i
+	for iNext < len(e.tokens) && e.tokens[iNext].t.isInlineSpace() {
+		iNext++
+	}
+	iRest := i
+	if iNext < len(e.tokens) && e.tokens[iNext].t.IsItem() {
+		if next := e.column(iNext); iNext == i {
+			toAdd = append(toAdd, newSpace(s.separator(col, -1)))
+		} else if s.aligned() && next > col {
+			toAdd = append(toAdd, newSpace(s.separator(col, next)))
+			iRest = iNext
+		}
+	}
+
+	tokens := append([]taggedToken{}, e.tokens[:i]...)
+	tokens = append(tokens, toAdd...)
+	e.tokens = append(tokens, e.tokens[iRest:]...)
+}
+
+// Lays out the owner, TTL, class and type of a new entry in the given
+// style.  If most records in the zonefile have a TTL or class, these are
+// added if missing.  The TTL added is the one returned by defaultTTL,
+// which is only called then.
+func (e *Entry) layout(s style, defaultTTL func() *int) {
+	iStart := e.startOfLine()
+	var fields []taggedToken
+	hasTTL, hasClass := false, false
+	iEnd := iStart
+	for ; iEnd < len(e.tokens); iEnd++ {
+		tt := e.tokens[iEnd]
+		if tt.t.isInlineSpace() {
+			continue
+		}
+		if !tt.t.IsItem() || tt.u == useValue || tt.u == useOther {
+			break
+		}
+		fields = append(fields, tt)
+		hasTTL = hasTTL || tt.u == useTTL
+		hasClass = hasClass || tt.u == useClass
+	}
+
+	// Add the TTL and class if most records have them
+	iAfterDomain := 0
+	if len(fields) > 0 && fields[0].u == useDomain {
+		iAfterDomain = 1
+	}
+	if s.explicitClass && !hasClass && len(s.class) != 0 {
+		tClass := tttClass
+		tClass.t.val = s.class
+		fields = append(fields[:iAfterDomain], append(
+			[]taggedToken{tClass}, fields[iAfterDomain:]...)...)
+	}
+	if s.explicitTTL && !hasTTL {
+		if ttl := defaultTTL(); ttl != nil {
+			tTTL := tttTTL
+			tTTL.t.val = []byte(strconv.Itoa(*ttl))
+			fields = append(fields[:iAfterDomain], append(
+				[]taggedToken{tTTL}, fields[iAfterDomain:]...)...)
+		}
+	}
+
+	tokens := append([]taggedToken{}, e.tokens[:iStart]...)
+	col := 0
+	for _, f := range fields {
+		if f.u != useDomain {
+			ws := newSpace(s.separator(col, s.columns[fieldColumn(f.u)]))
+			col = advance(col, ws.t.val)
+			tokens = append(tokens, ws)
+		}
+		tokens = append(tokens, f)
+		col = advance(col, f.t.val)
+	}
+	if iEnd < len(e.tokens) && e.tokens[iEnd].t.typ != tokenNewline &&
+		e.tokens[iEnd].t.typ != tokenWhiteSpace {
+		to := -1
+		if e.tokens[iEnd].u == useValue {
+			to = s.columns[colValue]
+		}
+		tokens = append(tokens, newSpace(s.separator(col, to)))
+	}
+	e.tokens = append(tokens, e.tokens[iEnd:]...)
+}
+
+// Returns the TTL a record without TTL would get at the end of the
+// zonefile: the value of the last $TTL or otherwise the TTL of the
+// last record that has one.
+func (z *Zonefile) defaultTTL() *int {
+	var dflt, last *int
+	for _, e := range z.entries {
+		if bytes.Equal(e.Command(), []byte("$TTL")) {
+			vs := e.Values()
+			if len(vs) == 0 {
+				continue
+			}
+			if ttl, err := parseTTL(string(vs[0])); err == nil {
+				dflt = &ttl
+			}
+			continue
+		}
+		if ttl := e.TTL(); ttl != nil {
+			last = ttl
+		}
+	}
+	if dflt != nil {
+		return dflt
+	}
+	return last
+}
@@ -0,0 +1,140 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func TestAddEntryFollowsStyle(t *testing.T) {
+	zf, err := zonefile.Load([]byte("$TTL 300\n" +
+		"@\t\tIN\tSOA\tns hostmaster 1 2 3 4 5\n" +
+		"www\t\tIN\tA\t1.2.3.4\n" +
+		"mail\t\tIN\tA\t1.2.3.5\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	entry, _ := zonefile.ParseEntry([]byte("ftp A 1.2.3.6"))
+	zf.AddEntry(entry)
+	entry, _ = zonefile.ParseEntry([]byte("a-long-hostname IN AAAA ::1"))
+	zf.AddEntry(entry)
+	expected := "$TTL 300\n" +
+		"@\t\tIN\tSOA\tns hostmaster 1 2 3 4 5\n" +
+		"www\t\tIN\tA\t1.2.3.4\n" +
+		"mail\t\tIN\tA\t1.2.3.5\n" +
+		"ftp\t\tIN\tA\t1.2.3.6\n" +
+		"a-long-hostname\tIN\tAAAA\t::1"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
+
+func TestAddEntryAddsTTL(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"www  3600 IN A 1.2.3.4\n" +
+			"mail 3600 IN A 1.2.3.5\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	entry, _ := zonefile.ParseEntry([]byte("ftp A 1.2.3.6"))
+	zf.AddEntry(entry)
+	expected := "www  3600 IN A 1.2.3.4\n" +
+		"mail 3600 IN A 1.2.3.5\n" +
+		"ftp  3600 IN A 1.2.3.6"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
+
+func TestAddEntryUnaligned(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"www IN A 1.2.3.4\n" +
+			"mail IN A 1.2.3.5\n" +
+			"a IN CNAME www\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	entry, _ := zonefile.ParseEntry([]byte("ftp\t\tIN  A    1.2.3.6"))
+	zf.AddEntry(entry)
+	expected := "www IN A 1.2.3.4\n" +
+		"mail IN A 1.2.3.5\n" +
+		"a IN CNAME www\n" +
+		"ftp IN A 1.2.3.6"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
+
+func TestSetTTLFollowsStyle(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"www                IN A 1.2.3.4\n" +
+			"mail          3600 IN A 1.2.3.5\n" +
+			"              3600 IN A 1.2.3.6\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	zf.Entries()[0].SetTTL(60)
+	zf.Entries()[2].SetDomain([]byte("ftp"))
+	expected := "www           60   IN A 1.2.3.4\n" +
+		"mail          3600 IN A 1.2.3.5\n" +
+		"ftp           3600 IN A 1.2.3.6\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
+
+func TestSetClassFollowsStyle(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"www\t3600\tIN\tA\t1.2.3.4\n" +
+			"mail\t3600\tIN\tA\t1.2.3.5\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	e := &zf.Entries()[0]
+	e.SetClass(nil)
+	e.SetClass([]byte("CH"))
+	expected := "www\t3600\tCH\tA\t1.2.3.4\n" +
+		"mail\t3600\tIN\tA\t1.2.3.5\n"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
+
+func ExampleZonefile_AddEntry_style() {
+	zf, _ := zonefile.Load([]byte(
+		"@     IN NS    ns1.example.com.\n" +
+			"www   IN A     1.2.3.4\n"))
+	entry, _ := zonefile.ParseEntry([]byte("mail A 1.2.3.5"))
+	zf.AddEntry(entry)
+	fmt.Print(string(zf.Save()))
+	// Output: @     IN NS    ns1.example.com.
+	// www   IN A     1.2.3.4
+	// mail  IN A     1.2.3.5
+}
+
+func TestAddEntryFollowsEdits(t *testing.T) {
+	zf, err := zonefile.Load([]byte(
+		"www\tA\t1.2.3.4\n" +
+			"mail\tA\t1.2.3.5\n"))
+	if err != nil {
+		t.Fatal("Couldn't parse zonefile:", err)
+	}
+	entry, _ := zonefile.ParseEntry([]byte("ftp A 1.2.3.6"))
+	zf.AddEntry(entry)
+	for i := range zf.Entries() {
+		zf.Entries()[i].SetTTL(300)
+	}
+	entry, _ = zonefile.ParseEntry([]byte("irc A 1.2.3.7"))
+	zf.AddEntry(entry)
+	zf.Entries()[3].RemoveTTL()
+	entry, _ = zonefile.ParseEntry([]byte("ntp A 1.2.3.8"))
+	zf.AddEntry(entry)
+	expected := "www\t300\tA\t1.2.3.4\n" +
+		"mail\t300\tA\t1.2.3.5\n" +
+		"ftp\t300\tA\t1.2.3.6\n" +
+		"irc\t\tA\t1.2.3.7\n" +
+		"ntp\t300\tA\t1.2.3.8"
+	if string(zf.Save()) != expected {
+		t.Fatalf("Unexpected result: %q", zf.Save())
+	}
+}
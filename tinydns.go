@@ -0,0 +1,534 @@
+package zonefile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The TTLs tinydns-data gives records without one
+const (
+	tinydnsDefaultTTL = 86400
+	tinydnsNSTTL      = 259200 // of NS records and the A records of servers
+	tinydnsSOATTL     = 2560
+)
+
+// The refresh, retry, expire and minimum tinydns-data gives SOA records
+// without them
+var tinydnsSOATimes = []string{"16384", "2048", "1048576", "2560"}
+
+// Options for ImportTinydns
+type TinydnsOptions struct {
+	// The zones to put records in, besides those with an SOA record in
+	// the data, such as the reverse zones of = lines.
+	Zones []string
+
+	// The serial of SOA records without one.  tinydns-data uses the
+	// modification time of the data file.
+	Serial Serial
+}
+
+// A record read from a line of a tinydns data file
+type tinydnsRecord struct {
+	name   string // absolute
+	typ    string
+	ttl    int
+	values []string // as in a zonefile, with absolute names
+	line   int      // starts at 1
+}
+
+// Returns the records of the zonefiles as the lines of a tinydns data
+// file, zone by zone.  SOA, NS, A, MX, CNAME, PTR and TXT records are
+// written as Z, &, +, @, C, ^ and ' lines, and records of other types as
+// generic : lines with their data in wire format.  An A record and a PTR
+// record for its address that points back to it, with the same TTL, are
+// written as a single = line, also when they're in different zones.
+// Characters that can't be in a field are escaped in octal.
+//
+// tinydns only has class IN, so an error is returned for records of other
+// classes.  Relative names are taken to be relative to the $ORIGIN of
+// their zonefile, which must have one.
+func ExportTinydns(zones ...*Zonefile) ([]byte, error) {
+	var records []Record
+	for _, z := range zones {
+		rs, err := z.Records("")
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rs...)
+	}
+
+	// Find the A records that can be merged with a PTR record
+	ptrs := make(map[string][]int)
+	for i, r := range records {
+		if r.Type == "PTR" && r.Class == "IN" {
+			name, err := wire.CanonicalName(r.Name)
+			if err == nil {
+				ptrs[name] = append(ptrs[name], i)
+			}
+		}
+	}
+	merged := make(map[int]bool) // the PTR records that were merged
+	mergedWith := make(map[int]bool)
+	for i, r := range records {
+		if r.Type != "A" || r.Class != "IN" {
+			continue
+		}
+		name, err1 := wire.CanonicalName(r.Name)
+		rev, err2 := reverseName(r.rdata[0])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for _, j := range ptrs[rev] {
+			if !merged[j] && records[j].rdata[0] == name &&
+				records[j].TTL == r.TTL {
+				merged[j], mergedWith[i] = true, true
+				break
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	for i, r := range records {
+		if merged[i] {
+			continue
+		}
+		if r.Class != "IN" {
+			return nil, fmt.Errorf("%s %s: tinydns only has class IN",
+				r.Name, r.Type)
+		}
+		fields, err := tinydnsFields(r, mergedWith[i])
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", r.Name, r.Type, err)
+		}
+		b.WriteString(strings.Join(fields, ":"))
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// Returns the fields of the line for the record, the first of which
+// starts with the kind of the line.
+func tinydnsFields(r Record, merged bool) ([]string, error) {
+	name, err := tinydnsName(r.Name)
+	if err != nil {
+		return nil, err
+	}
+	ttl := strconv.Itoa(r.TTL)
+	var names []string // the names in the values
+	for i, kind := range rdataFields[r.Type] {
+		if kind == fieldName {
+			n, err := tinydnsName(r.rdata[i])
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, n)
+		}
+	}
+	// Servers and exchanges without a dot get a suffix in tinydns
+	hasDot := len(names) > 0 && strings.Contains(names[0], ".")
+
+	switch {
+	case merged:
+		return []string{"=" + name, r.rdata[0], ttl}, nil
+	case r.Type == "A":
+		return []string{"+" + name, r.rdata[0], ttl}, nil
+	case r.Type == "SOA":
+		fields := append([]string{"Z" + name}, names...)
+		fields = append(fields, r.rdata[2:7]...)
+		return append(fields, ttl), nil
+	case r.Type == "NS" && hasDot:
+		return []string{"&" + name, "", names[0], ttl}, nil
+	case r.Type == "MX" && hasDot:
+		return []string{"@" + name, "", names[0], r.rdata[0], ttl}, nil
+	case r.Type == "CNAME":
+		return []string{"C" + name, names[0], ttl}, nil
+	case r.Type == "PTR":
+		return []string{"^" + name, names[0], ttl}, nil
+	case r.Type == "TXT":
+		if text, ok := tinydnsText(r.Values); ok {
+			return []string{"'" + name, tinydnsEscape(text), ttl}, nil
+		}
+	}
+	w, err := r.wire()
+	if err != nil {
+		return nil, err
+	}
+	return []string{":" + name, strconv.Itoa(int(w.Type)),
+		tinydnsEscape(w.Data), ttl}, nil
+}
+
+// Returns the text of the character-strings of a TXT record, if they're
+// split as tinydns-data splits the text of a ' line: in strings of 127
+// octets, except for the last.
+func tinydnsText(values []string) ([]byte, bool) {
+	var text []byte
+	for i, v := range values {
+		s, err := decodeString([]byte(v))
+		if err != nil || len(s) == 0 || len(s) > 127 ||
+			(i < len(values)-1 && len(s) != 127) {
+			return nil, false
+		}
+		text = append(text, s...)
+	}
+	return text, len(text) > 0
+}
+
+// Returns the absolute domain name as tinydns has it: escaped, and
+// without the final dot.
+func tinydnsName(name string) (string, error) {
+	labels, err := wire.SplitName(name)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, label := range labels {
+		if bytes.IndexByte(label, '.') != -1 {
+			return "", fmt.Errorf("%s has a dot in a label", name)
+		}
+		parts = append(parts, tinydnsEscape(label))
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// Escapes the octets that can't be in a field of a tinydns data file
+func tinydnsEscape(s []byte) string {
+	var buf bytes.Buffer
+	for _, c := range s {
+		if c < ' ' || c > '~' || c == ':' || c == '\\' {
+			fmt.Fprintf(&buf, "\\%03o", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// Undoes the octal escapes of a field of a tinydns data file
+func tinydnsUnescape(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '\\' && i+1 < len(s) {
+			n, j := 0, i+1
+			for ; j < len(s) && j < i+4 && '0' <= s[j] && s[j] <= '7'; j++ {
+				n = n*8 + int(s[j]-'0')
+			}
+			if j > i+1 {
+				c, i = byte(n), j-1
+			} else {
+				c, i = s[i+1], i+1
+			}
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+// Checks that the field is an IPv4 address in dotted decimal
+func tinydnsAddress(ip string) error {
+	if net.ParseIP(ip).To4() == nil || strings.Contains(ip, ":") {
+		return fmt.Errorf("invalid IPv4 address %q", ip)
+	}
+	return nil
+}
+
+// Returns the name in the in-addr.arpa domain for the IPv4 address
+func reverseName(ip string) (string, error) {
+	if err := tinydnsAddress(ip); err != nil {
+		return "", err
+	}
+	addr := net.ParseIP(ip).To4()
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", addr[3], addr[2],
+		addr[1], addr[0]), nil
+}
+
+// Creates zonefiles from a tinydns data file, one for each zone with an
+// SOA record, from a Z or . line, and for each of the zones in the
+// options.  They're returned by their apex, in canonical form.  Records
+// go in the zone with the longest apex that they're in, so that the A
+// and PTR record of an = line can go in a forward zone and its reverse
+// zone.  An error is returned for records outside all zones.
+//
+// Each zonefile starts with $ORIGIN and its SOA record, followed by the
+// other records in the order of the data file, and is formatted as by
+// Format.  Records that are in the data more than once, such as the A
+// records of servers that are named on several lines, are only put in
+// once.  Comments, lines that start with a #, and lines that start with
+// a - are skipped.  Lines with a timestamp or location aren't supported,
+// nor are lines of other kinds than +, =, @, C, Z, ', ^, &, . and :.
+//
+// Addresses must be IPv4 addresses in dotted decimal, and numbers must
+// fit their field.  Control characters are only allowed, escaped, in the
+// text of ' lines and the data of : lines.  Errors are returned with the
+// number of their line, counting from 1.
+func ImportTinydns(data []byte, opts TinydnsOptions) (map[string]*Zonefile,
+	error) {
+	var records []tinydnsRecord
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || line[0] == '#' || line[0] == '-' {
+			continue
+		}
+		rs, err := tinydnsRecords(line, opts.Serial)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		for _, r := range rs {
+			r.line = i + 1
+			records = append(records, r)
+		}
+	}
+
+	// Find the zones
+	soas := make(map[string]*tinydnsRecord)
+	for _, name := range opts.Zones {
+		if !isAbsolute(name) {
+			name += "."
+		}
+		zone, err := wire.CanonicalName(name)
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %v", name, err)
+		}
+		soas[zone] = nil
+	}
+	for i, r := range records {
+		if r.typ != "SOA" {
+			continue
+		}
+		zone, _ := wire.CanonicalName(r.name)
+		if soa := soas[zone]; soa != nil &&
+			strings.Join(soa.values, " ") != strings.Join(r.values, " ") {
+			return nil, fmt.Errorf("line %d: %s already has an SOA record "+
+				"on line %d", r.line, r.name, soa.line)
+		}
+		if soas[zone] == nil {
+			soas[zone] = &records[i]
+		}
+	}
+
+	// Put the records in their zones, with the SOA record first
+	lines := make(map[string][]string)
+	lineNos := make(map[string][]int)
+	seen := make(map[string]bool)
+	add := func(zone string, r tinydnsRecord) {
+		ttl := r.ttl
+		line := recordLine(zone, r.name, &ttl, "IN", r.typ, r.values)
+		if !seen[zone+" "+line] {
+			seen[zone+" "+line] = true
+			lines[zone] = append(lines[zone], line)
+			lineNos[zone] = append(lineNos[zone], r.line)
+		}
+	}
+	for zone, soa := range soas {
+		if soa != nil {
+			add(zone, *soa)
+		}
+	}
+	for _, r := range records {
+		name, err := wire.CanonicalName(r.name)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", r.line, err)
+		}
+		zone := ""
+		for z := range soas {
+			if wire.IsSubdomain(name, z) && len(z) > len(zone) {
+				zone = z
+			}
+		}
+		if zone == "" {
+			return nil, fmt.Errorf("line %d: %s is in none of the zones",
+				r.line, r.name)
+		}
+		if r.typ != "SOA" {
+			add(zone, r)
+		}
+	}
+
+	zones := make(map[string]*Zonefile)
+	for zone := range soas {
+		z, perr := formattedZonefile(zone, lines[zone])
+		if perr != nil {
+			if i := perr.LineNo(); i >= 0 && i < len(lineNos[zone]) {
+				return nil, fmt.Errorf("line %d: %v", lineNos[zone][i], perr)
+			}
+			return nil, perr
+		}
+		if _, err := z.Records(""); err != nil {
+			if perr, ok := err.(ParsingError); ok && perr.LineNo() > 0 &&
+				perr.LineNo() <= len(lineNos[zone]) {
+				return nil, fmt.Errorf("line %d: %v",
+					lineNos[zone][perr.LineNo()-1], perr)
+			}
+			return nil, err
+		}
+		zones[zone] = z
+	}
+	return zones, nil
+}
+
+// Returns the records of a line of a tinydns data file
+func tinydnsRecords(line string, serial Serial) ([]tinydnsRecord, error) {
+	kind := line[0]
+	// The index of the TTL, which is followed by the timestamp and location
+	ttlIndex, ok := map[byte]int{'+': 2, '=': 2, 'C': 2, '^': 2, '\'': 2,
+		'@': 4, '&': 3, '.': 3, 'Z': 8, ':': 3}[kind]
+	if !ok {
+		return nil, fmt.Errorf("unsupported kind of line %q", kind)
+	}
+	f := strings.Split(line[1:], ":")
+	for len(f) < ttlIndex+3 {
+		f = append(f, "")
+	}
+	for i := range f {
+		f[i] = tinydnsUnescape(f[i])
+		// Only the text of ' lines and the data of : lines are binary
+		if kind == '\'' && i == 1 || kind == ':' && i == 2 {
+			continue
+		}
+		if strings.IndexFunc(f[i], unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("control character in field %q", f[i])
+		}
+	}
+	if f[ttlIndex+1] != "" || f[ttlIndex+2] != "" {
+		return nil, errors.New("timestamps and locations are not supported")
+	}
+	ttl := map[byte]int{'&': tinydnsNSTTL, '.': tinydnsNSTTL,
+		'Z': tinydnsSOATTL}[kind]
+	if ttl == 0 {
+		ttl = tinydnsDefaultTTL
+	}
+	if f[ttlIndex] != "" {
+		var err error
+		if ttl, err = strconv.Atoi(f[ttlIndex]); err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid TTL %q", f[ttlIndex])
+		}
+	}
+	name := zonefileName(f[0])
+	record := func(name, typ string, ttl int, values ...string) tinydnsRecord {
+		return tinydnsRecord{name: name, typ: typ, ttl: ttl, values: values}
+	}
+
+	switch kind {
+	case '+':
+		if err := tinydnsAddress(f[1]); err != nil {
+			return nil, err
+		}
+		return []tinydnsRecord{record(name, "A", ttl, f[1])}, nil
+	case '=':
+		rev, err := reverseName(f[1])
+		if err != nil {
+			return nil, err
+		}
+		return []tinydnsRecord{record(name, "A", ttl, f[1]),
+			record(rev, "PTR", ttl, name)}, nil
+	case 'C':
+		return []tinydnsRecord{record(name, "CNAME", ttl,
+			zonefileName(f[1]))}, nil
+	case '^':
+		return []tinydnsRecord{record(name, "PTR", ttl,
+			zonefileName(f[1]))}, nil
+	case '\'':
+		if f[1] == "" {
+			return nil, errors.New("empty text")
+		}
+		var values []string
+		for s := f[1]; s != ""; {
+			n := len(s)
+			if n > 127 {
+				n = 127
+			}
+			values = append(values, quoteString([]byte(s[:n])))
+			s = s[n:]
+		}
+		return []tinydnsRecord{record(name, "TXT", ttl, values...)}, nil
+	case '@':
+		mx := tinydnsServer(f[2], "mx", f[0])
+		dist := f[3]
+		if dist == "" {
+			dist = "0"
+		} else if _, err := strconv.ParseUint(dist, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid distance %q", dist)
+		}
+		if err := tinydnsAddress(f[1]); f[1] != "" && err != nil {
+			return nil, err
+		}
+		rs := []tinydnsRecord{record(name, "MX", ttl, dist, mx)}
+		if f[1] != "" {
+			rs = append(rs, record(mx, "A", ttl, f[1]))
+		}
+		return rs, nil
+	case '&', '.':
+		ns := tinydnsServer(f[2], "ns", f[0])
+		if err := tinydnsAddress(f[1]); f[1] != "" && err != nil {
+			return nil, err
+		}
+		var rs []tinydnsRecord
+		if kind == '.' {
+			rs = append(rs, record(name, "SOA", tinydnsSOATTL, append(
+				[]string{ns, zonefileName("hostmaster." + f[0]),
+					serial.String()}, tinydnsSOATimes...)...))
+		}
+		rs = append(rs, record(name, "NS", ttl, ns))
+		if f[1] != "" {
+			rs = append(rs, record(ns, "A", ttl, f[1]))
+		}
+		return rs, nil
+	case 'Z':
+		values := []string{zonefileName(f[1]), zonefileName(f[2]), f[3]}
+		if values[2] == "" {
+			values[2] = serial.String()
+		}
+		for i, v := range f[4:8] {
+			if v == "" {
+				v = tinydnsSOATimes[i]
+			}
+			values = append(values, v)
+		}
+		for _, v := range values[2:] {
+			if _, err := strconv.ParseUint(v, 10, 32); err != nil {
+				return nil, fmt.Errorf("invalid number %q", v)
+			}
+		}
+		return []tinydnsRecord{record(name, "SOA", ttl, values...)}, nil
+	}
+
+	// A generic line
+	code, err := strconv.ParseUint(f[1], 10, 16)
+	if err != nil || code == 0 {
+		return nil, fmt.Errorf("invalid type %q", f[1])
+	}
+	typ := typeName(uint16(code))
+	values, err := rdataFromWire(typ, wire.RR{Name: name, Type: uint16(code),
+		Data: []byte(f[2])})
+	if err != nil {
+		return nil, err
+	}
+	return []tinydnsRecord{record(name, typ, ttl, values...)}, nil
+}
+
+// Returns the name of the server of an @, & or . line, which is put
+// under the given label of the domain if it has no dot.
+func tinydnsServer(x, label, domain string) string {
+	if !strings.Contains(x, ".") {
+		x += "." + label + "." + domain
+	}
+	return zonefileName(x)
+}
+
+// Returns the domain name of a tinydns data file, which is unescaped, as
+// an absolute name in presentation format.
+func zonefileName(name string) string {
+	var labels [][]byte
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label != "" {
+			labels = append(labels, []byte(label))
+		}
+	}
+	return wire.JoinName(labels)
+}
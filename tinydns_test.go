@@ -0,0 +1,164 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"strings"
+	"testing"
+)
+
+func ExampleExportTinydns() {
+	forward, err := zonefile.Load([]byte(`$ORIGIN example.com.
+@    3600 IN SOA ns1 hostmaster 1 3600 600 604800 60
+@    3600 IN NS  ns1
+@    3600 IN MX  10 mail
+@    3600 IN TXT "v=spf1 mx:example.com -all"
+ns1  3600 IN A   192.0.2.1
+mail 3600 IN A   192.0.2.2
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	reverse, err := zonefile.Load([]byte(`$ORIGIN 2.0.192.in-addr.arpa.
+@ 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 604800 60
+@ 3600 IN NS  ns1.example.com.
+2 3600 IN PTR mail.example.com.
+`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	data, err2 := zonefile.ExportTinydns(forward, reverse)
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	fmt.Print(string(data))
+	// Output:
+	// Zexample.com:ns1.example.com:hostmaster.example.com:1:3600:600:604800:60:3600
+	// &example.com::ns1.example.com:3600
+	// @example.com::mail.example.com:10:3600
+	// 'example.com:v=spf1 mx\072example.com -all:3600
+	// +ns1.example.com:192.0.2.1:3600
+	// =mail.example.com:192.0.2.2:3600
+	// Z2.0.192.in-addr.arpa:ns1.example.com:hostmaster.example.com:1:3600:600:604800:60:3600
+	// &2.0.192.in-addr.arpa::ns1.example.com:3600
+}
+
+func TestImportTinydns(t *testing.T) {
+	zones, err := zonefile.ImportTinydns([]byte(`# example.com
+.example.com:192.0.2.1:a
+-www.example.com:192.0.2.9
+=www.example.com:192.0.2.80:300
+@example.com:192.0.2.25:mx1::
+'example.com:v=spf1 mx\072example.com -all
+Cftp.example.com:www.example.com
+:example.com:28:\040\001\015\270\000\000\000\000\000\000\000\000\000\000\000\001
++sp\040ace.example.com:192.0.2.7
+'lines.example.com:one\012"two"
+`), zonefile.TinydnsOptions{Zones: []string{"2.0.192.in-addr.arpa"},
+		Serial: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones) != 2 {
+		t.Fatalf("got %d zones", len(zones))
+	}
+	expected := `$ORIGIN example.com.
+@         2560   IN SOA   a.ns hostmaster 42 16384 2048 1048576 2560
+@         259200 IN NS    a.ns
+a.ns      259200 IN A     192.0.2.1
+www       300    IN A     192.0.2.80
+@         86400  IN MX    0 mx1.mx
+mx1.mx    86400  IN A     192.0.2.25
+@         86400  IN TXT   "v=spf1 mx:example.com -all"
+ftp       86400  IN CNAME www
+@         86400  IN AAAA  2001:db8::1
+sp\032ace 86400  IN A     192.0.2.7
+lines     86400  IN TXT   "one\010\"two\""
+`
+	if got := string(zones["example.com."].Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+	expected = `$ORIGIN 2.0.192.in-addr.arpa.
+80 300 IN PTR www.example.com.
+`
+	if got := string(zones["2.0.192.in-addr.arpa."].Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
+
+func TestTinydnsRoundTrip(t *testing.T) {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+@        IN SOA   ns1 hostmaster 1 3600 600 604800 60
+         IN NS    ns1
+         IN NS    ns2.example.org.
+ns1      IN A     192.0.2.1
+         IN AAAA  2001:db8::1
+www  300 IN TXT   "` + strings.Repeat("a", 127) + `" "b:\\"
+*.dyn    IN TXT   "two" "strings"
+_sip._tcp IN SRV  10 60 5060 ns1
+1        IN PTR   ns1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err2 := zonefile.ExportTinydns(zf)
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	for _, s := range []string{
+		"'www.example.com:" + strings.Repeat("a", 127) + "b\\072\\134:300\n",
+		":*.dyn.example.com:16:\\003two\\007strings:3600\n",
+		"^1.example.com:ns1.example.com:3600\n",
+	} {
+		if !strings.Contains(string(data), s) {
+			t.Fatalf("%q is missing from\n%s", s, data)
+		}
+	}
+
+	zones, err2 := zonefile.ImportTinydns(data, zonefile.TinydnsOptions{})
+	if err2 != nil {
+		t.Fatalf("importing\n%s: %v", data, err2)
+	}
+	changes, err2 := zonefile.DiffOrigin(zf, zones["example.com."],
+		"example.com.")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("records differ after importing\n%s:\n%s", data,
+			zones["example.com."].Save())
+	}
+}
+
+func TestImportTinydnsErrors(t *testing.T) {
+	for _, test := range []struct {
+		data, err string
+	}{
+		{"Zexample.com:ns1.example.com:hostmaster.example.com\n" +
+			"+www.example.com:1.2.3\n", "line 2: "},
+		{"+www.example.com:192.0.2.1\n", "line 1: www.example.com. is in " +
+			"none of the zones"},
+		{"Zexample.com:a:b\n\n+www.example.com:192.0.2.1::20\n",
+			"line 3: timestamps and locations are not supported"},
+		{"%in:192.168\n", "line 1: unsupported kind of line '%'"},
+		{"=www.example.com:192.0.2\n", "line 1: invalid IPv4 address"},
+		{`+www.example.com:1.2.3.4\012\042`, "line 1: control character"},
+		{`+www.example.com:1.2.3.4\012evil 60 IN A 6.6.6.6`,
+			"line 1: control character"},
+		{"+www.example.com:1.2.3.4 evil\n", "line 1: invalid IPv4 address"},
+		{"&example.com:192.0.2.300:a\n", "line 1: invalid IPv4 address"},
+		{"@example.com::mx1:10 x\n", `line 1: invalid distance "10 x"`},
+		{`Zexample.com:a:b:1\0409`, `line 1: invalid number "1 9"`},
+		{`Cw\011ww.example.com:www.example.com`, "line 1: control character"},
+	} {
+		_, err := zonefile.ImportTinydns([]byte(test.data),
+			zonefile.TinydnsOptions{})
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Fatalf("expected error %q, not %v", test.err, err)
+		}
+	}
+}
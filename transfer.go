@@ -0,0 +1,241 @@
+package zonefile
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"strings"
+)
+
+// Transfers the zone from the server with AXFR (RFC 5936) and returns it
+// as a zonefile.  The zonefile starts with $ORIGIN and is formatted as by
+// Format, with names relative to the origin.  The server is a host or IP
+// address, optionally with a port.
+func Transfer(ctx context.Context, server, zone string) (*Zonefile, error) {
+	if !isAbsolute(zone) {
+		zone += "."
+	}
+	msg, err := (&wire.Message{
+		ID: wire.NewID(),
+		Question: []wire.Question{{Name: zone, Type: wire.TypeAXFR,
+			Class: wire.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+	records, err := transfer(ctx, server, msg)
+	if err != nil {
+		return nil, err
+	}
+	return zonefileFrom(zone, records)
+}
+
+// Brings the zonefile up to date with the zone on the server, with IXFR
+// (RFC 1995) from its serial.  The changes are applied in place, as by
+// Apply, so that records which didn't change keep their comments and
+// formatting.  If the server sends the whole zone, the differences with it
+// are applied.  Returns whether the zonefile changed.
+//
+// The origin is as for Records.  Records in included files can't be
+// changed: if the transfer changes one, an error is returned and the
+// zonefile is left alone.
+func (z *Zonefile) IncrementalTransfer(ctx context.Context, server,
+	origin string) (bool, error) {
+	u := updater{z: z, origin: origin}
+	if err := u.load(); err != nil {
+		return false, err
+	}
+	soa := u.find(u.apex, wire.TypeSOA)[0]
+	soaRR, err := soa.wire()
+	if err != nil {
+		return false, err
+	}
+	msg, err := (&wire.Message{
+		ID: wire.NewID(),
+		Question: []wire.Question{{Name: u.apex, Type: wire.TypeIXFR,
+			Class: u.class}},
+		Authority: []wire.RR{soaRR},
+	}).Pack()
+	if err != nil {
+		return false, err
+	}
+	records, err := transfer(ctx, server, msg)
+	if err != nil {
+		return false, err
+	}
+	newSerial := Serial(wire.SOASerial(records[0]))
+	if len(records) == 1 || !newSerial.Greater(Serial(wire.SOASerial(soaRR))) {
+		return false, nil
+	}
+
+	c, err := z.Copy()
+	if err != nil {
+		return false, err
+	}
+	if wire.Incremental(records) {
+		err = c.applyIncremental(records[1:len(records)-1], origin)
+	} else {
+		err = c.applyFull(u.apex, records, origin)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The SOA record, with the new serial, goes last
+	values, err := rdataFromWire("SOA", records[0])
+	if err != nil {
+		return false, err
+	}
+	u = updater{z: c, origin: origin}
+	if err := u.load(); err != nil {
+		return false, err
+	}
+	if err := u.replaceSOA(values, int(records[0].TTL)); err != nil {
+		return false, err
+	}
+	z.replaceWith(c)
+	return true, nil
+}
+
+// Runs the transfer and turns errors in the response into errors that
+// mention the response code.
+func transfer(ctx context.Context, server string, msg []byte) (
+	[]wire.RR, error) {
+	records, err := wire.Transfer(ctx, server, msg)
+	if rcode, ok := err.(wire.RcodeError); ok {
+		return nil, fmt.Errorf("zone transfer failed: %v", Rcode(rcode))
+	}
+	return records, err
+}
+
+// Applies the changes of an IXFR response: sequences of the old SOA
+// record, the removed records, the new SOA record and the added records.
+func (z *Zonefile) applyIncremental(records []wire.RR, origin string) error {
+	var ops []Operation
+	adding := true // until the first SOA record
+	for _, rr := range records {
+		if rr.Type == wire.TypeSOA {
+			// Apply each version in turn, so that a record can be removed
+			// and added again in later versions.
+			if adding && len(ops) > 0 {
+				if err := z.applyTransferred(ops, origin); err != nil {
+					return err
+				}
+				ops = nil
+			}
+			adding = !adding
+			continue
+		}
+		op, err := operationFromWire(rr, adding)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, op)
+	}
+	return z.applyTransferred(ops, origin)
+}
+
+// Applies the differences between the zonefile and the full zone of an
+// AXFR-style response.
+func (z *Zonefile) applyFull(apex string, records []wire.RR,
+	origin string) error {
+	full, err := zonefileFrom(apex, records)
+	if err != nil {
+		return err
+	}
+	changes, err := DiffOrigin(z, full, origin)
+	if err != nil {
+		return err
+	}
+	var ops []Operation
+	for _, c := range changes {
+		if c.record().Type == "SOA" {
+			continue
+		}
+		if c.Old != nil {
+			ops = append(ops, Operation{Kind: DeleteRR, Name: c.Old.Name,
+				Class: c.Old.Class, Type: c.Old.Type, Values: c.Old.Values})
+		}
+		if c.New != nil {
+			ttl := c.New.TTL
+			ops = append(ops, Operation{Kind: AddRR, Name: c.New.Name,
+				TTL: &ttl, Class: c.New.Class, Type: c.New.Type,
+				Values: c.New.Values})
+		}
+	}
+	return z.applyTransferred(ops, origin)
+}
+
+// Applies the operations, which must all succeed
+func (z *Zonefile) applyTransferred(ops []Operation, origin string) error {
+	conflicts, err := z.Apply(ops, ApplyOptions{Origin: origin})
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("transfer doesn't match the zonefile: %v",
+			conflicts[0])
+	}
+	return nil
+}
+
+// Returns the operation that adds or removes the record
+func operationFromWire(rr wire.RR, add bool) (Operation, error) {
+	typ := typeName(rr.Type)
+	values, err := rdataFromWire(typ, rr)
+	if err != nil {
+		return Operation{}, err
+	}
+	op := Operation{Kind: DeleteRR, Name: rr.Name, Class: className(rr.Class),
+		Type: typ, Values: values}
+	if add {
+		ttl := int(rr.TTL)
+		op.Kind, op.TTL = AddRR, &ttl
+	}
+	return op, nil
+}
+
+// Creates a zonefile with the records of an AXFR-style response, which
+// starts and ends with the SOA record.
+func zonefileFrom(zone string, records []wire.RR) (*Zonefile, error) {
+	if len(records) < 2 {
+		return nil, errors.New("transfer has no records")
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "$ORIGIN %s\n", zone)
+	for _, rr := range records[:len(records)-1] {
+		typ := typeName(rr.Type)
+		values, err := rdataFromWire(typ, rr)
+		if err != nil {
+			return nil, err
+		}
+		kinds := rdataFields[typ]
+		for i, v := range values {
+			if i < len(kinds) && kinds[i] == fieldName {
+				values[i] = relativeName(v, zone)
+			}
+		}
+		fmt.Fprintf(&b, "%s %d %s %s %s\n", relativeName(rr.Name, zone),
+			rr.TTL, className(rr.Class), typ, strings.Join(values, " "))
+	}
+	z, perr := Load(b.Bytes())
+	if perr != nil {
+		return nil, perr
+	}
+	z, perr = Load(Format(z, FormatOptions{Owners: OwnerRelative,
+		UseAt: true}))
+	if perr != nil {
+		return nil, perr
+	}
+	return z, nil
+}
+
+// Replaces the contents of the zonefile by those of another
+func (z *Zonefile) replaceWith(c *Zonefile) {
+	z.entries, z.suffix, z.counts = c.entries, c.suffix, nil
+	for i := range z.entries {
+		z.entries[i].zf = z
+	}
+}
@@ -0,0 +1,310 @@
+package zonefile_test
+
+import (
+	"context"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"github.com/bwesterb/go-zonefile/server"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+const primaryZone = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1
+www  IN A   192.0.2.2
+`
+
+// Starts a primary for primaryZone that allows transfers to localhost
+func startPrimary(t testing.TB) *server.Server {
+	zf, err := zonefile.Load([]byte(primaryZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err2 := server.New(zf, "")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	if err := s.AllowTransfer("127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Applies the operations to the zone on the primary and bumps its serial
+func edit(t testing.TB, s *server.Server, ops ...zonefile.Operation) {
+	err := s.Edit(func(zf *zonefile.Zonefile) error {
+		conflicts, err := zf.Apply(ops, zonefile.ApplyOptions{
+			BumpSerial: zonefile.IncrementSerial})
+		if len(conflicts) > 0 {
+			return conflicts[0]
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	s := startPrimary(t)
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	zf, err := zonefile.Transfer(ctx, s.Addr().String(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `$ORIGIN example.com.
+@   3600 IN SOA ns1 hostmaster 1 3600 600 604800 60
+@   3600 IN NS  ns1
+ns1 3600 IN A   192.0.2.1
+www 3600 IN A   192.0.2.2
+`
+	if got := string(zf.Save()); got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
+
+func TestIncrementalTransfer(t *testing.T) {
+	s := startPrimary(t)
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Our copy has comments
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+; Our nameserver
+@    IN SOA ns1 hostmaster (
+            1      ; serial
+            3600   ; refresh
+            600    ; retry
+            604800 ; expire
+            60 )   ; minimum
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  IN A   192.0.2.2 ; web server
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		ops      []zonefile.Operation
+		expected string
+	}{
+		{nil, ""},
+		{[]zonefile.Operation{
+			{Kind: zonefile.DeleteRR, Name: "www", Type: "A",
+				Values: []string{"192.0.2.2"}},
+			{Kind: zonefile.AddRR, Name: "www", Type: "A",
+				Values: []string{"192.0.2.3"}},
+		}, `$ORIGIN example.com.
+$TTL 3600
+; Our nameserver
+@    IN SOA ns1 hostmaster (
+            2      ; serial
+            3600   ; refresh
+            600    ; retry
+            604800 ; expire
+            60 )   ; minimum
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  IN A   192.0.2.3
+`},
+		{[]zonefile.Operation{
+			{Kind: zonefile.AddRR, Name: "mail", Type: "A",
+				Values: []string{"192.0.2.4"}},
+		}, `$ORIGIN example.com.
+$TTL 3600
+; Our nameserver
+@    IN SOA ns1 hostmaster (
+            3      ; serial
+            3600   ; refresh
+            600    ; retry
+            604800 ; expire
+            60 )   ; minimum
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  IN A   192.0.2.3
+mail IN A   192.0.2.4
+`},
+	} {
+		if test.ops != nil {
+			edit(t, s, test.ops...)
+		}
+		changed, err := zf.IncrementalTransfer(ctx, s.Addr().String(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != (test.expected != "") {
+			t.Fatalf("changed is %v", changed)
+		}
+		if got := string(zf.Save()); test.expected != "" && got != test.expected {
+			t.Fatalf("got\n%s\ninstead of\n%s", got, test.expected)
+		}
+	}
+}
+
+func TestIncrementalTransferFull(t *testing.T) {
+	s := startPrimary(t)
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Serial 0 isn't in the journal of the primary, so it sends the whole
+	// zone.
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 0 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  IN A   192.0.2.9
+old  IN A   192.0.2.8
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err2 := zf.IncrementalTransfer(ctx, s.Addr().String(), "")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	expected := `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1 ; in the basement
+www  IN A   192.0.2.2
+`
+	if got := string(zf.Save()); !changed || got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
+
+// Starts a server that answers a transfer query with the records in the
+// zonefile, in order and one per message, as RFC 5936 allows.  It keeps
+// the connection open afterwards, as servers may.
+func startStreamer(t testing.TB, data string) net.Listener {
+	zf, err := zonefile.Load([]byte("$ORIGIN example.com.\n$TTL 3600\n" +
+		data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err2 := zf.Records("")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	var rrs []wire.RR
+	for _, r := range records {
+		typ, class, data, err := r.Wire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, wire.RR{Name: r.Name, Type: typ, Class: class,
+			TTL: uint32(r.TTL), Data: data})
+	}
+
+	l, err2 := net.Listen("tcp", "127.0.0.1:0")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, err := wire.ReadTCP(conn)
+		if err != nil {
+			return
+		}
+		q, err := wire.Unpack(b)
+		if err != nil {
+			return
+		}
+		for _, rr := range rrs {
+			msg, err := (&wire.Message{ID: q.ID, Response: true,
+				Question: q.Question, Answer: []wire.RR{rr}}).Pack()
+			if err != nil || wire.WriteTCP(conn, msg) != nil {
+				return
+			}
+		}
+		io.Copy(io.Discard, conn)
+	}()
+	return l
+}
+
+func TestTransferRecordPerMessage(t *testing.T) {
+	for _, test := range []struct {
+		data, expected string
+	}{
+		{`@   IN SOA ns1 hostmaster 1 3600 600 604800 60
+@   IN NS  ns1
+ns1 IN A   192.0.2.1
+@   IN SOA ns1 hostmaster 1 3600 600 604800 60
+`, `$ORIGIN example.com.
+@   3600 IN SOA ns1 hostmaster 1 3600 600 604800 60
+@   3600 IN NS  ns1
+ns1 3600 IN A   192.0.2.1
+`},
+		// A zone with only its SOA record isn't mistaken for changes
+		{`@ IN SOA ns1 hostmaster 1 3600 600 604800 60
+@ IN SOA ns1 hostmaster 1 3600 600 604800 60
+`, `$ORIGIN example.com.
+@ 3600 IN SOA ns1 hostmaster 1 3600 600 604800 60
+`},
+	} {
+		l := startStreamer(t, test.data)
+		ctx, cancel := context.WithTimeout(context.Background(),
+			5*time.Second)
+		zf, err := zonefile.Transfer(ctx, l.Addr().String(), "example.com")
+		cancel()
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(zf.Save()); got != test.expected {
+			t.Fatalf("got\n%s\ninstead of\n%s", got, test.expected)
+		}
+	}
+}
+
+func TestIncrementalTransferRecordPerMessage(t *testing.T) {
+	l := startStreamer(t, `@   IN SOA ns1 hostmaster 2 3600 600 604800 60
+@   IN SOA ns1 hostmaster 1 3600 600 604800 60
+www IN A   192.0.2.2
+@   IN SOA ns1 hostmaster 2 3600 600 604800 60
+www IN A   192.0.2.3
+@   IN SOA ns1 hostmaster 2 3600 600 604800 60
+`)
+	defer l.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	zf, err := zonefile.Load([]byte(primaryZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err2 := zf.IncrementalTransfer(ctx, l.Addr().String(), "")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	expected := `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 2 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   192.0.2.1
+www  IN A   192.0.2.3
+`
+	if got := string(zf.Save()); !changed || got != expected {
+		t.Fatalf("got\n%s\ninstead of\n%s", got, expected)
+	}
+}
@@ -0,0 +1,68 @@
+package zonefile
+
+import (
+	"errors"
+	"math"
+)
+
+// Parses a TTL.  Next to a plain number of seconds, we accept the
+// units BIND allows, such as "1h30m" or "2W".  TTLs go up to 2^31-1, as
+// in RFC 2181.
+func parseTTL(s string) (int, error) {
+	v, err := parsePeriod(s)
+	if err != nil {
+		return 0, err
+	}
+	if v > maxTTL {
+		return 0, errors.New("TTL out of range")
+	}
+	return int(v), nil
+}
+
+// Parses a period, such as a TTL or the refresh time of an SOA record,
+// which is an unsigned 32-bit number of seconds.
+func parsePeriod(s string) (uint32, error) {
+	if len(s) == 0 {
+		return 0, errors.New("empty TTL")
+	}
+	var total, n uint64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if '0' <= c && c <= '9' {
+			n = n*10 + uint64(c-'0')
+			digits = true
+			if n > math.MaxUint32 {
+				return 0, errors.New("TTL out of range")
+			}
+			continue
+		}
+		if !digits {
+			return 0, errors.New("invalid TTL")
+		}
+		switch c {
+		case 's', 'S':
+		case 'm', 'M':
+			n *= 60
+		case 'h', 'H':
+			n *= 60 * 60
+		case 'd', 'D':
+			n *= 24 * 60 * 60
+		case 'w', 'W':
+			n *= 7 * 24 * 60 * 60
+		default:
+			return 0, errors.New("invalid TTL")
+		}
+		total += n
+		n = 0
+		digits = false
+		if total > math.MaxUint32 {
+			return 0, errors.New("TTL out of range")
+		}
+	}
+	total += n
+	if total > math.MaxUint32 {
+		return 0, errors.New("TTL out of range")
+	}
+	return uint32(total), nil
+}
@@ -0,0 +1,62 @@
+package zonefile_test
+
+import (
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func TestTTLUnits(t *testing.T) {
+	for _, test := range []struct {
+		ttl      string
+		expected int // -1 if the entry doesn't parse
+	}{
+		{"60", 60},
+		{"1h", 3600},
+		{"1H30m", 5400},
+		{"1w2d", 777600},
+		{"90s", 90},
+		{"1h5", 3605}, // BIND takes a trailing number as seconds
+		{"2147483647", 2147483647},
+		{"2147483648", -1}, // over the maximum of RFC 2181
+		{"3551w", -1},
+		{"4294967296", -1},
+		{"7102W", -1}, // just over 2^32 seconds
+		{"h", -1},
+		{"1x", -1},
+	} {
+		e, err := zonefile.ParseEntry([]byte("www " + test.ttl +
+			" IN A 1.2.3.4"))
+		if test.expected == -1 {
+			if err == nil {
+				t.Fatalf("%s: expected an error", test.ttl)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.ttl, err)
+		}
+		if e.TTL() == nil || *e.TTL() != test.expected {
+			t.Fatalf("%s: TTL %v instead of %d", test.ttl, e.TTL(),
+				test.expected)
+		}
+	}
+}
+
+func TestPeriodRange(t *testing.T) {
+	// The timers of an SOA record are unsigned 32-bit numbers, which
+	// may go beyond the largest TTL
+	zf, err := zonefile.Load([]byte("@ 60 IN SOA ns1 hostmaster 1 " +
+		"4294967295 1h 1w 60\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err2 := zf.Records("example.com.")
+	if err2 != nil {
+		t.Fatal(err2)
+	}
+	expected := "example.com. 60 IN SOA ns1.example.com. " +
+		"hostmaster.example.com. 1 4294967295 3600 604800 60"
+	if got := records[0].Canonical(); got != expected {
+		t.Fatalf("got %q instead of %q", got, expected)
+	}
+}
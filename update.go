@@ -0,0 +1,453 @@
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"sort"
+	"strings"
+)
+
+// A response code of a DNS message
+type Rcode int
+
+const (
+	RcodeNoError  Rcode = wire.RcodeSuccess
+	RcodeFormErr  Rcode = wire.RcodeFormErr
+	RcodeServFail Rcode = wire.RcodeServFail
+	RcodeNXDomain Rcode = wire.RcodeNXDomain
+	RcodeNotImp   Rcode = wire.RcodeNotImp
+	RcodeRefused  Rcode = wire.RcodeRefused
+	RcodeYXDomain Rcode = wire.RcodeYXDomain // name exists when it shouldn't
+	RcodeYXRRSet  Rcode = wire.RcodeYXRRSet  // RRset exists when it shouldn't
+	RcodeNXRRSet  Rcode = wire.RcodeNXRRSet  // RRset doesn't exist when it should
+	RcodeNotAuth  Rcode = wire.RcodeNotAuth  // not authoritative for the zone
+	RcodeNotZone  Rcode = wire.RcodeNotZone  // name is not in the zone
+)
+
+var rcodeNames = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN",
+	"NOTIMP", "REFUSED", "YXDOMAIN", "YXRRSET", "NXRRSET", "NOTAUTH",
+	"NOTZONE"}
+
+func (r Rcode) String() string {
+	if r >= 0 && int(r) < len(rcodeNames) {
+		return rcodeNames[r]
+	}
+	return fmt.Sprintf("RCODE%d", int(r))
+}
+
+// Applies a DNS UPDATE message (RFC 2136) in wire format to the zone and
+// returns the response code a server would return.  The prerequisites are
+// checked first; if they hold, the updates are applied to the entries in
+// place, as by Apply, and the serial is bumped with the strategy in the
+// options, or incremented if there is none, unless the update set a
+// greater serial itself.  Either all updates are applied or none.
+//
+// An error is only returned together with RcodeServFail, when the zone
+// itself can't be resolved or changed.
+func (z *Zonefile) ApplyUpdate(msg []byte, opts ApplyOptions) (
+	Rcode, error) {
+	m, err := wire.Unpack(msg)
+	if err != nil || m.Response {
+		return RcodeFormErr, nil
+	}
+	if m.Opcode != wire.OpcodeUpdate {
+		return RcodeNotImp, nil
+	}
+	if len(m.Question) != 1 || m.Question[0].Type != wire.TypeSOA {
+		return RcodeFormErr, nil
+	}
+
+	// Work on a copy, so that we can leave the zone alone if an update
+	// fails halfway.
+	c, err := z.Copy()
+	if err != nil {
+		return RcodeServFail, err
+	}
+	u := updater{z: c, origin: opts.Origin}
+	if err := u.load(); err != nil {
+		return RcodeServFail, err
+	}
+	zone, err := wire.CanonicalName(m.Question[0].Name)
+	if err != nil || zone != u.apex || m.Question[0].Class != u.class {
+		return RcodeNotAuth, nil
+	}
+
+	if rcode := u.checkPrerequisites(m.Answer); rcode != RcodeNoError {
+		return rcode, nil
+	}
+	if rcode := u.prescan(m.Authority); rcode != RcodeNoError {
+		return rcode, nil
+	}
+	for _, rr := range m.Authority {
+		if err := u.update(rr); err != nil {
+			return RcodeServFail, err
+		}
+	}
+
+	if u.changed && !u.serialSet {
+		strategy := opts.BumpSerial
+		if strategy == nil {
+			strategy = IncrementSerial
+		}
+		if _, _, err := c.BumpSerial(strategy); err != nil {
+			return RcodeServFail, err
+		}
+	}
+	if u.changed {
+		z.replaceWith(c)
+	}
+	return RcodeNoError, nil
+}
+
+// Creates the response to a DNS UPDATE message with the given response
+// code, as returned by ApplyUpdate.
+func UpdateResponse(msg []byte, rcode Rcode) ([]byte, error) {
+	resp := wire.Message{Response: true, Opcode: wire.OpcodeUpdate,
+		Rcode: int(rcode)}
+	if m, err := wire.Unpack(msg); err == nil {
+		resp.ID = m.ID
+		resp.Opcode = m.Opcode
+		resp.Question = m.Question
+	} else if len(msg) >= 2 {
+		resp.ID = uint16(msg[0])<<8 | uint16(msg[1])
+	}
+	return resp.Pack()
+}
+
+// Keeps track of the state while applying an update
+type updater struct {
+	z       *Zonefile
+	origin  string
+	apex    string
+	class   uint16
+	records []Record
+
+	changed   bool // whether any update was applied
+	serialSet bool // whether the update set a greater serial
+}
+
+// Resolves the records of the zone
+func (u *updater) load() error {
+	records, err := u.z.Records(u.origin)
+	if err != nil {
+		return err
+	}
+	u.records = records
+	for _, r := range records {
+		if r.Type == "SOA" {
+			u.apex, _ = wire.CanonicalName(r.Name)
+			u.class, _ = classCode(r.Class)
+			return nil
+		}
+	}
+	return errors.New("zone has no SOA record")
+}
+
+// Returns the records with the given owner and, unless it's ANY, type
+func (u *updater) find(name string, typ uint16) (r []Record) {
+	for _, rec := range u.records {
+		if n, _ := wire.CanonicalName(rec.Name); n != name {
+			continue
+		}
+		if code, _ := typeCode(rec.Type); typ == wire.TypeANY || typ == code {
+			r = append(r, rec)
+		}
+	}
+	return
+}
+
+// Returns the data of the record in canonical form
+func canonicalWireRdata(rr wire.RR) (string, error) {
+	typ := typeName(rr.Type)
+	values, err := rdataFromWire(typ, rr)
+	if err != nil {
+		return "", err
+	}
+	fields, _, err := canonicalRdata(typ, stringsToBytes(values), "")
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// Checks the prerequisites as in section 3.2 of RFC 2136
+func (u *updater) checkPrerequisites(prereqs []wire.RR) Rcode {
+	type rrset struct {
+		name string
+		typ  uint16
+	}
+	values := make(map[rrset][]string)
+	var order []rrset
+	for _, rr := range prereqs {
+		name, err := wire.CanonicalName(rr.Name)
+		if err != nil || rr.TTL != 0 {
+			return RcodeFormErr
+		}
+		if !wire.IsSubdomain(name, u.apex) {
+			return RcodeNotZone
+		}
+		switch rr.Class {
+		case wire.ClassANY, wire.ClassNONE:
+			if len(rr.Data) != 0 {
+				return RcodeFormErr
+			}
+			exists := len(u.find(name, rr.Type)) > 0
+			switch {
+			case rr.Class == wire.ClassANY && !exists &&
+				rr.Type == wire.TypeANY:
+				return RcodeNXDomain
+			case rr.Class == wire.ClassANY && !exists:
+				return RcodeNXRRSet
+			case rr.Class == wire.ClassNONE && exists &&
+				rr.Type == wire.TypeANY:
+				return RcodeYXDomain
+			case rr.Class == wire.ClassNONE && exists:
+				return RcodeYXRRSet
+			}
+		case u.class:
+			rdata, err := canonicalWireRdata(rr)
+			if err != nil || rr.Type == wire.TypeANY {
+				return RcodeFormErr
+			}
+			k := rrset{name, rr.Type}
+			if values[k] == nil {
+				order = append(order, k)
+			}
+			values[k] = append(values[k], rdata)
+		default:
+			return RcodeFormErr
+		}
+	}
+
+	// The RRsets must be exactly as in the prerequisites
+	for _, k := range order {
+		var have []string
+		for _, r := range u.find(k.name, k.typ) {
+			have = append(have, strings.Join(r.rdata, " "))
+		}
+		if !sameSet(have, values[k]) {
+			return RcodeNXRRSet
+		}
+	}
+	return RcodeNoError
+}
+
+// Checks whether the lists have the same elements, ignoring duplicates
+func sameSet(a, b []string) bool {
+	unique := func(l []string) []string {
+		l = append([]string{}, l...)
+		sort.Strings(l)
+		var r []string
+		for i, s := range l {
+			if i == 0 || s != l[i-1] {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+	a, b = unique(a), unique(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks whether the type is a meta type, which can't be in a zone
+func isMetaType(typ uint16) bool {
+	switch typ {
+	case wire.TypeANY, wire.TypeAXFR, wire.TypeIXFR, wire.TypeMAILA,
+		wire.TypeMAILB, wire.TypeOPT:
+		return true
+	}
+	return false
+}
+
+// Checks the updates as in section 3.4.1 of RFC 2136
+func (u *updater) prescan(updates []wire.RR) Rcode {
+	for _, rr := range updates {
+		name, err := wire.CanonicalName(rr.Name)
+		if err != nil {
+			return RcodeFormErr
+		}
+		if !wire.IsSubdomain(name, u.apex) {
+			return RcodeNotZone
+		}
+		switch rr.Class {
+		case u.class:
+			if isMetaType(rr.Type) {
+				return RcodeFormErr
+			}
+			if _, err := canonicalWireRdata(rr); err != nil {
+				return RcodeFormErr
+			}
+		case wire.ClassANY:
+			if rr.TTL != 0 || len(rr.Data) != 0 ||
+				rr.Type != wire.TypeANY && isMetaType(rr.Type) {
+				return RcodeFormErr
+			}
+		case wire.ClassNONE:
+			if rr.TTL != 0 || isMetaType(rr.Type) {
+				return RcodeFormErr
+			}
+		default:
+			return RcodeFormErr
+		}
+	}
+	return RcodeNoError
+}
+
+// Applies an update as in section 3.4.2 of RFC 2136
+func (u *updater) update(rr wire.RR) error {
+	name, _ := wire.CanonicalName(rr.Name)
+	typ := typeName(rr.Type)
+	class := className(u.class)
+	var ops []Operation
+
+	switch rr.Class {
+	case u.class:
+		values, err := rdataFromWire(typ, rr)
+		if err != nil {
+			return err
+		}
+		rdata, _ := canonicalWireRdata(rr)
+		ttl := int(rr.TTL)
+		add := Operation{Kind: AddRR, Name: name, TTL: &ttl, Class: class,
+			Type: typ, Values: values}
+
+		existing := u.find(name, wire.TypeANY)
+		hasCNAME, hasOther := false, false
+		for _, r := range existing {
+			switch r.Type {
+			case "CNAME":
+				hasCNAME = true
+			case "RRSIG", "NSEC", "NSEC3":
+			default:
+				hasOther = true
+			}
+		}
+		switch {
+		case rr.Type == wire.TypeSOA:
+			if name != u.apex {
+				return nil
+			}
+			old, _ := u.z.Serial()
+			serial, err := ParseSerial([]byte(values[2]))
+			if err != nil || !serial.Greater(old) {
+				return nil
+			}
+			u.serialSet = true
+			return u.replaceSOA(values, ttl)
+		case rr.Type == wire.TypeCNAME && hasOther:
+			return nil
+		case rr.Type == wire.TypeCNAME && hasCNAME:
+			ops = append(ops, Operation{Kind: DeleteRRset, Name: name,
+				Class: class, Type: "CNAME"}, add)
+		case rr.Type != wire.TypeCNAME && hasCNAME &&
+			typ != "RRSIG" && typ != "NSEC" && typ != "NSEC3":
+			return nil
+		default:
+			for _, r := range existing {
+				if r.Type != typ || strings.Join(r.rdata, " ") != rdata {
+					continue
+				}
+				if r.TTL == ttl {
+					return nil
+				}
+				// Replace the record to change its TTL
+				ops = append(ops, Operation{Kind: DeleteRR, Name: name,
+					Class: class, Type: typ, Values: values})
+			}
+			ops = append(ops, add)
+		}
+
+	case wire.ClassANY:
+		for _, r := range u.find(name, rr.Type) {
+			if name == u.apex && (r.Type == "SOA" || r.Type == "NS") {
+				continue
+			}
+			ops = append(ops, Operation{Kind: DeleteRRset, Name: name,
+				Class: class, Type: r.Type})
+		}
+
+	case wire.ClassNONE:
+		if rr.Type == wire.TypeSOA {
+			return nil
+		}
+		if name == u.apex && rr.Type == wire.TypeNS &&
+			len(u.find(name, wire.TypeNS)) <= 1 {
+			return nil
+		}
+		values, err := rdataFromWire(typ, rr)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, Operation{Kind: DeleteRR, Name: name,
+			Class: class, Type: typ, Values: values})
+	}
+
+	return u.apply(ops)
+}
+
+// Changes the values of the SOA record in place, so that it keeps its place
+// and its style.
+func (u *updater) replaceSOA(values []string, ttl int) error {
+	soa := u.find(u.apex, wire.TypeSOA)
+	if len(soa) == 0 {
+		return errors.New("zone has no SOA record")
+	}
+	r := soa[0]
+	if r.Zonefile != u.z {
+		return fmt.Errorf("SOA record is in included file %s",
+			r.Zonefile.Path())
+	}
+	fields, _, err := canonicalRdata("SOA", stringsToBytes(values), "")
+	if err != nil {
+		return err
+	}
+	for i, v := range values {
+		if i >= len(r.rdata) || fields[i] == r.rdata[i] {
+			continue
+		}
+		if i < 2 {
+			v = relativeName(v, r.origin)
+		}
+		if err := r.Entry.SetValue(i, []byte(v)); err != nil {
+			return err
+		}
+	}
+	if r.TTL != ttl {
+		if err := r.Entry.SetTTL(ttl); err != nil {
+			return err
+		}
+	}
+	u.changed = true
+	return u.load()
+}
+
+// Applies the operations.  Deleting what isn't there is not an error:
+// RFC 2136 says such updates are silently ignored.
+func (u *updater) apply(ops []Operation) error {
+	for _, op := range ops {
+		conflicts, err := u.z.Apply([]Operation{op},
+			ApplyOptions{Origin: u.origin})
+		if err != nil {
+			return err
+		}
+		if len(conflicts) == 0 {
+			u.changed = true
+		} else if op.Kind == AddRR ||
+			strings.HasPrefix(conflicts[0].Reason, "record is in") {
+			return conflicts[0]
+		}
+	}
+	if len(ops) > 0 {
+		return u.load()
+	}
+	return nil
+}
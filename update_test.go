@@ -0,0 +1,241 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"testing"
+)
+
+const updateZone = `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.4 ; web server
+ftp  IN CNAME www
+`
+
+// Returns an UPDATE message for example.com. with the given prerequisites
+// and updates
+func updateMessage(prereqs, updates []wire.RR) []byte {
+	msg, err := (&wire.Message{
+		ID:     42,
+		Opcode: wire.OpcodeUpdate,
+		Question: []wire.Question{{Name: "example.com.", Type: wire.TypeSOA,
+			Class: wire.ClassINET}},
+		Answer:    prereqs,
+		Authority: updates,
+	}).Pack()
+	if err != nil {
+		panic(err)
+	}
+	return msg
+}
+
+func aRecord(name string, class uint16, ttl uint32, ip ...byte) wire.RR {
+	return wire.RR{Name: name, Type: 1, Class: class, TTL: ttl, Data: ip}
+}
+
+func ExampleZonefile_ApplyUpdate() {
+	zf, err := zonefile.Load([]byte(updateZone))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	msg := updateMessage(
+		// www.example.com. must have an A record
+		[]wire.RR{{Name: "www.example.com.", Type: 1, Class: wire.ClassANY}},
+		[]wire.RR{
+			// delete www.example.com. A 1.2.3.4
+			aRecord("www.example.com.", wire.ClassNONE, 0, 1, 2, 3, 4),
+			// add www.example.com. 300 A 1.2.3.5
+			aRecord("www.example.com.", wire.ClassINET, 300, 1, 2, 3, 5),
+		})
+	rcode, err2 := zf.ApplyUpdate(msg, zonefile.ApplyOptions{})
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	fmt.Println(rcode)
+	fmt.Print(string(zf.Save()))
+	// Output:
+	// NOERROR
+	// $ORIGIN example.com.
+	// $TTL 3600
+	// @    IN SOA ns1 hostmaster 2 3600 600 604800 60
+	//      IN NS  ns1
+	// ns1  IN A   1.2.3.4
+	// ftp  IN CNAME www
+	// www 300  IN A   1.2.3.5
+}
+
+func TestApplyUpdate(t *testing.T) {
+	www := "www.example.com."
+	for _, test := range []struct {
+		name     string
+		prereqs  []wire.RR
+		updates  []wire.RR
+		rcode    zonefile.Rcode
+		expected string // the zonefile, if it changed
+	}{
+		{"name in use", []wire.RR{
+			{Name: www, Type: wire.TypeANY, Class: wire.ClassANY},
+		}, nil, zonefile.RcodeNoError, ""},
+		{"name not in use", []wire.RR{
+			{Name: "mail.example.com.", Type: wire.TypeANY, Class: wire.ClassANY},
+		}, nil, zonefile.RcodeNXDomain, ""},
+		{"name in use that shouldn't be", []wire.RR{
+			{Name: www, Type: wire.TypeANY, Class: wire.ClassNONE},
+		}, nil, zonefile.RcodeYXDomain, ""},
+		{"RRset exists that shouldn't", []wire.RR{
+			{Name: www, Type: 1, Class: wire.ClassNONE},
+		}, nil, zonefile.RcodeYXRRSet, ""},
+		{"RRset doesn't exist", []wire.RR{
+			{Name: www, Type: 28, Class: wire.ClassANY},
+		}, nil, zonefile.RcodeNXRRSet, ""},
+		{"RRset with values", []wire.RR{
+			aRecord(www, wire.ClassINET, 0, 1, 2, 3, 4),
+		}, nil, zonefile.RcodeNoError, ""},
+		{"RRset with other values", []wire.RR{
+			aRecord(www, wire.ClassINET, 0, 1, 2, 3, 4),
+			aRecord(www, wire.ClassINET, 0, 1, 2, 3, 5),
+		}, nil, zonefile.RcodeNXRRSet, ""},
+		{"prerequisite with TTL", []wire.RR{
+			aRecord(www, wire.ClassINET, 60, 1, 2, 3, 4),
+		}, nil, zonefile.RcodeFormErr, ""},
+		{"prerequisite outside zone", []wire.RR{
+			{Name: "example.org.", Type: wire.TypeANY, Class: wire.ClassANY},
+		}, nil, zonefile.RcodeNotZone, ""},
+		{"update outside zone", nil, []wire.RR{
+			aRecord("example.org.", wire.ClassINET, 60, 1, 2, 3, 4),
+		}, zonefile.RcodeNotZone, ""},
+		{"delete with TTL", nil, []wire.RR{
+			aRecord(www, wire.ClassNONE, 60, 1, 2, 3, 4),
+		}, zonefile.RcodeFormErr, ""},
+
+		{"delete RRset", nil, []wire.RR{
+			{Name: www, Type: 1, Class: wire.ClassANY},
+		}, zonefile.RcodeNoError, `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 2 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+ftp  IN CNAME www
+`},
+		{"delete apex keeps SOA and NS", nil, []wire.RR{
+			{Name: "example.com.", Type: wire.TypeANY, Class: wire.ClassANY},
+			{Name: "example.com.", Type: wire.TypeNS, Class: wire.ClassANY},
+		}, zonefile.RcodeNoError, ""},
+		{"deleting the last NS is ignored", nil, []wire.RR{
+			{Name: "example.com.", Type: wire.TypeNS, Class: wire.ClassNONE,
+				Data: []byte{3, 'n', 's', '1', 7, 'e', 'x', 'a', 'm', 'p', 'l',
+					'e', 3, 'c', 'o', 'm', 0}},
+		}, zonefile.RcodeNoError, ""},
+		{"adding beside a CNAME is ignored", nil, []wire.RR{
+			aRecord("ftp.example.com.", wire.ClassINET, 60, 1, 2, 3, 4),
+		}, zonefile.RcodeNoError, ""},
+		{"adding an existing record changes its TTL", nil, []wire.RR{
+			aRecord("ns1.example.com.", wire.ClassINET, 60, 1, 2, 3, 4),
+		}, zonefile.RcodeNoError, `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 2 3600 600 604800 60
+     IN NS  ns1
+www  IN A   1.2.3.4 ; web server
+ftp  IN CNAME www
+ns1 60  IN A   1.2.3.4
+`},
+		{"IPv4-mapped address", nil, []wire.RR{
+			{Name: "mail.example.com.", Type: 28, Class: wire.ClassINET,
+				TTL: 60, Data: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff,
+					192, 0, 2, 1}},
+		}, zonefile.RcodeNoError, `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 2 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.4 ; web server
+ftp  IN CNAME www
+mail 60 IN AAAA ::ffff:192.0.2.1
+`},
+		{"greater serial is kept", nil, []wire.RR{
+			{Name: "example.com.", Type: wire.TypeSOA, Class: wire.ClassINET,
+				TTL: 3600, Data: soaData(10)},
+		}, zonefile.RcodeNoError, `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 10 3600 600 604800 60
+     IN NS  ns1
+ns1  IN A   1.2.3.4
+www  IN A   1.2.3.4 ; web server
+ftp  IN CNAME www
+`},
+	} {
+		zf, err := zonefile.Load([]byte(updateZone))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rcode, err2 := zf.ApplyUpdate(updateMessage(test.prereqs,
+			test.updates), zonefile.ApplyOptions{})
+		if err2 != nil {
+			t.Fatalf("%s: %v", test.name, err2)
+		}
+		if rcode != test.rcode {
+			t.Fatalf("%s: got %v instead of %v", test.name, rcode, test.rcode)
+		}
+		expected := test.expected
+		if expected == "" {
+			expected = updateZone
+		}
+		if got := string(zf.Save()); got != expected {
+			t.Fatalf("%s: got\n%s\ninstead of\n%s", test.name, got, expected)
+		}
+	}
+}
+
+// Returns the data of the SOA record of updateZone with the given serial
+func soaData(serial uint32) []byte {
+	b, _ := wire.AppendName(nil, "ns1.example.com.")
+	b, _ = wire.AppendName(b, "hostmaster.example.com.")
+	for _, v := range []uint32{serial, 3600, 600, 604800, 60} {
+		b = append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return b
+}
+
+func TestApplyUpdateHeader(t *testing.T) {
+	zf, err := zonefile.Load([]byte(updateZone))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		msg   wire.Message
+		rcode zonefile.Rcode
+	}{
+		{wire.Message{Opcode: wire.OpcodeQuery}, zonefile.RcodeNotImp},
+		{wire.Message{Opcode: wire.OpcodeUpdate}, zonefile.RcodeFormErr},
+		{wire.Message{Opcode: wire.OpcodeUpdate, Question: []wire.Question{
+			{Name: "example.org.", Type: wire.TypeSOA,
+				Class: wire.ClassINET}}},
+			zonefile.RcodeNotAuth},
+	} {
+		msg, _ := test.msg.Pack()
+		rcode, err := zf.ApplyUpdate(msg, zonefile.ApplyOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rcode != test.rcode {
+			t.Fatalf("got %v instead of %v", rcode, test.rcode)
+		}
+		resp, err := zonefile.UpdateResponse(msg, rcode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := wire.Unpack(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !m.Response || m.Rcode != int(rcode) {
+			t.Fatalf("wrong response %+v", m)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package zonefile
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile/internal/wire"
+	"sort"
+)
+
+// How bad a problem found by Validate is
+type Severity int
+
+const (
+	// The zone can be served, but probably not as intended
+	SeverityWarning Severity = iota
+
+	// A nameserver would refuse to serve the zone
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// A problem found by Validate
+type Finding struct {
+	Severity Severity
+	Message  string
+	Record   *Record // the offending record, or nil for the zone as a whole
+}
+
+// The path of the zonefile with the offending record, if known
+func (f Finding) File() string {
+	if f.Record == nil {
+		return ""
+	}
+	return f.Record.Zonefile.Path()
+}
+
+// The line of the offending record, counting from 0, or -1 if the finding
+// is about the zone as a whole.
+func (f Finding) LineNo() int {
+	if f.Record == nil {
+		return -1
+	}
+	return f.Record.Entry.LineNo()
+}
+
+func (f Finding) String() string {
+	if f.Record == nil {
+		return fmt.Sprintf("%v: %s", f.Severity, f.Message)
+	}
+	return fmt.Sprintf("line %d: %v: %s", f.LineNo()+1, f.Severity,
+		f.Message)
+}
+
+// Checks whether the zone is consistent.  The origin is that of the zone,
+// as for Records; if it's empty, the owner of the SOA record is taken as
+// the apex of the zone.  The following is checked:
+//
+//   - there is exactly one SOA record, at the apex;
+//   - there are NS records at the apex;
+//   - a CNAME record doesn't share its owner with other data;
+//   - all owners are within the zone;
+//   - name servers within the zone, such as glue for delegations, have
+//     address records;
+//   - there are no duplicate records;
+//   - the records of an RRset have the same TTL.
+//
+// Records that can't be resolved are returned as ParsingError, as for
+// Records.  The findings are in the order of the records.
+func (z *Zonefile) Validate(origin string) ([]Finding, error) {
+	records, err := z.Records(origin)
+	if err != nil {
+		return nil, err
+	}
+	return validate(records, origin), nil
+}
+
+// Validates the resolved records of a zone
+func validate(records []Record, origin string) []Finding {
+	v := validator{records: records}
+	v.index()
+	if origin != "" {
+		v.apex, _ = wire.CanonicalName(origin)
+	} else if len(v.soas) > 0 {
+		v.apex = v.names[v.soas[0]]
+	}
+	v.checkSOA()
+	if v.apex != "" {
+		v.checkApexNS()
+		v.checkOwners()
+		v.checkNameServers()
+	}
+	v.checkCNAMEs()
+	v.checkRRsets()
+	sort.Stable(&v)
+	return v.findings
+}
+
+// Keeps track of the state while validating a zone
+type validator struct {
+	records  []Record
+	names    []string // canonical owner names of the records
+	apex     string
+	soas     []int            // indices of the SOA records
+	byName   map[string][]int // indices of the records by owner
+	findings []Finding
+	order    []int // index of the record of each finding
+}
+
+// Sorts the findings by the index of their record
+func (v *validator) Len() int           { return len(v.findings) }
+func (v *validator) Less(i, j int) bool { return v.order[i] < v.order[j] }
+func (v *validator) Swap(i, j int) {
+	v.findings[i], v.findings[j] = v.findings[j], v.findings[i]
+	v.order[i], v.order[j] = v.order[j], v.order[i]
+}
+
+// An RRset is identified by its owner, class and type
+type rrsetKey struct {
+	name, class, typ string
+}
+
+func (v *validator) index() {
+	v.byName = make(map[string][]int)
+	for i, r := range v.records {
+		name, _ := wire.CanonicalName(r.Name)
+		v.names = append(v.names, name)
+		v.byName[name] = append(v.byName[name], i)
+		if r.Type == "SOA" {
+			v.soas = append(v.soas, i)
+		}
+	}
+}
+
+// Adds a finding about the i-th record, or about the zone if i is -1
+func (v *validator) add(i int, severity Severity, format string,
+	args ...interface{}) {
+	f := Finding{Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if i >= 0 {
+		f.Record = &v.records[i]
+	}
+	v.findings = append(v.findings, f)
+	v.order = append(v.order, i)
+}
+
+func (v *validator) checkSOA() {
+	if len(v.soas) == 0 {
+		v.add(-1, SeverityError, "no SOA record")
+		return
+	}
+	for n, i := range v.soas {
+		if v.apex != "" && v.names[i] != v.apex {
+			v.add(i, SeverityError, "SOA record for %s is not at the apex %s",
+				v.records[i].Name, v.apex)
+		} else if n > 0 {
+			v.add(i, SeverityError, "multiple SOA records")
+		}
+	}
+}
+
+func (v *validator) checkApexNS() {
+	for _, i := range v.byName[v.apex] {
+		if v.records[i].Type == "NS" {
+			return
+		}
+	}
+	soa := -1
+	if len(v.soas) > 0 {
+		soa = v.soas[0]
+	}
+	v.add(soa, SeverityError, "no NS records at the apex %s", v.apex)
+}
+
+func (v *validator) checkOwners() {
+	for i, name := range v.names {
+		if !wire.IsSubdomain(name, v.apex) {
+			v.add(i, SeverityError, "%s is outside of the zone %s",
+				v.records[i].Name, v.apex)
+		}
+	}
+}
+
+// Returns the delegation point above or at the name, if any
+func (v *validator) delegation(name string) string {
+	for n := name; n != v.apex; n = wire.ParentName(n) {
+		if !wire.IsSubdomain(n, v.apex) {
+			break
+		}
+		for _, i := range v.byName[n] {
+			if v.records[i].Type == "NS" {
+				return n
+			}
+		}
+	}
+	return ""
+}
+
+func (v *validator) checkNameServers() {
+	for i, r := range v.records {
+		if r.Type != "NS" || len(r.rdata) != 1 {
+			continue
+		}
+		target := r.rdata[0]
+		if !wire.IsSubdomain(target, v.apex) || v.hasAddress(target) {
+			continue
+		}
+		if v.delegation(target) != "" {
+			v.add(i, SeverityError, "missing glue for name server %s",
+				target)
+		} else {
+			v.add(i, SeverityError, "name server %s has no address records",
+				target)
+		}
+	}
+}
+
+// Checks whether there are A or AAAA records for the name
+func (v *validator) hasAddress(name string) bool {
+	for _, i := range v.byName[name] {
+		if t := v.records[i].Type; t == "A" || t == "AAAA" {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *validator) checkCNAMEs() {
+	for i, r := range v.records {
+		if r.Type != "CNAME" {
+			continue
+		}
+		if j := v.firstOfType(v.names[i], r.Class, "CNAME"); j < i {
+			v.add(i, SeverityError, "multiple CNAME records for %s", r.Name)
+			continue
+		}
+		for _, j := range v.byName[v.names[i]] {
+			other := v.records[j]
+			if other.Class != r.Class {
+				continue
+			}
+			switch other.Type {
+			case "CNAME":
+				// Reported above
+			case "RRSIG", "NSEC", "KEY", "SIG", "NXT":
+				// Allowed next to a CNAME by RFC 2535 and RFC 4035
+			default:
+				v.add(j, SeverityError, "%s record next to CNAME record for %s",
+					other.Type, r.Name)
+			}
+		}
+	}
+}
+
+// Returns the index of the first record of the RRset
+func (v *validator) firstOfType(name, class, typ string) int {
+	for _, i := range v.byName[name] {
+		if v.records[i].Class == class && v.records[i].Type == typ {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *validator) checkRRsets() {
+	first := make(map[rrsetKey]int)
+	seen := make(map[string]int)
+	for i, r := range v.records {
+		key := rrsetKey{v.names[i], r.Class, r.Type}
+		rr := fmt.Sprint(key, r.rdata)
+		if j, ok := seen[rr]; ok {
+			v.add(i, SeverityWarning, "duplicate of the record on line %d",
+				v.records[j].Entry.LineNo()+1)
+			continue
+		}
+		seen[rr] = i
+		j, ok := first[key]
+		if !ok {
+			first[key] = i
+			continue
+		}
+		// The records that sign an RRset can have the TTL of that RRset
+		if r.Type != "RRSIG" && r.TTL != v.records[j].TTL {
+			v.add(i, SeverityWarning,
+				"TTL %d differs from TTL %d of the record on line %d "+
+					"in the same RRset", r.TTL, v.records[j].TTL,
+				v.records[j].Entry.LineNo()+1)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package zonefile_test
+
+import (
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"testing"
+)
+
+func ExampleZonefile_Validate() {
+	zf, err := zonefile.Load([]byte(`$ORIGIN example.com.
+$TTL 3600
+@     IN SOA ns1 hostmaster 1 3600 600 604800 60
+      IN NS  ns1
+www      CNAME @
+www      A   1.2.3.4`))
+	if err != nil {
+		fmt.Println("Parsing error", err, "on line", err.LineNo())
+		return
+	}
+	findings, err2 := zf.Validate("")
+	if err2 != nil {
+		fmt.Println(err2)
+		return
+	}
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	// Output:
+	// line 4: error: name server ns1.example.com. has no address records
+	// line 6: error: A record next to CNAME record for www.example.com.
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		zone     string
+		findings []string
+	}{
+		{"@ SOA ns1 hm 1 2 3 4 5\n@ NS ns1\nns1 A 1.2.3.4\n", nil},
+		{"@ NS ns1.example.net.\n",
+			[]string{"error: no SOA record"}},
+		{"@ SOA ns1 hm 1 2 3 4 5\nns1 A 1.2.3.4\n", []string{
+			"line 1: error: no NS records at the apex example.com."}},
+		{"@ SOA ns1 hm 1 2 3 4 5\n@ NS ns1.example.net.\n" +
+			"@ SOA ns1 hm 2 2 3 4 5\nwww SOA ns1 hm 1 2 3 4 5\n", []string{
+			"line 3: error: multiple SOA records",
+			"line 4: error: SOA record for www.example.com. is not at " +
+				"the apex example.com."}},
+		{"@ SOA ns1 hm 1 2 3 4 5\n@ NS ns1.example.net.\n" +
+			"www.example.org. A 1.2.3.4\n", []string{
+			"line 3: error: www.example.org. is outside of the zone " +
+				"example.com."}},
+		{"@ SOA ns1 hm 1 2 3 4 5\n@ NS ns1.example.net.\n" +
+			"sub NS ns1.sub\nsub NS ns2.sub\nns2.sub A 1.2.3.4\n" +
+			"other NS ns.example.net.\n", []string{
+			"line 3: error: missing glue for name server ns1.sub.example.com."}},
+		{"@ SOA ns1 hm 1 2 3 4 5\n@ NS ns1.example.net.\n" +
+			"www CNAME @\nwww CNAME ftp\nwww TXT hi\n", []string{
+			"line 4: error: multiple CNAME records for www.example.com.",
+			"line 5: error: TXT record next to CNAME record for " +
+				"www.example.com."}},
+		{"@ SOA ns1 hm 1 2 3 4 5\n@ NS ns1.example.net.\n" +
+			"www A 1.2.3.4\nWWW A 1.2.3.4\nwww 60 A 1.2.3.5\n", []string{
+			"line 4: warning: duplicate of the record on line 5",
+			"line 5: warning: TTL 60 differs from TTL 3600 of the record " +
+				"on line 5 in the same RRset"}},
+	} {
+		zf, err := zonefile.Load([]byte("$ORIGIN example.com.\n$TTL 3600\n" +
+			test.zone))
+		if err != nil {
+			t.Fatal(err)
+		}
+		findings, err2 := zf.Validate("")
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+		if len(findings) != len(test.findings) {
+			t.Fatalf("Unexpected findings for %q: %v", test.zone, findings)
+		}
+		for i, f := range findings {
+			// Skip the $ORIGIN and $TTL lines
+			s := f.String()
+			if f.LineNo() >= 0 {
+				s = fmt.Sprintf("line %d: %v: %s", f.LineNo()-1, f.Severity,
+					f.Message)
+			}
+			if s != test.findings[i] {
+				t.Fatalf("Unexpected finding for %q: %s", test.zone, s)
+			}
+		}
+	}
+}
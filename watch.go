@@ -0,0 +1,257 @@
+package zonefile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often a Watcher checks the files by default
+const defaultWatchInterval = time.Second
+
+// Options for Watch
+type WatchOptions struct {
+	// The origin of the zone, as for Records
+	Origin string
+
+	// How often the files are checked for changes; 1s if zero
+	Interval time.Duration
+
+	// Called with each new snapshot after the first; may be nil
+	OnChange func(s *Snapshot)
+
+	// Called when a new version of the zonefile can't be loaded, with a
+	// ParsingError if it doesn't parse; may be nil.  The previous snapshot
+	// is kept.
+	OnError func(err error)
+}
+
+// A version of a zonefile and the files it includes, as loaded by a
+// Watcher.  It doesn't change: the records it returns must not be changed
+// either.
+type Snapshot struct {
+	path     string
+	files    map[string][]byte // the zonefile and the files it includes
+	records  []Record
+	findings []Finding
+	stamps   map[string]fileStamp // of the files it was read from
+	loaded   time.Time
+}
+
+// Returns a copy of the zonefile of the snapshot, which may be changed.
+// Records and Includes return the files it includes as they were when
+// the snapshot was loaded, not as they are now.
+func (s *Snapshot) Zonefile() *Zonefile {
+	// It parsed before, so it parses again
+	z, _ := loadFile(s.path, s.readFile)
+	return z
+}
+
+// Returns the file as it was when the snapshot was loaded
+func (s *Snapshot) readFile(path string) ([]byte, error) {
+	data, ok := s.files[path]
+	if !ok {
+		return nil, fmt.Errorf("%s is not part of the snapshot", path)
+	}
+	return data, nil
+}
+
+// Returns the records of the zone, as Zonefile.Records
+func (s *Snapshot) Records() []Record {
+	return append([]Record{}, s.records...)
+}
+
+// Returns what Zonefile.Validate found in the zone
+func (s *Snapshot) Findings() []Finding {
+	return append([]Finding{}, s.findings...)
+}
+
+// Returns the paths of the files the snapshot was read from: the zonefile
+// and the files it includes.
+func (s *Snapshot) Files() []string {
+	files := make([]string, 0, len(s.stamps))
+	for path := range s.stamps {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// Returns when the snapshot was loaded
+func (s *Snapshot) Loaded() time.Time {
+	return s.loaded
+}
+
+// What we know of a file to tell whether it changed
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func stampOf(path string) fileStamp {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{true, fi.Size(), fi.ModTime()}
+}
+
+// Keeps an up to date snapshot of a zonefile and the files it includes.
+// Files are checked for changes by their size and modification time.
+type Watcher struct {
+	path string
+	opts WatchOptions
+
+	snapshot atomic.Value // *Snapshot
+
+	mu     sync.Mutex // held during Check
+	stamps map[string]fileStamp
+	err    error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Loads the zonefile at the path and watches it and the files it includes
+// for changes, until Close is called.  Returns an error if the zonefile
+// can't be loaded.
+func Watch(path string, opts WatchOptions) (*Watcher, error) {
+	w := &Watcher{path: path, opts: opts, stamps: map[string]fileStamp{},
+		stop: make(chan struct{}), done: make(chan struct{})}
+	s, err := w.load(map[string]fileStamp{path: stampOf(path)})
+	if err != nil {
+		return nil, err
+	}
+	w.snapshot.Store(s)
+	w.stamps = s.stamps
+	if w.opts.Interval <= 0 {
+		w.opts.Interval = defaultWatchInterval
+	}
+	go w.run()
+	return w, nil
+}
+
+// Returns the current snapshot
+func (w *Watcher) Snapshot() *Snapshot {
+	return w.snapshot.Load().(*Snapshot)
+}
+
+// Returns why the files as they are now couldn't be loaded, or nil if the
+// current snapshot is up to date.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Checks the files for changes right away, and loads them if they
+// changed.  Returns whether there is a new snapshot.
+func (w *Watcher) Check() (bool, error) {
+	s, err := w.check()
+	switch {
+	case err != nil && w.opts.OnError != nil:
+		w.opts.OnError(err)
+	case s != nil && w.opts.OnChange != nil:
+		w.opts.OnChange(s)
+	}
+	return s != nil, err
+}
+
+// Returns the new snapshot if the files changed, or why they couldn't be
+// loaded.
+func (w *Watcher) check() (*Snapshot, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stamps := make(map[string]fileStamp)
+	changed := false
+	for path, old := range w.stamps {
+		stamps[path] = stampOf(path)
+		changed = changed || stamps[path] != old
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	s, err := w.load(stamps)
+	if err != nil {
+		// Don't try again until something changes, also in the file with
+		// the error.
+		if ferr, ok := err.(FileError); ok && ferr.File() != "" {
+			if _, ok := stamps[ferr.File()]; !ok {
+				stamps[ferr.File()] = stampOf(ferr.File())
+			}
+		}
+		w.stamps, w.err = stamps, err
+		return nil, err
+	}
+	w.snapshot.Store(s)
+	w.stamps, w.err = s.stamps, nil
+	return s, nil
+}
+
+// Loads a snapshot of the zonefile and the files it includes, as they
+// are read.  The stamps were taken before loading; those of files that
+// turn out to be included are taken just before they're read, so that a
+// change while loading is picked up by the next check.
+func (w *Watcher) load(stamps map[string]fileStamp) (*Snapshot, error) {
+	s := &Snapshot{
+		path:   w.path,
+		files:  make(map[string][]byte),
+		stamps: make(map[string]fileStamp),
+	}
+	z, err := loadFile(w.path, func(path string) ([]byte, error) {
+		stamp, ok := stamps[path]
+		if !ok {
+			stamp = stampOf(path)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s.files[path], s.stamps[path] = data, stamp
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.records, err = z.Records(w.opts.Origin); err != nil {
+		return nil, err
+	}
+	// From now on the zonefiles of the records read what we've read
+	z.readFile = s.readFile
+	for _, r := range s.records {
+		r.Zonefile.readFile = s.readFile
+	}
+	s.findings = validate(s.records, w.opts.Origin)
+	s.loaded = time.Now()
+	return s, nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// Stops watching the files.  The last snapshot stays available.
+func (w *Watcher) Close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
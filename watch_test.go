@@ -0,0 +1,123 @@
+package zonefile_test
+
+import (
+	"github.com/bwesterb/go-zonefile"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "example.com.zone")
+	hosts := filepath.Join(dir, "hosts.zone")
+	writeFile(t, main, `$ORIGIN example.com.
+$TTL 3600
+@    IN SOA ns1 hostmaster 1 3600 600 604800 60
+     IN NS  ns1
+$INCLUDE hosts.zone
+`)
+	writeFile(t, hosts, "ns1 IN A 192.0.2.1\n")
+
+	w, err := zonefile.Watch(main, zonefile.WatchOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	first := w.Snapshot()
+	if files := first.Files(); len(files) != 2 || files[1] != hosts {
+		t.Fatalf("watching %v", files)
+	}
+	if len(first.Records()) != 3 || len(first.Findings()) != 0 {
+		t.Fatalf("snapshot has %d records and findings %v",
+			len(first.Records()), first.Findings())
+	}
+
+	if changed, err := w.Check(); changed || err != nil {
+		t.Fatalf("nothing changed, but Check returned %v, %v", changed, err)
+	}
+
+	// A change in the included file, which the zonefile of the snapshot
+	// doesn't see
+	writeFile(t, hosts, "ns1 IN A 192.0.2.1\nwww IN A 192.0.2.2\n")
+	if records, err := first.Zonefile().Records(""); err != nil ||
+		len(records) != 3 {
+		t.Fatalf("snapshot zonefile has %d records: %v", len(records), err)
+	}
+	if changed, err := w.Check(); !changed || err != nil {
+		t.Fatalf("change wasn't picked up: %v", err)
+	}
+	second := w.Snapshot()
+	if len(second.Records()) != 4 || len(first.Records()) != 3 {
+		t.Fatal("wrong number of records in the snapshots")
+	}
+
+	// A parsing error keeps the old snapshot
+	writeFile(t, hosts, "ns1 IN A 192.0.2.1\nwww IN TXT \"oops\n")
+	changed, err := w.Check()
+	perr, ok := err.(zonefile.ParsingError)
+	ferr, _ := err.(zonefile.FileError)
+	if changed || !ok || ferr == nil || ferr.File() != hosts ||
+		perr.LineNo() != 1 {
+		t.Fatalf("expected a parsing error in %s, not %v", hosts, err)
+	}
+	if w.Snapshot() != second || w.Err() != err {
+		t.Fatal("snapshot changed after a parsing error")
+	}
+	if changed, err := w.Check(); changed || err != nil {
+		t.Fatalf("nothing changed, but Check returned %v, %v", changed, err)
+	}
+
+	writeFile(t, hosts, "ns1 IN A 192.0.2.1\nwww IN A 192.0.2.3\n")
+	if changed, err := w.Check(); !changed || err != nil || w.Err() != nil {
+		t.Fatalf("fix wasn't picked up: %v", err)
+	}
+	if got := w.Snapshot().Records()[3].Values[0]; got != "192.0.2.3" {
+		t.Fatalf("www has address %s", got)
+	}
+	if got := w.Snapshot().Zonefile().Path(); got != main {
+		t.Fatalf("zonefile has path %s", got)
+	}
+}
+
+func TestWatcherOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "example.com.zone")
+	writeFile(t, path, primaryZone)
+
+	snapshots := make(chan *zonefile.Snapshot, 1)
+	w, err := zonefile.Watch(path, zonefile.WatchOptions{
+		Interval: 10 * time.Millisecond,
+		OnChange: func(s *zonefile.Snapshot) { snapshots <- s },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	writeFile(t, path, primaryZone+"mail IN A 192.0.2.4\n")
+	select {
+	case s := <-snapshots:
+		if len(s.Records()) != 5 {
+			t.Fatalf("snapshot has %d records", len(s.Records()))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change wasn't picked up")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"os"
+	"strings"
+)
+
+const usage = `Usage: %s [flags] <path to zonefile> ...
+
+Checks zonefiles for syntax errors, for records that a nameserver would
+refuse to load and for inconsistencies in the zone, such as a missing SOA
+record or CNAME records next to other data.  Files included with $INCLUDE
+are checked as well.
+
+Flags:
+`
+
+const exitCodes = `
+Exit status:
+  0  no errors were found, although there may be warnings
+  1  errors were found
+  2  wrong usage
+`
+
+// A problem found in a zonefile
+type finding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`   // starts at 1
+	Column   int    `json:"column,omitempty"` // starts at 1
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (f finding) String() string {
+	loc := f.File
+	if f.Line > 0 {
+		loc += fmt.Sprintf(":%d", f.Line)
+		if f.Column > 0 {
+			loc += fmt.Sprintf(":%d", f.Column)
+		}
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, f.Severity, f.Message)
+}
+
+// Checks zonefiles, like named-checkzone
+func main() {
+	jsonOutput := flag.Bool("json", false, "write the findings as JSON")
+	origin := flag.String("origin", "",
+		"origin of the zone, if the zonefile doesn't start with $ORIGIN")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, exitCodes)
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *origin != "" && !strings.HasSuffix(*origin, ".") {
+		*origin += "."
+	}
+
+	findings := []finding{}
+	for _, path := range flag.Args() {
+		findings = append(findings, check(path, *origin)...)
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+
+	for _, f := range findings {
+		if f.Severity == "error" {
+			os.Exit(1)
+		}
+	}
+}
+
+// Checks the zonefile at the given path
+func check(path, origin string) (r []finding) {
+	zf, err := zonefile.LoadFile(path)
+	var problems []zonefile.Finding
+	if err == nil {
+		problems, err = zf.Validate(origin)
+	}
+	if err != nil {
+		f := finding{File: path, Severity: "error", Message: err.Error()}
+		if perr, ok := err.(zonefile.ParsingError); ok {
+			if ferr, ok := err.(zonefile.FileError); ok && ferr.File() != "" {
+				f.File = ferr.File()
+			}
+			f.Line = perr.LineNo() + 1
+			f.Column = perr.ColNo()
+		}
+		return []finding{f}
+	}
+	for _, p := range problems {
+		f := finding{
+			File:     p.File(),
+			Line:     p.LineNo() + 1,
+			Severity: p.Severity.String(),
+			Message:  p.Message,
+		}
+		if f.File == "" {
+			f.File = path
+		}
+		r = append(r, f)
+	}
+	return
+}
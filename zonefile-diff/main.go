@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const usage = `Usage: %s [flags] <old zonefile> <new zonefile>
+
+Shows the records that differ between two versions of a zone, ignoring
+differences in formatting and comments.
+
+Flags:
+`
+
+const exitCodes = `
+Formats:
+  text  changes grouped by owner, with the lines they are on
+  ixfr  the old SOA record, the removed records, the new SOA record and
+        the added records, as in an incremental zone transfer (RFC 1995)
+  json  an array of changes
+
+Exit status:
+  0  the zones have the same records
+  1  the zones differ
+  2  wrong usage, or a zonefile could not be read or parsed
+`
+
+// Compares two zonefiles
+func main() {
+	format := flag.String("format", "text", "output format: text, ixfr or json")
+	origin := flag.String("origin", "",
+		"origin of the zone, if the zonefiles don't start with $ORIGIN")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, exitCodes)
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != "text" && *format != "ixfr" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", *format)
+		os.Exit(2)
+	}
+	if *origin != "" && !strings.HasSuffix(*origin, ".") {
+		*origin += "."
+	}
+
+	a := load(flag.Arg(0))
+	b := load(flag.Arg(1))
+	changes, err := zonefile.DiffOrigin(a, b, *origin)
+	if err != nil {
+		printError(err)
+		os.Exit(2)
+	}
+
+	switch *format {
+	case "text":
+		writeText(changes)
+	case "ixfr":
+		writeIXFR(a, b, *origin, changes)
+	case "json":
+		writeJSON(changes)
+	}
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Reads the zonefile or exits
+func load(path string) *zonefile.Zonefile {
+	zf, err := zonefile.LoadFile(path)
+	if err != nil {
+		printError(err)
+		os.Exit(2)
+	}
+	return zf
+}
+
+// Prints an error, with the location for parsing errors
+func printError(err error) {
+	if perr, ok := err.(zonefile.ParsingError); ok {
+		path := ""
+		if ferr, ok := err.(zonefile.FileError); ok {
+			path = ferr.File()
+		}
+		fmt.Fprintf(os.Stderr, "%s:%d:%d: %v\n", path,
+			perr.LineNo()+1, perr.ColNo(), err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+// Returns where the record is, as path:line
+func location(r *zonefile.Record) string {
+	return r.Zonefile.Path() + ":" + strconv.Itoa(r.Entry.LineNo()+1)
+}
+
+// Writes the record without its owner
+func rdata(r *zonefile.Record) string {
+	return fmt.Sprintf("%d %s %s %s", r.TTL, r.Class, r.Type,
+		strings.Join(r.Values, " "))
+}
+
+func writeText(changes []zonefile.Change) {
+	owner := ""
+	for _, c := range changes {
+		name := c.New
+		if name == nil {
+			name = c.Old
+		}
+		if !strings.EqualFold(name.Name, owner) {
+			if owner != "" {
+				fmt.Println()
+			}
+			owner = name.Name
+			fmt.Println(owner)
+		}
+		if c.Old != nil {
+			fmt.Printf("  - %s  ; %s\n", rdata(c.Old), location(c.Old))
+		}
+		if c.New != nil {
+			fmt.Printf("  + %s  ; %s\n", rdata(c.New), location(c.New))
+		}
+	}
+}
+
+func writeIXFR(a, b *zonefile.Zonefile, origin string,
+	changes []zonefile.Change) {
+	oldSOA, newSOA := soa(a, origin), soa(b, origin)
+	if oldSOA == nil || newSOA == nil {
+		fmt.Fprintln(os.Stderr, "both zones need an SOA record")
+		os.Exit(2)
+	}
+	if oldSOA.Values[2] == newSOA.Values[2] && len(changes) > 0 {
+		fmt.Fprintln(os.Stderr, "warning: the serial didn't change")
+	}
+
+	fmt.Println(oldSOA)
+	for _, c := range changes {
+		if c.Old != nil && c.Old.Type != "SOA" {
+			fmt.Println(c.Old)
+		}
+	}
+	fmt.Println(newSOA)
+	for _, c := range changes {
+		if c.New != nil && c.New.Type != "SOA" {
+			fmt.Println(c.New)
+		}
+	}
+}
+
+// Returns the SOA record of the zone
+func soa(zf *zonefile.Zonefile, origin string) *zonefile.Record {
+	records, err := zf.Records(origin)
+	if err != nil {
+		printError(err)
+		os.Exit(2)
+	}
+	for i, r := range records {
+		if r.Type == "SOA" && len(r.Values) == 7 {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// A record as written by -format=json
+type jsonRecord struct {
+	Name   string   `json:"name"`
+	TTL    int      `json:"ttl"`
+	Class  string   `json:"class"`
+	Type   string   `json:"type"`
+	Values []string `json:"values"`
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+}
+
+// A change as written by -format=json
+type jsonChange struct {
+	Kind string      `json:"kind"`
+	Old  *jsonRecord `json:"old,omitempty"`
+	New  *jsonRecord `json:"new,omitempty"`
+}
+
+func toJSON(r *zonefile.Record) *jsonRecord {
+	if r == nil {
+		return nil
+	}
+	return &jsonRecord{r.Name, r.TTL, r.Class, r.Type, r.Values,
+		r.Zonefile.Path(), r.Entry.LineNo() + 1}
+}
+
+func writeJSON(changes []zonefile.Change) {
+	out := []jsonChange{}
+	for _, c := range changes {
+		out = append(out, jsonChange{c.Kind.String(), toJSON(c.Old),
+			toJSON(c.New)})
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
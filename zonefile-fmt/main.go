@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"io/ioutil"
+	"os"
+)
+
+// Formats zonefiles.
+//
+// Exit status is 0 on success, 1 if --check found an unformatted file
+// and 2 on any other error.
+func main() {
+	check := flag.Bool("check", false,
+		"don't write anything; exit with status 1 if a file isn't formatted")
+	write := flag.Bool("w", false,
+		"write the result to the file instead of to standard output")
+	relative := flag.Bool("relative", false,
+		"write owner names relative to the origin")
+	absolute := flag.Bool("absolute", false,
+		"write owner names as absolute names")
+	at := flag.Bool("at", false, "write the origin as @")
+	repeat := flag.Bool("repeat-owners", false,
+		"write out owners that are inherited from the previous record")
+	tabs := flag.Bool("tabs", false, "align columns with tabs")
+	origin := flag.String("origin", "",
+		"origin to assume before the first $ORIGIN")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:", os.Args[0],
+			"[flags] [path to zonefile ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *relative && *absolute {
+		fmt.Fprintln(os.Stderr, "-relative and -absolute are exclusive")
+		os.Exit(2)
+	}
+	if *check && *write {
+		fmt.Fprintln(os.Stderr, "-check and -w are exclusive")
+		os.Exit(2)
+	}
+
+	opts := zonefile.FormatOptions{
+		UseAt:        *at,
+		RepeatOwners: *repeat,
+		UseTabs:      *tabs,
+		Origin:       *origin,
+	}
+	if *relative {
+		opts.Owners = zonefile.OwnerRelative
+	}
+	if *absolute {
+		opts.Owners = zonefile.OwnerAbsolute
+	}
+
+	if flag.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "-w needs a path to a zonefile")
+			os.Exit(2)
+		}
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if !format("<stdin>", data, opts, *check, false) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	allFormatted := true
+	for _, path := range flag.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, path, err)
+			os.Exit(2)
+		}
+		if !format(path, data, opts, *check, *write) {
+			allFormatted = false
+		}
+	}
+	if !allFormatted {
+		os.Exit(1)
+	}
+}
+
+// Formats a single zonefile.  In check mode, returns whether the
+// zonefile was formatted already.
+func format(path string, data []byte, opts zonefile.FormatOptions,
+	check, write bool) bool {
+	zf, perr := zonefile.Load(data)
+	if perr != nil {
+		fmt.Fprintln(os.Stderr, path, perr.LineNo(), perr)
+		os.Exit(2)
+	}
+	formatted := zonefile.Format(zf, opts)
+
+	switch {
+	case check:
+		if !bytes.Equal(formatted, data) {
+			fmt.Println(path)
+			return false
+		}
+	case write:
+		if bytes.Equal(formatted, data) {
+			return true
+		}
+		zf, _ = zonefile.Load(formatted)
+		if err := zf.SaveFile(path); err != nil {
+			fmt.Fprintln(os.Stderr, path, err)
+			os.Exit(2)
+		}
+	default:
+		os.Stdout.Write(formatted)
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/bwesterb/go-zonefile"
+	"os"
+	"strings"
+)
+
+const usage = `Usage: %s [flags] <base> <ours> <theirs>
+
+Merges the changes from base to theirs into ours, record by record, and
+writes the result to ours.  The serial becomes one more than the greatest
+of the serials of ours and theirs, unless theirs didn't change.  RRsets
+that were changed differently in ours and theirs are conflicts: these are
+left as in ours, with a comment that shows theirs.
+
+To use it as a git merge driver, add to .git/config:
+
+  [merge "zonefile"]
+      name = zonefile merge driver
+      driver = zonefile-merge -path %%P %%O %%A %%B
+
+and to .gitattributes:
+
+  *.zone merge=zonefile
+
+Flags:
+`
+
+const exitCodes = `
+Exit status:
+  0  the merge succeeded
+  1  there were conflicts; ours was written with comments about them
+  2  wrong usage, or a zonefile could not be read, merged or written
+`
+
+// Merges zonefiles, as a git merge driver
+func main() {
+	origin := flag.String("origin", "",
+		"origin of the zone, if the zonefiles don't start with $ORIGIN")
+	path := flag.String("path", "", "path of the zonefile in the work "+
+		"tree, such as git's %P,\nagainst which relative $INCLUDE paths "+
+		"are taken")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, exitCodes)
+	}
+	flag.Parse()
+
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *origin != "" && !strings.HasSuffix(*origin, ".") {
+		*origin += "."
+	}
+
+	base := load(flag.Arg(0), *path)
+	ours := load(flag.Arg(1), *path)
+	theirs := load(flag.Arg(2), *path)
+	merged, conflicts, err := zonefile.MergeOrigin(base, ours, theirs,
+		*origin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, flag.Arg(1)+":", err)
+		os.Exit(2)
+	}
+
+	if err := merged.SaveFile(flag.Arg(1)); err != nil {
+		fmt.Fprintln(os.Stderr, flag.Arg(1)+":", err)
+		os.Exit(2)
+	}
+	for _, c := range conflicts {
+		fmt.Fprintln(os.Stderr, flag.Arg(1)+":", c)
+	}
+	if len(conflicts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Reads the zonefile or exits.  If includePath is set, relative $INCLUDE
+// paths are taken relative to it instead of to the file.
+func load(path, includePath string) *zonefile.Zonefile {
+	zf, err := zonefile.LoadFile(path)
+	if err != nil {
+		if perr, ok := err.(zonefile.ParsingError); ok {
+			fmt.Fprintf(os.Stderr, "%s:%d:%d: %v\n", path,
+				perr.LineNo()+1, perr.ColNo(), err)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+	if includePath != "" {
+		zf.SetPath(includePath)
+	}
+	return zf
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/bwesterb/go-zonefile/secondary"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `Usage: %s [flags] -primary <server> -zone <zone> <path to zonefile>
+
+Keeps the zonefile up to date with the zone on the primary nameserver, as a
+secondary nameserver would.  The serial of the zone on the primary is checked
+on the refresh and retry timers of the SOA record; when it's greater, the zone
+is transferred and the zonefile is written.  Changes are applied in place, so
+comments in the zonefile are kept.  If the primary can't be reached for longer
+than the expire timer, the zonefile is moved to <path>.expired.
+
+Runs until interrupted.
+
+Flags:
+`
+
+const exitCodes = `
+Exit status:
+  0  interrupted
+  1  wrong usage
+  2  could not listen for NOTIFY messages
+`
+
+const (
+	exitUsage  = 1
+	exitListen = 2
+)
+
+// Keeps a zonefile up to date with a zone on a primary
+func main() {
+	primary := flag.String("primary", "",
+		"host or IP address of the primary, optionally with port")
+	zone := flag.String("zone", "", "name of the zone")
+	notify := flag.String("notify", "",
+		"listen on this address, such as :53, for NOTIFY messages from "+
+			"the primary")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, usage, os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, exitCodes)
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 || *primary == "" || *zone == "" {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	s := &secondary.Secondary{
+		Primary: *primary,
+		Zone:    *zone,
+		Path:    flag.Arg(0),
+		Logf:    logger.Printf,
+	}
+
+	if *notify != "" {
+		conn, err := net.ListenPacket("udp", *notify)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitListen)
+		}
+		defer conn.Close()
+		go func() {
+			if err := s.ServeNotify(conn); err != nil {
+				logger.Printf("listening for NOTIFY messages: %v", err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	s.Run(ctx)
+}
@@ -19,6 +19,13 @@ import (
 type Zonefile struct {
 	entries []Entry
 	suffix  []token
+	path    string // set by LoadFile
+
+	// What the style of the records is inferred from; nil if not counted yet
+	counts *styleCounts
+
+	// Reads the files included by $INCLUDE entries; ioutil.ReadFile if nil
+	readFile func(path string) ([]byte, error)
 }
 
 func (z Zonefile) String() string {
@@ -84,10 +91,21 @@ func (e Entry) TTL() *int {
 	if len(is) == 0 {
 		return nil
 	}
-	i, _ := strconv.Atoi(string(e.tokens[is[0]].t.Value()))
+	i, _ := parseTTL(string(e.tokens[is[0]].t.Value()))
 	return &i
 }
 
+// The line on which the entry starts in the zonefile it was loaded from,
+// counting from 0 like ParsingError.LineNo.
+func (e Entry) LineNo() int {
+	for _, tt := range e.tokens {
+		if tt.t.IsItem() {
+			return tt.t.lineno
+		}
+	}
+	return 0
+}
+
 // The values specified for the entry
 func (e Entry) Values() (ret [][]byte) {
 	is := e.find(useValue)
@@ -115,6 +133,7 @@ func (e *Entry) SetDomain(v []byte) error {
 	if e.isControl {
 		return errors.New("control entry does not have a domain")
 	}
+	defer e.recount()()
 	is := e.find(useDomain)
 
 	if len(is) == 1 {
@@ -134,15 +153,9 @@ func (e *Entry) SetDomain(v []byte) error {
 	}
 
 	// If there is no domain item in the entry, add it
-	iFirstToken := e.startOfLine()
 	var tDomain = tttDomain
 	tDomain.t.SetValue(v)
-	toAdd := []taggedToken{tDomain}
-	if e.tokens[iFirstToken].t.typ != tokenWhiteSpace {
-		toAdd = append(toAdd, tttSpace)
-	}
-	e.tokens = append(e.tokens[:iFirstToken], append(toAdd,
-		e.tokens[iFirstToken:]...)...)
+	e.insertItem(e.startOfLine(), tDomain, e.style())
 	return nil
 }
 
@@ -151,6 +164,7 @@ func (e *Entry) SetTTL(v int) error {
 	if e.isControl {
 		return errors.New("control entry does not have a TTL")
 	}
+	defer e.recount()()
 
 	is := e.find(useTTL)
 
@@ -170,6 +184,7 @@ func (e *Entry) RemoveTTL() error {
 	if e.isControl {
 		return errors.New("control entry does not have a TTL")
 	}
+	defer e.recount()()
 
 	is := e.find(useTTL)
 
@@ -189,6 +204,7 @@ func (e *Entry) SetClass(v []byte) error {
 	if len(v) != 0 && !dns_classes_lut[string(v)] {
 		return errors.New("invalid dns class")
 	}
+	defer e.recount()()
 
 	is := e.find(useClass)
 
@@ -208,32 +224,37 @@ func (e *Entry) SetClass(v []byte) error {
 		return nil
 	}
 
-	// If there is no class item in the entry, add it
+	// If there is no class item in the entry, add it after the TTL, so
+	// that it ends up in the class column, or else after the domain
 	tClass := tttClass
 	tClass.t.SetValue(v)
+	if is := e.find(useTTL); len(is) == 1 {
+		e.insertItem(is[0]+1, tClass, e.style())
+		return nil
+	}
 	return e.addAfterDomain(tClass)
 }
 
 // Adds a new item taggedToken into the entry after the domain (if it's there)
-// and otherwise at the start of the line.
+// and otherwise at the start of the line.  The whitespace around it follows
+// the style of the zonefile.
 func (e *Entry) addAfterDomain(t taggedToken) error {
+	s := e.style()
+
 	// If there is no domain item in the entry, add it at the start of the line
 	domainIs := e.find(useDomain)
 	if len(domainIs) == 1 {
-		e.tokens = append(e.tokens[:domainIs[0]+1],
-			append([]taggedToken{tttSpace, t},
-				e.tokens[domainIs[0]+1:]...)...)
+		e.insertItem(domainIs[0]+1, t, s)
 		return nil
 	}
 
-	// There is no domain entry.  Add class to the start of the line.
-	iFirstToken := e.startOfLine()
-	toAdd := []taggedToken{t}
-	if e.tokens[iFirstToken].t.typ != tokenWhiteSpace {
-		toAdd = append([]taggedToken{tttSpace}, toAdd...)
+	// There is no domain entry.  Add class to the start of the line,
+	// after the whitespace that takes the place of the domain.
+	i := e.startOfLine()
+	if e.tokens[i].t.typ == tokenWhiteSpace {
+		i++
 	}
-	e.tokens = append(e.tokens[:iFirstToken+1], append(toAdd,
-		e.tokens[iFirstToken+1:]...)...)
+	e.insertItem(i, t, s)
 	return nil
 }
 
@@ -271,10 +292,17 @@ type ParsingError interface {
 	ColNo() int
 }
 
+// The parsing errors of LoadFile, Records and the other functions that
+// read files also implement FileError, to tell which file the error is in.
+type FileError interface {
+	File() string // path of the zonefile, if known
+}
+
 type parsingError struct {
 	msg    string
 	lineno int
 	colno  int
+	file   string
 }
 
 func (e parsingError) Error() string {
@@ -286,6 +314,9 @@ func (e parsingError) LineNo() int {
 func (e parsingError) ColNo() int {
 	return e.colno
 }
+func (e parsingError) File() string {
+	return e.file
+}
 
 // List entries in the zonefile
 func (z *Zonefile) Entries() (r []Entry) {
@@ -303,8 +334,23 @@ func (z *Zonefile) AddA(domain string, val string) *Entry {
 	return z.AddEntry(e)
 }
 
-// Add an entry to the zonefile
+// Add an entry to the zonefile.  Its owner, TTL, class and type are laid
+// out like the other records in the zonefile, and a TTL and class are
+// added if most other records have them.
 func (z *Zonefile) AddEntry(e Entry) *Entry {
+	return z.addEntry(e, z.defaultTTL)
+}
+
+// Adds an entry to the zonefile like AddEntry, where a missing TTL is
+// set to the one returned by defaultTTL
+func (z *Zonefile) addEntry(e Entry, defaultTTL func() *int) *Entry {
+	if !e.isControl {
+		if s := z.inferStyle(); s.inferred {
+			e.layout(s, defaultTTL)
+		}
+	}
+	e.zf = z
+
 	// Prefix suffix to entry
 	var taggedSuffix []taggedToken
 	for _, t := range z.suffix {
@@ -320,6 +366,7 @@ func (z *Zonefile) AddEntry(e Entry) *Entry {
 	e.tokens = append(taggedSuffix, e.tokens...)
 	z.suffix = []token{}
 	z.entries = append(z.entries, e)
+	z.count(&z.entries[len(z.entries)-1], 1)
 	return &z.entries[len(z.entries)-1]
 }
 
@@ -398,6 +445,7 @@ func Load(data []byte) (r *Zonefile, e ParsingError) {
 			if err != nil {
 				return nil, err
 			}
+			entry.zf = r
 			r.entries = append(r.entries, entry)
 			line = nil
 			itemsInLine = 0
@@ -408,6 +456,7 @@ func Load(data []byte) (r *Zonefile, e ParsingError) {
 		if err != nil {
 			return nil, err
 		}
+		entry.zf = r
 		r.entries = append(r.entries, entry)
 	} else {
 		r.suffix = line
@@ -421,7 +470,8 @@ func Load(data []byte) (r *Zonefile, e ParsingError) {
 
 type entry struct {
 	tokens    []taggedToken
-	isControl bool // is this a control ($INCLUDE, $TTL, ...) entry?
+	isControl bool      // is this a control ($INCLUDE, $TTL, ...) entry?
+	zf        *Zonefile // the zonefile the entry is part of, if any
 }
 
 // The interesting tokens in each line are tagged by their kind so
@@ -468,6 +518,22 @@ var tttTTL taggedToken = taggedToken{
 var tttValue taggedToken = taggedToken{
 	token{val: []byte{'.'}, typ: tokenItem}, useValue}
 
+// tagged token template left parenthesis
+var tttLeftParen taggedToken = taggedToken{
+	token{val: []byte{'('}, typ: tokenLeftParen}, useOther}
+
+// tagged token template right parenthesis
+var tttRightParen taggedToken = taggedToken{
+	token{val: []byte{')'}, typ: tokenRightParen}, useOther}
+
+// tagged token template comment
+var tttComment taggedToken = taggedToken{
+	token{val: []byte{';'}, typ: tokenComment}, useComment}
+
+// tagged token template control
+var tttControl taggedToken = taggedToken{
+	token{val: []byte{'.'}, typ: tokenItem}, useControl}
+
 func newParsingError(msg string, where token) ParsingError {
 	var ret parsingError
 	ret.lineno = where.lineno
@@ -565,7 +631,7 @@ func parseLine(line []token) (e Entry, err ParsingError) {
 		}
 
 		// Ok, it must be a TTL
-		_, err2 := strconv.Atoi(string(e.tokens[i].t.Value()))
+		_, err2 := parseTTL(string(e.tokens[i].t.Value()))
 		if err2 != nil {
 			err = newParsingError("invalid type/class/ttl", e.tokens[i].t)
 			return
@@ -731,7 +797,7 @@ const (
 type token struct {
 	typ           tokenType // type of token
 	val           []byte
-	lineno, colno int // line and column number in originally parsed file
+	lineno, colno int // where it starts in the originally parsed file
 }
 
 func (t token) String() string {
@@ -753,6 +819,10 @@ type lexer struct {
 	lineno        int
 	colno         int
 	prevLineWidth int
+
+	// where the token that is being lexed starts
+	startLineno int
+	startColno  int
 }
 
 func (l *lexer) run() {
@@ -772,8 +842,9 @@ func (l *lexer) emit(t tokenType) {
 		val = l.buf[l.start:l.pos]
 	}
 	l.tokens <- token{typ: t, val: val,
-		lineno: l.lineno, colno: l.colno}
+		lineno: l.startLineno, colno: l.startColno}
 	l.start = l.pos
+	l.startLineno, l.startColno = l.lineno, l.colno+1
 }
 
 func (l *lexer) errorf(format string, args ...interface{}) lexerState {
@@ -785,8 +856,9 @@ func (l *lexer) errorf(format string, args ...interface{}) lexerState {
 
 func lex(buf []byte) *lexer {
 	l := &lexer{
-		buf:    buf,
-		tokens: make(chan token),
+		buf:        buf,
+		tokens:     make(chan token),
+		startColno: 1,
 	}
 	go l.run()
 	return l
@@ -802,8 +874,9 @@ func (l *lexer) next() (r byte) {
 		l.lineno += 1
 		l.prevLineWidth = l.colno
 		l.colno = 0
+	} else {
+		l.colno += 1
 	}
-	l.colno += 1
 	l.pos += 1
 	return
 }
@@ -811,10 +884,11 @@ func (l *lexer) next() (r byte) {
 // backs up the lexer one byte; backup up two bytes is not allowed
 func (l *lexer) backup() {
 	l.pos -= 1
-	l.colno -= 1
-	if l.colno == 0 {
+	if l.pos < len(l.buf) && l.buf[l.pos] == '\n' {
 		l.lineno -= 1
 		l.colno = l.prevLineWidth
+	} else {
+		l.colno -= 1
 	}
 }
 
@@ -872,7 +946,7 @@ func lexInitial(l *lexer) lexerState {
 		if !l.inGroup {
 			return l.errorf("unexpected )")
 		}
-		l.emit(tokenLeftParen)
+		l.emit(tokenRightParen)
 		l.inGroup = false
 		return lexInitial
 	default:
@@ -904,11 +978,15 @@ func lexItem(l *lexer) lexerState {
 
 func lexQuotedItem(l *lexer) lexerState {
 	precedingSlash := false
+	lineno, colno := l.lineno, l.colno
 	for {
 		switch c := l.next(); {
 		case c == '"' && !precedingSlash:
 			l.emit(tokenQuotedItem)
 			return lexInitial
+		case c == eof && l.pos > len(l.buf):
+			l.lineno, l.colno = lineno, colno
+			return l.errorf("unterminated quoted string")
 		case c == '\\':
 			precedingSlash = !precedingSlash
 		default:
@@ -367,3 +367,52 @@ wwwtest       IN  CNAME www                   ; wwwtest.example.com is another a
 mail          IN  A     192.0.2.3             ; IPv4 address for mail.example.com
 mail2         IN  A     192.0.2.4             ; IPv4 address for mail2.example.com
 mail3         IN  A     192.0.2.5             ; IPv4 address for mail3.example.com`}
+
+// Load and Records both point at the start of the token that's wrong
+func TestErrorColumns(t *testing.T) {
+	for _, test := range []struct {
+		zone          string
+		lineno, colno int
+	}{
+		{"www IN CH A 1.2.3.4\n", 0, 8},
+		{"@ 60 IN A 1.2.3.4\nwww 60 IN A 1.2.3\n", 1, 13},
+		{"@ 60 IN TXT \"two\nlines\" \\x\nwww 60 IN A 1.2.3\n", 2, 13},
+	} {
+		zf, err := zonefile.Load([]byte(test.zone))
+		if err == nil {
+			_, err2 := zf.Records("example.com.")
+			err, _ = err2.(zonefile.ParsingError)
+		}
+		if err == nil {
+			t.Fatalf("expected an error for %q", test.zone)
+		}
+		if err.LineNo() != test.lineno || err.ColNo() != test.colno {
+			t.Fatalf("%q: error %v at %d:%d instead of %d:%d", test.zone,
+				err, err.LineNo(), err.ColNo(), test.lineno, test.colno)
+		}
+	}
+}
+
+func TestUnterminatedQuote(t *testing.T) {
+	_, err := zonefile.Load([]byte("@ TXT \"abc\nwww A 1.2.3.4\n"))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if err.LineNo() != 0 || err.ColNo() != 7 {
+		t.Fatal("Unexpected error location:", err.LineNo(), err.ColNo())
+	}
+}
+
+func TestTTLRange(t *testing.T) {
+	e, err := zonefile.ParseEntry([]byte("www 2147483647 IN A 1.2.3.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.TTL() == nil || *e.TTL() != 2147483647 {
+		t.Fatal("Unexpected TTL:", e.TTL())
+	}
+	if _, err := zonefile.ParseEntry([]byte(
+		"www 4294967296 IN A 1.2.3.4")); err == nil {
+		t.Fatal("Expected an error for a TTL over 32 bits")
+	}
+}